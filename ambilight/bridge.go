@@ -0,0 +1,186 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ambilight bridges the serial protocols of ambilight software
+// (Hyperion, Prismatik, ...) to a WS2811 channel, so that a Raspberry Pi can
+// replace the Arduino usually driving the LEDs.
+//
+// The bridge reads Adalight or TPM2 frames from any io.Reader, such as a
+// serial port (e.g. a USB gadget tty) or a pseudo terminal, and renders each
+// valid frame. Invalid frames are skipped and the bridge resynchronizes on the
+// next header.
+package ambilight
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+)
+
+// Protocol is a framing protocol.
+type Protocol int
+
+const (
+	// Adalight frames start with "Ada", the LED count minus one (16 bits) and
+	// a checksum, followed by the RGB values.
+	Adalight Protocol = iota
+	// TPM2 frames start with 0xC9, the frame type and the data size (16 bits),
+	// followed by the data and 0x36.
+	TPM2
+)
+
+// TPM2 constants.
+const (
+	tpm2Start     = 0xc9
+	tpm2End       = 0x36
+	tpm2TypeData  = 0xda
+	adalightMagic = "Ada"
+)
+
+var errInvalidFrame = errors.New("invalid frame")
+
+// Stats are the statistics of a bridge.
+type Stats struct {
+	// Frames is the number of rendered frames
+	Frames int
+	// Errors is the number of invalid frames
+	Errors int
+}
+
+// Bridge renders the frames read from a serial stream on a channel of a
+// device.
+type Bridge struct {
+	r        *bufio.Reader
+	dev      ws2811.Device
+	channel  int
+	protocol Protocol
+	stats    Stats
+}
+
+// MakeBridge creates a bridge reading frames of the given protocol from r.
+// The device must be initialized.
+func MakeBridge(r io.Reader, dev ws2811.Device, channel int, protocol Protocol) *Bridge {
+	return &Bridge{
+		r:        bufio.NewReader(r),
+		dev:      dev,
+		channel:  channel,
+		protocol: protocol,
+	}
+}
+
+// Stats returns the statistics of the bridge. It must not be called
+// concurrently with Run.
+func (b *Bridge) Stats() Stats {
+	return b.stats
+}
+
+// Run renders the frames until the end of the stream. It returns nil at the
+// end of the stream, or the first error of the reader or of the device.
+func (b *Bridge) Run() error {
+	for {
+		var rgb []byte
+		var err error
+		switch b.protocol {
+		case TPM2:
+			rgb, err = b.readTPM2()
+		default:
+			rgb, err = b.readAdalight()
+		}
+		switch {
+		case errors.Is(err, errInvalidFrame):
+			b.stats.Errors++
+			continue
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			return nil
+		case err != nil:
+			return err
+		case rgb == nil:
+			continue
+		}
+
+		leds := b.dev.Leds(b.channel)
+		for i := 0; i < len(leds) && 3*i+2 < len(rgb); i++ {
+			leds[i] = uint32(rgb[3*i])<<16 | uint32(rgb[3*i+1])<<8 | uint32(rgb[3*i+2])
+		}
+		if err := b.dev.Render(); err != nil {
+			return err
+		}
+		b.stats.Frames++
+	}
+}
+
+// readAdalight reads the next Adalight frame and returns its RGB values.
+func (b *Bridge) readAdalight() ([]byte, error) {
+	if err := b.sync(adalightMagic); err != nil {
+		return nil, err
+	}
+	var h [3]byte
+	if _, err := io.ReadFull(b.r, h[:]); err != nil {
+		return nil, err
+	}
+	if h[2] != h[0]^h[1]^0x55 {
+		return nil, errInvalidFrame
+	}
+	count := (int(h[0])<<8 | int(h[1])) + 1
+	rgb := make([]byte, 3*count)
+	if _, err := io.ReadFull(b.r, rgb); err != nil {
+		return nil, err
+	}
+	return rgb, nil
+}
+
+// readTPM2 reads the next TPM2 frame and returns its RGB values, or nil if it
+// is not a data frame.
+func (b *Bridge) readTPM2() ([]byte, error) {
+	if err := b.sync(string([]byte{tpm2Start})); err != nil {
+		return nil, err
+	}
+	var h [3]byte
+	if _, err := io.ReadFull(b.r, h[:]); err != nil {
+		return nil, err
+	}
+	data := make([]byte, int(h[1])<<8|int(h[2])+1)
+	if _, err := io.ReadFull(b.r, data); err != nil {
+		return nil, err
+	}
+	if data[len(data)-1] != tpm2End {
+		return nil, errInvalidFrame
+	}
+	if h[0] != tpm2TypeData {
+		return nil, nil
+	}
+	return data[:len(data)-1], nil
+}
+
+// sync skips bytes until after the next occurrence of magic.
+func (b *Bridge) sync(magic string) error {
+	matched := 0
+	for matched < len(magic) {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == magic[matched]:
+			matched++
+		case c == magic[0]:
+			matched = 1
+		default:
+			matched = 0
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ambilight
+
+import (
+	"io"
+	"testing"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// device is a simulated device that records the rendered frames.
+type device struct {
+	*ws2811.WS2811
+	frames [][]uint32
+}
+
+func (d *device) Render() error {
+	d.frames = append(d.frames, append([]uint32(nil), d.Leds(0)...))
+	return nil
+}
+
+func newDevice(t *testing.T, ledCount int) *device {
+	ws, err := ws2811.MakeWS2811(&ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: ledCount}}})
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	return &device{WS2811: ws}
+}
+
+func run(t *testing.T, dev *device, protocol Protocol, chunks ...[]byte) Stats {
+	r, w := io.Pipe()
+	go func() {
+		for _, c := range chunks {
+			w.Write(c) // nolint: errcheck
+		}
+		w.Close()
+	}()
+	b := MakeBridge(r, dev, 0, protocol)
+	assert.Nil(t, b.Run())
+	return b.Stats()
+}
+
+func TestAdalight(t *testing.T) {
+	dev := newDevice(t, 2)
+	stats := run(t, dev, Adalight,
+		[]byte("noise"),
+		[]byte{'A', 'd', 'a', 0, 1, 0x54, 1, 2, 3, 4, 5, 6},
+		// bad checksum
+		[]byte{'A', 'd', 'a', 0, 0, 0, 9, 9, 9},
+		// split over several writes
+		[]byte{'A', 'A', 'd'}, []byte{'a', 0, 0, 0x55, 7}, []byte{8, 9},
+	)
+	assert.Equal(t, Stats{Frames: 2, Errors: 1}, stats)
+	assert.Equal(t, [][]uint32{{0x010203, 0x040506}, {0x070809, 0x040506}}, dev.frames)
+}
+
+func TestTPM2(t *testing.T) {
+	dev := newDevice(t, 2)
+	stats := run(t, dev, TPM2,
+		[]byte{0xc9, 0xda, 0, 6, 1, 2, 3, 4, 5, 6, 0x36},
+		// command frame
+		[]byte{0xc9, 0xc0, 0, 1, 0x0a, 0x36},
+		// missing end byte
+		[]byte{0xc9, 0xda, 0, 3, 9, 9, 9, 0},
+		[]byte{0xc9, 0xda, 0, 3, 7, 8, 9, 0x36},
+	)
+	assert.Equal(t, Stats{Frames: 2, Errors: 1}, stats)
+	assert.Equal(t, [][]uint32{{0x010203, 0x040506}, {0x070809, 0x040506}}, dev.frames)
+}
@@ -0,0 +1,313 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package artnet implements an Art-Net 4 node that drives the channels of a
+// WS2811 device.
+//
+// The node has one output port per DMX universe needed to cover the LEDs of
+// the channels. It answers ArtPoll with ArtPollReply so that controllers can
+// discover it, renders ArtDmx data and honours ArtSync.
+package artnet
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/internal/dmx"
+)
+
+const (
+	// DefaultPort is the UDP port of Art-Net
+	DefaultPort = 0x1936
+	// SyncTimeout is the time without ArtSync after which the node renders
+	// the ArtDmx packets waiting for it, and the next ones as soon as they
+	// arrive
+	SyncTimeout = 4 * time.Second
+
+	// pollInterval is the maximum time between two checks for a lost ArtSync
+	pollInterval = 100 * time.Millisecond
+)
+
+// Config is the configuration of a Node.
+type Config struct {
+	// Addr is the UDP address to listen on (default ":6454")
+	Addr string
+	// IP is the address of the node advertised in ArtPollReply
+	IP net.IP
+	// ShortName is the short name of the node (17 characters max)
+	ShortName string
+	// LongName is the long name of the node (63 characters max)
+	LongName string
+	// PortAddress is the 15-bit port-address of the first universe. The
+	// following universes use consecutive port-addresses.
+	PortAddress uint16
+	// OnError, if not nil, is called with the render errors of the device,
+	// which do not stop the node. They are logged by default.
+	OnError func(error)
+}
+
+// Port is an output port of the node.
+type Port struct {
+	// Address is the 15-bit port-address (Net, Sub-Net and Universe)
+	Address uint16
+	dmx.Universe
+}
+
+// Net returns the Net of the port-address.
+func (p *Port) Net() uint8 {
+	return uint8(p.Address >> 8 & 0x7f)
+}
+
+// SubNet returns the Sub-Net of the port-address.
+func (p *Port) SubNet() uint8 {
+	return uint8(p.Address >> 4 & 0x0f)
+}
+
+// Node is an Art-Net node.
+type Node struct {
+	dev     ws2811.Device
+	cfg     Config
+	ports   []Port
+	byAddr  map[uint16]int
+	good    []bool
+	refresh uint16
+	// lastSync is the time of the last ArtSync, zero if not in synchronous mode
+	lastSync time.Time
+	// pending is true when ArtDmx data waits for an ArtSync
+	pending bool
+
+	mu     sync.Mutex
+	conn   net.PacketConn
+	closed bool
+}
+
+// MakeNode creates a node for a device configured with opt. The device must
+// be initialized. The ports are derived from the LedCount and the StripeType
+// of the channels. The channels that the device does not have get no ports.
+func MakeNode(dev ws2811.Device, opt *ws2811.Option, cfg Config) *Node {
+	if cfg.Addr == "" {
+		cfg.Addr = fmt.Sprintf(":%d", DefaultPort)
+	}
+	if cfg.ShortName == "" {
+		cfg.ShortName = "rpi-ws281x"
+	}
+	if cfg.LongName == "" {
+		cfg.LongName = "rpi-ws281x-go Art-Net node"
+	}
+	n := &Node{
+		dev:    dev,
+		cfg:    cfg,
+		byAddr: make(map[uint16]int),
+	}
+
+	address := cfg.PortAddress
+	maxBits := 0
+	for channel, c := range opt.Channels {
+		if channel >= ws2811.RpiPwmChannels {
+			break
+		}
+		components := ws2811.StripeComponents(c.StripeType)
+		for _, u := range dmx.Split(0, channel, c.LedCount, components) {
+			n.byAddr[address] = len(n.ports)
+			n.ports = append(n.ports, Port{Address: address, Universe: u})
+			address++
+		}
+		if bits := c.LedCount * components * 8; bits > maxBits {
+			maxBits = bits
+		}
+	}
+	n.good = make([]bool, len(n.ports))
+	if maxBits > 0 && opt.Frequency > 0 {
+		n.refresh = uint16(opt.Frequency / maxBits)
+	}
+	return n
+}
+
+// Ports returns the output ports of the node.
+func (n *Node) Ports() []Port {
+	return n.ports
+}
+
+// ListenAndServe listens on the configured address and serves the packets
+// until Close is called.
+func (n *Node) ListenAndServe() error {
+	conn, err := net.ListenPacket("udp4", n.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	return n.Serve(conn)
+}
+
+// Serve reads the packets from conn until Close is called. Serve closes conn
+// when it returns. The render errors of the device are passed to
+// Config.OnError.
+func (n *Node) Serve(conn net.PacketConn) error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		conn.Close()
+		return net.ErrClosed
+	}
+	n.conn = conn
+	n.mu.Unlock()
+	defer conn.Close()
+
+	buf := make([]byte, 1500)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(pollInterval)); err != nil {
+			return err
+		}
+		size, addr, err := conn.ReadFrom(buf)
+		now := time.Now()
+		if err != nil {
+			var ne net.Error
+			if !errors.As(err, &ne) || !ne.Timeout() {
+				if n.isClosed() {
+					return nil
+				}
+				return err
+			}
+		} else {
+			n.error(n.handle(conn, addr, buf[:size], now))
+		}
+		n.error(n.expire(now))
+	}
+}
+
+// Close stops the node.
+func (n *Node) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.closed = true
+	if n.conn != nil {
+		return n.conn.Close()
+	}
+	return nil
+}
+
+func (n *Node) isClosed() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.closed
+}
+
+func (n *Node) error(err error) {
+	if err == nil {
+		return
+	}
+	if n.cfg.OnError != nil {
+		n.cfg.OnError(err)
+		return
+	}
+	log.Printf("artnet: %v", err)
+}
+
+// handle processes a packet. Invalid packets are ignored; only errors of the
+// device are returned.
+func (n *Node) handle(conn net.PacketConn, addr net.Addr, b []byte, now time.Time) error {
+	op, err := parseHeader(b)
+	if err != nil {
+		return nil
+	}
+	switch op {
+	case OpPoll:
+		// replies are best effort, like any UDP packet
+		for _, reply := range n.pollReplies() {
+			conn.WriteTo(reply, addr) // nolint: errcheck
+		}
+	case OpDmx:
+		p, err := parseDmx(b)
+		if err != nil {
+			return nil
+		}
+		i, ok := n.byAddr[p.address]
+		if !ok {
+			return nil
+		}
+		port := &n.ports[i]
+		port.Write(n.dev.Leds(port.Channel), p.data)
+		n.good[i] = true
+		if !n.lastSync.IsZero() && now.Sub(n.lastSync) < SyncTimeout {
+			n.pending = true
+			return nil // wait for ArtSync
+		}
+		n.lastSync = time.Time{}
+		return n.dev.Render()
+	case OpSync:
+		n.lastSync = now
+		n.pending = false
+		return n.dev.Render()
+	}
+	return nil
+}
+
+// expire leaves the synchronous mode when ArtSync has not been received for
+// SyncTimeout, and renders the data waiting for it.
+func (n *Node) expire(now time.Time) error {
+	if n.lastSync.IsZero() || now.Sub(n.lastSync) < SyncTimeout {
+		return nil
+	}
+	n.lastSync = time.Time{}
+	if !n.pending {
+		return nil
+	}
+	n.pending = false
+	return n.dev.Render()
+}
+
+// pollReplies returns the ArtPollReply packets describing the node. A reply
+// describes up to 4 ports sharing the same Net and Sub-Net.
+func (n *Node) pollReplies() [][]byte {
+	var ip [4]byte
+	copy(ip[:], n.cfg.IP.To4())
+
+	newReply := func(bindIndex int) *pollReply {
+		return &pollReply{
+			ip:          ip,
+			shortName:   n.cfg.ShortName,
+			longName:    n.cfg.LongName,
+			nodeReport:  "#0001 [0000] Node ready",
+			bindIndex:   uint8(bindIndex),
+			refreshRate: n.refresh,
+		}
+	}
+	if len(n.ports) == 0 {
+		return [][]byte{newReply(1).marshal()}
+	}
+
+	var replies [][]byte
+	for start := 0; start < len(n.ports); {
+		reply := newReply(len(replies) + 1)
+		reply.net = n.ports[start].Net()
+		reply.subNet = n.ports[start].SubNet()
+		end := start
+		for end < len(n.ports) && end-start < 4 && n.ports[end].Address>>4 == n.ports[start].Address>>4 {
+			reply.swOut = append(reply.swOut, uint8(n.ports[end].Address&0x0f))
+			var good uint8
+			if n.good[end] {
+				good = 0x80
+			}
+			reply.goodOutput = append(reply.goodOutput, good)
+			end++
+		}
+		replies = append(replies, reply.marshal())
+		start = end
+	}
+	return replies
+}
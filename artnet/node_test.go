@@ -0,0 +1,213 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// device is a simulated device that reports renders.
+type device struct {
+	*ws2811.WS2811
+	rendered chan []uint32
+}
+
+func (d *device) Render() error {
+	d.rendered <- append([]uint32(nil), d.Leds(0)...)
+	return nil
+}
+
+func expectFrame(t *testing.T, dev *device, want []uint32) {
+	select {
+	case got := <-dev.rendered:
+		assert.Equal(t, want, got)
+	case <-time.After(time.Second):
+		t.Fatal("no frame rendered")
+	}
+}
+
+func header(op uint16, size int) []byte {
+	b := make([]byte, size)
+	copy(b, packetID)
+	binary.LittleEndian.PutUint16(b[8:], op)
+	binary.BigEndian.PutUint16(b[10:], protocolVersion)
+	return b
+}
+
+func dmxPacketBytes(address uint16, data []byte) []byte {
+	b := header(OpDmx, dmxHeaderLen+len(data))
+	b[14] = uint8(address)
+	b[15] = uint8(address >> 8)
+	binary.BigEndian.PutUint16(b[16:], uint16(len(data)))
+	copy(b[dmxHeaderLen:], data)
+	return b
+}
+
+func TestPorts(t *testing.T) {
+	opt := ws2811.Option{
+		Frequency: ws2811.TargetFreq,
+		Channels: []ws2811.ChannelOption{
+			{LedCount: 200, StripeType: ws2811.WS2812Strip},
+			{LedCount: 100, StripeType: ws2811.SK6812StripRGBW},
+		},
+	}
+	n := MakeNode(nil, &opt, Config{PortAddress: 0x010e})
+	ports := n.Ports()
+	assert.Equal(t, 3, len(ports))
+	assert.Equal(t, uint16(0x010e), ports[0].Address)
+	assert.Equal(t, 170, ports[0].Count)
+	assert.Equal(t, 30, ports[1].Count)
+	assert.Equal(t, 170, ports[1].Start)
+	assert.Equal(t, uint16(0x0110), ports[2].Address)
+	assert.Equal(t, 1, ports[2].Channel)
+	assert.Equal(t, 4, ports[2].Components)
+	assert.Equal(t, uint8(1), ports[2].Net())
+	assert.Equal(t, uint8(1), ports[2].SubNet())
+
+	// the third port is in another Sub-Net
+	replies := n.pollReplies()
+	assert.Equal(t, 2, len(replies))
+	assert.Equal(t, uint16(2), binary.BigEndian.Uint16(replies[0][172:]))
+	assert.Equal(t, []byte{0x0e, 0x0f}, replies[0][190:192])
+	assert.Equal(t, uint8(1), replies[1][19])
+	assert.Equal(t, uint8(2), replies[1][211])
+	// 800kHz / (200 LEDs * 24 bits)
+	assert.Equal(t, uint16(166), binary.BigEndian.Uint16(replies[0][226:]))
+}
+
+func TestPortsMissingChannel(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 1}, {LedCount: 1}, {LedCount: 1}}}
+	n := MakeNode(nil, &opt, Config{})
+	assert.Equal(t, 2, len(n.Ports()))
+}
+
+func TestNode(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 2}}}
+	ws, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	dev := &device{WS2811: ws, rendered: make(chan []uint32, 16)}
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.Nil(t, err)
+	n := MakeNode(dev, &opt, Config{ShortName: "test", PortAddress: 3})
+	go n.Serve(conn) // nolint: errcheck
+	defer n.Close()
+
+	client, err := net.Dial("udp4", conn.LocalAddr().String())
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// discovery
+	_, err = client.Write(header(OpPoll, 14))
+	assert.Nil(t, err)
+	assert.Nil(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 1024)
+	size, err := client.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, pollReplyLen, size)
+	assert.Equal(t, uint16(OpPollReply), binary.LittleEndian.Uint16(buf[8:]))
+	assert.Equal(t, "test", string(buf[26:30]))
+	assert.Equal(t, uint8(3), buf[190])
+
+	// immediate mode
+	client.Write(dmxPacketBytes(4, []byte{1, 1, 1}))       // nolint: errcheck
+	client.Write(dmxPacketBytes(3, []byte{1, 2, 3, 4, 5})) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0x010203, 0})
+
+	// synchronous mode
+	client.Write(header(OpSync, 14)) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0x010203, 0})
+	client.Write(dmxPacketBytes(3, []byte{6, 6, 6})) // nolint: errcheck
+	client.Write(header(OpSync, 14))                 // nolint: errcheck
+	expectFrame(t, dev, []uint32{0x060606, 0})
+}
+
+func TestSyncTimeout(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 1}}}
+	ws, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	dev := &device{WS2811: ws, rendered: make(chan []uint32, 16)}
+	n := MakeNode(dev, &opt, Config{})
+
+	start := time.Now()
+	assert.Nil(t, n.handle(nil, nil, header(OpSync, 14), start))
+	expectFrame(t, dev, []uint32{0})
+	assert.Nil(t, n.handle(nil, nil, dmxPacketBytes(0, []byte{1, 2, 3}), start.Add(time.Second)))
+	assert.Nil(t, n.expire(start.Add(2*time.Second)))
+	assert.Empty(t, dev.rendered)
+
+	// the data waiting for the lost ArtSync is rendered after the timeout
+	assert.Nil(t, n.expire(start.Add(SyncTimeout)))
+	expectFrame(t, dev, []uint32{0x010203})
+	assert.Nil(t, n.expire(start.Add(SyncTimeout+time.Second)))
+	assert.Empty(t, dev.rendered)
+
+	// and the next data at once
+	assert.Nil(t, n.handle(nil, nil, dmxPacketBytes(0, []byte{4, 5, 6}), start.Add(SyncTimeout+time.Second)))
+	expectFrame(t, dev, []uint32{0x040506})
+}
+
+// failingDevice fails its first render.
+type failingDevice struct {
+	*device
+	failed bool
+}
+
+func (d *failingDevice) Render() error {
+	if !d.failed {
+		d.failed = true
+		return errors.New("render failed")
+	}
+	return d.device.Render()
+}
+
+func TestRenderError(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 1}}}
+	ws, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	dev := &device{WS2811: ws, rendered: make(chan []uint32, 16)}
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.Nil(t, err)
+	errs := make(chan error, 1)
+	n := MakeNode(&failingDevice{device: dev}, &opt, Config{OnError: func(err error) { errs <- err }})
+	go n.Serve(conn) // nolint: errcheck
+	defer n.Close()
+
+	client, err := net.Dial("udp4", conn.LocalAddr().String())
+	assert.Nil(t, err)
+	defer client.Close()
+
+	client.Write(dmxPacketBytes(0, []byte{1, 1, 1})) // nolint: errcheck
+	select {
+	case err := <-errs:
+		assert.EqualError(t, err, "render failed")
+	case <-time.After(time.Second):
+		t.Fatal("no error reported")
+	}
+	// the node keeps serving
+	client.Write(dmxPacketBytes(0, []byte{2, 2, 2})) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0x020202})
+}
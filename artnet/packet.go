@@ -0,0 +1,118 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// OpCodes of the Art-Net packets handled by the node.
+const (
+	OpPoll      = 0x2000
+	OpPollReply = 0x2100
+	OpDmx       = 0x5000
+	OpSync      = 0x5200
+)
+
+const (
+	protocolVersion = 14
+	headerLen       = 12
+	dmxHeaderLen    = 18
+	pollReplyLen    = 239
+)
+
+// nolint: gochecknoglobals
+var packetID = []byte("Art-Net\x00")
+
+var errInvalidPacket = errors.New("invalid Art-Net packet")
+
+// dmxPacket is an ArtDmx packet.
+type dmxPacket struct {
+	sequence uint8
+	address  uint16
+	data     []byte
+}
+
+// parseHeader checks the header of a packet and returns its OpCode.
+func parseHeader(b []byte) (uint16, error) {
+	if len(b) < headerLen || !bytes.Equal(b[:8], packetID) {
+		return 0, errInvalidPacket
+	}
+	op := binary.LittleEndian.Uint16(b[8:])
+	// ArtPollReply has no protocol version
+	if op != OpPollReply && binary.BigEndian.Uint16(b[10:]) < protocolVersion {
+		return 0, errInvalidPacket
+	}
+	return op, nil
+}
+
+func parseDmx(b []byte) (*dmxPacket, error) {
+	if len(b) < dmxHeaderLen {
+		return nil, errInvalidPacket
+	}
+	length := int(binary.BigEndian.Uint16(b[16:]))
+	if length > 512 || dmxHeaderLen+length > len(b) {
+		return nil, errInvalidPacket
+	}
+	return &dmxPacket{
+		sequence: b[12],
+		address:  uint16(b[15]&0x7f)<<8 | uint16(b[14]),
+		data:     b[dmxHeaderLen : dmxHeaderLen+length],
+	}, nil
+}
+
+// pollReply is the content of an ArtPollReply packet.
+type pollReply struct {
+	ip          [4]byte
+	net         uint8
+	subNet      uint8
+	shortName   string
+	longName    string
+	nodeReport  string
+	bindIndex   uint8
+	swOut       []uint8
+	goodOutput  []uint8
+	refreshRate uint16
+}
+
+func (r *pollReply) marshal() []byte {
+	b := make([]byte, pollReplyLen)
+	copy(b, packetID)
+	binary.LittleEndian.PutUint16(b[8:], OpPollReply)
+	copy(b[10:14], r.ip[:])
+	binary.LittleEndian.PutUint16(b[14:], DefaultPort)
+	binary.BigEndian.PutUint16(b[16:], 1) // firmware version
+	b[18] = r.net
+	b[19] = r.subNet
+	binary.BigEndian.PutUint16(b[20:], 0x00ff) // OEM unknown
+	b[23] = 0xd0                               // indicators normal, addresses set locally
+	copy(b[26:43], r.shortName)
+	copy(b[44:107], r.longName)
+	copy(b[108:171], r.nodeReport)
+	binary.BigEndian.PutUint16(b[172:], uint16(len(r.swOut)))
+	for i := range r.swOut {
+		b[174+i] = 0x80 // output from Art-Net, DMX512
+		b[182+i] = r.goodOutput[i]
+		b[190+i] = r.swOut[i]
+	}
+	b[200] = 0x00 // StNode
+	copy(b[207:211], r.ip[:])
+	b[211] = r.bindIndex
+	b[212] = 0x08 // 15-bit port-address
+	binary.BigEndian.PutUint16(b[226:], r.refreshRate)
+	return b
+}
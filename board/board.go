@@ -0,0 +1,246 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package board detects the Raspberry Pi model in pure Go, without the C
+// library, so that it works on any Linux and can be tested with fixture
+// files. The revision code is read from the device tree or from /proc/cpuinfo
+// and decoded into the model, the amount of RAM, the manufacturer and the SoC
+// (see https://www.raspberrypi.com/documentation/computers/raspberry-pi.html#raspberry-pi-revision-codes).
+// Board.Check then tells which driver of the C library each channel uses and
+// whether the GPIO pins work on the board, before the device is initialized.
+package board
+
+import (
+	"fmt"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+)
+
+// Processor is the SoC of a board.
+type Processor int
+
+// Processors, as encoded in the new style revision codes.
+const (
+	BCM2835 Processor = 0
+	BCM2836 Processor = 1
+	BCM2837 Processor = 2
+	BCM2711 Processor = 3
+	BCM2712 Processor = 4
+)
+
+// String returns the name of the processor.
+func (p Processor) String() string {
+	switch p {
+	case BCM2835:
+		return "BCM2835"
+	case BCM2836:
+		return "BCM2836"
+	case BCM2837:
+		return "BCM2837"
+	case BCM2711:
+		return "BCM2711"
+	case BCM2712:
+		return "BCM2712"
+	}
+	return fmt.Sprintf("Processor(%d)", int(p))
+}
+
+// Board types, as encoded in the new style revision codes.
+const (
+	TypeA       = 0x00
+	TypeB       = 0x01
+	TypeAPlus   = 0x02
+	TypeBPlus   = 0x03
+	Type2B      = 0x04
+	TypeAlpha   = 0x05
+	TypeCM1     = 0x06
+	Type3B      = 0x08
+	TypeZero    = 0x09
+	TypeCM3     = 0x0a
+	TypeZeroW   = 0x0c
+	Type3BPlus  = 0x0d
+	Type3APlus  = 0x0e
+	TypeCM3Plus = 0x10
+	Type4B      = 0x11
+	TypeZero2W  = 0x12
+	Type400     = 0x13
+	TypeCM4     = 0x14
+	TypeCM4S    = 0x15
+	Type5       = 0x17
+	TypeCM5     = 0x18
+	Type500     = 0x19
+	TypeCM5Lite = 0x1a
+)
+
+// typeNames are the names of the board types.
+// nolint: gochecknoglobals
+var typeNames = map[int]string{
+	TypeA:       "Model A",
+	TypeB:       "Model B",
+	TypeAPlus:   "Model A+",
+	TypeBPlus:   "Model B+",
+	Type2B:      "2 Model B",
+	TypeAlpha:   "Alpha",
+	TypeCM1:     "Compute Module 1",
+	Type3B:      "3 Model B",
+	TypeZero:    "Zero",
+	TypeCM3:     "Compute Module 3",
+	TypeZeroW:   "Zero W",
+	Type3BPlus:  "3 Model B+",
+	Type3APlus:  "3 Model A+",
+	TypeCM3Plus: "Compute Module 3+",
+	Type4B:      "4 Model B",
+	TypeZero2W:  "Zero 2 W",
+	Type400:     "400",
+	TypeCM4:     "Compute Module 4",
+	TypeCM4S:    "Compute Module 4S",
+	Type5:       "5 Model B",
+	TypeCM5:     "Compute Module 5",
+	Type500:     "500",
+	TypeCM5Lite: "Compute Module 5 Lite",
+}
+
+// manufacturers are the names of the manufacturers of the new style revision
+// codes.
+// nolint: gochecknoglobals
+var manufacturers = []string{"Sony UK", "Egoman", "Embest", "Sony Japan", "Embest", "Stadium"}
+
+// oldStyle are the boards of the old style revision codes, all with a
+// BCM2835.
+// nolint: gochecknoglobals
+var oldStyle = map[uint32]struct {
+	typ          int
+	pcbRevision  string
+	memory       int
+	manufacturer string
+}{
+	0x0002: {TypeB, "1.0", 256, "Egoman"},
+	0x0003: {TypeB, "1.0", 256, "Egoman"},
+	0x0004: {TypeB, "2.0", 256, "Sony UK"},
+	0x0005: {TypeB, "2.0", 256, "Qisda"},
+	0x0006: {TypeB, "2.0", 256, "Egoman"},
+	0x0007: {TypeA, "2.0", 256, "Egoman"},
+	0x0008: {TypeA, "2.0", 256, "Sony UK"},
+	0x0009: {TypeA, "2.0", 256, "Qisda"},
+	0x000d: {TypeB, "2.0", 512, "Egoman"},
+	0x000e: {TypeB, "2.0", 512, "Sony UK"},
+	0x000f: {TypeB, "2.0", 512, "Egoman"},
+	0x0010: {TypeBPlus, "1.2", 512, "Sony UK"},
+	0x0011: {TypeCM1, "1.0", 512, "Sony UK"},
+	0x0012: {TypeAPlus, "1.1", 256, "Sony UK"},
+	0x0013: {TypeBPlus, "1.2", 512, "Embest"},
+	0x0014: {TypeCM1, "1.0", 512, "Embest"},
+	0x0015: {TypeAPlus, "1.1", 256, "Embest"},
+}
+
+// Bits of the revision codes.
+const (
+	newStyleFlag = 1 << 23
+	// oldStyleMask removes the warranty bit of the old style codes
+	oldStyleMask = 0x00ffffff
+)
+
+// Board is a Raspberry Pi board.
+type Board struct {
+	// Revision is the revision code
+	Revision uint32
+	// Type is the board type, one of the TypeXXX constants
+	Type int
+	// Model is the name of the model, e.g. "Raspberry Pi 4 Model B"
+	Model string
+	// PCBRevision is the revision of the board, e.g. "1.4"
+	PCBRevision string
+	// Memory is the amount of RAM in MB
+	Memory int
+	// Manufacturer is the manufacturer of the board
+	Manufacturer string
+	// Processor is the SoC of the board
+	Processor Processor
+	// Serial is the serial number, if known
+	Serial string
+}
+
+// Decode decodes a revision code, in the old (e.g. 0x000e) or the new (e.g.
+// 0xc03114) style.
+func Decode(revision uint32) (Board, error) {
+	if revision&newStyleFlag == 0 {
+		b, ok := oldStyle[revision&oldStyleMask]
+		if !ok {
+			return Board{}, fmt.Errorf("unknown revision code %04x", revision)
+		}
+		return Board{
+			Revision:     revision,
+			Type:         b.typ,
+			Model:        "Raspberry Pi " + typeNames[b.typ],
+			PCBRevision:  b.pcbRevision,
+			Memory:       b.memory,
+			Manufacturer: b.manufacturer,
+			Processor:    BCM2835,
+		}, nil
+	}
+
+	b := Board{
+		Revision:    revision,
+		Type:        int(revision >> 4 & 0xff),
+		PCBRevision: fmt.Sprintf("1.%d", revision&0xf),
+		Memory:      256 << (revision >> 20 & 0x7),
+		Processor:   Processor(revision >> 12 & 0xf),
+	}
+	name, ok := typeNames[b.Type]
+	if !ok {
+		return Board{}, fmt.Errorf("unknown board type %#x in revision code %06x", b.Type, revision)
+	}
+	b.Model = "Raspberry Pi " + name
+	if m := int(revision >> 16 & 0xf); m < len(manufacturers) {
+		b.Manufacturer = manufacturers[m]
+	} else {
+		b.Manufacturer = fmt.Sprintf("Manufacturer(%d)", m)
+	}
+	return b, nil
+}
+
+// String returns a description of the board, e.g. "Raspberry Pi 4 Model B
+// Rev 1.4, 4GB, BCM2711, Sony UK".
+func (b Board) String() string {
+	memory := fmt.Sprintf("%dMB", b.Memory)
+	if b.Memory >= 1024 {
+		memory = fmt.Sprintf("%dGB", b.Memory/1024)
+	}
+	return fmt.Sprintf("%s Rev %s, %s, %v, %s", b.Model, b.PCBRevision, memory, b.Processor, b.Manufacturer)
+}
+
+// Supported reports whether the C library can drive the LEDs of the board.
+// The boards with a BCM2712 (Raspberry Pi 5 family) are not supported, as
+// their GPIO pins are behind the RP1 chip.
+func (b Board) Supported() bool {
+	return b.Processor <= BCM2711
+}
+
+// HwDesc returns the description of the board in the form of ws2811.HwDetect,
+// as the C library detects it. The Type is HwVerTypeUnknown if the board is
+// not supported.
+func (b Board) HwDesc() ws2811.HwDesc {
+	hw := ws2811.HwDesc{Version: b.Revision, Desc: b.String()}
+	switch b.Processor {
+	case BCM2835:
+		hw.Type, hw.PeriphBase, hw.VideocoreBase = ws2811.HwVerTypePi1, 0x20000000, 0x40000000
+	case BCM2836, BCM2837:
+		hw.Type, hw.PeriphBase, hw.VideocoreBase = ws2811.HwVerTypePi2, 0x3f000000, 0xc0000000
+	case BCM2711:
+		hw.Type, hw.PeriphBase, hw.VideocoreBase = ws2811.HwVerTypePi4, 0xfe000000, 0xc0000000
+	default:
+		hw.Type = ws2811.HwVerTypeUnknown
+	}
+	return hw
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package board
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	for _, tt := range []struct {
+		revision uint32
+		want     string
+	}{
+		{0x0002, "Raspberry Pi Model B Rev 1.0, 256MB, BCM2835, Egoman"},
+		{0x1000015, "Raspberry Pi Model A+ Rev 1.1, 256MB, BCM2835, Embest"},
+		{0xa01041, "Raspberry Pi 2 Model B Rev 1.1, 1GB, BCM2836, Sony UK"},
+		{0xa22082, "Raspberry Pi 3 Model B Rev 1.2, 1GB, BCM2837, Embest"},
+		{0x9000c1, "Raspberry Pi Zero W Rev 1.1, 512MB, BCM2835, Sony UK"},
+		{0x902120, "Raspberry Pi Zero 2 W Rev 1.0, 512MB, BCM2837, Sony UK"},
+		{0xd03114, "Raspberry Pi 4 Model B Rev 1.4, 8GB, BCM2711, Sony UK"},
+		{0xb03140, "Raspberry Pi Compute Module 4 Rev 1.0, 2GB, BCM2711, Sony UK"},
+		{0xc04170, "Raspberry Pi 5 Model B Rev 1.0, 4GB, BCM2712, Sony UK"},
+	} {
+		b, err := Decode(tt.revision)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.want, b.String(), "%x", tt.revision)
+	}
+
+	for _, revision := range []uint32{0x0001, 0x000a, 0xa001f1} {
+		_, err := Decode(revision)
+		assert.NotNil(t, err, "%x", revision)
+	}
+}
+
+func TestDetectFS(t *testing.T) {
+	for _, tt := range []struct {
+		dir       string
+		revision  uint32
+		typ       int
+		serial    string
+		supported bool
+		hwType    uint32
+	}{
+		{"pi1", 0x100000e, TypeB, "00000000c1b2a3d4", true, ws2811.HwVerTypePi1},
+		{"pi3", 0xa02082, Type3B, "", true, ws2811.HwVerTypePi2},
+		{"pi4", 0xc03114, Type4B, "100000002a4e8f6c", true, ws2811.HwVerTypePi4},
+		{"pi5", 0xc04170, Type5, "9f1c2e3d4b5a6978", false, ws2811.HwVerTypeUnknown},
+	} {
+		b, err := DetectFS(os.DirFS("testdata/" + tt.dir))
+		assert.Nil(t, err, tt.dir)
+		assert.Equal(t, tt.revision, b.Revision, tt.dir)
+		assert.Equal(t, tt.typ, b.Type, tt.dir)
+		assert.Equal(t, tt.serial, b.Serial, tt.dir)
+		assert.Equal(t, tt.supported, b.Supported(), tt.dir)
+		hw := b.HwDesc()
+		assert.Equal(t, tt.hwType, hw.Type, tt.dir)
+		assert.Equal(t, tt.revision, hw.Version, tt.dir)
+	}
+
+	b, err := DetectFS(os.DirFS("testdata/pi4"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0xfe000000), b.HwDesc().PeriphBase)
+	assert.Equal(t, 4096, b.Memory)
+
+	_, err = DetectFS(os.DirFS("testdata/x86"))
+	assert.Equal(t, ErrNotRaspberryPi, err)
+	_, err = DetectFS(os.DirFS("testdata/missing"))
+	assert.Equal(t, ErrNotRaspberryPi, err)
+}
+
+func TestParseCPUInfo(t *testing.T) {
+	_, _, err := ParseCPUInfo(strings.NewReader("Revision\t: xyz\n"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package board
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Paths of the revision code, relative to the root of the file system.
+const (
+	DeviceTreeRevision = "proc/device-tree/system/linux,revision"
+	CPUInfo            = "proc/cpuinfo"
+)
+
+// ErrNotRaspberryPi is returned when no revision code is found.
+var ErrNotRaspberryPi = errors.New("not a Raspberry Pi: no revision code found")
+
+// Detect detects the board from the root file system.
+func Detect() (Board, error) {
+	return DetectFS(os.DirFS("/"))
+}
+
+// DetectFS detects the board from a file system with the layout of the root
+// file system. The revision code is read from the device tree, or else from
+// /proc/cpuinfo, which also gives the serial number.
+func DetectFS(fsys fs.FS) (Board, error) {
+	revision, serial, err := readCPUInfo(fsys)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Board{}, err
+	}
+	if data, err := fs.ReadFile(fsys, DeviceTreeRevision); err == nil && len(data) == 4 {
+		revision = binary.BigEndian.Uint32(data)
+	}
+	if revision == 0 {
+		return Board{}, ErrNotRaspberryPi
+	}
+	b, err := Decode(revision)
+	if err != nil {
+		return Board{}, err
+	}
+	b.Serial = serial
+	return b, nil
+}
+
+// readCPUInfo returns the revision code and the serial number of
+// /proc/cpuinfo. The revision code is 0 if it is missing.
+func readCPUInfo(fsys fs.FS) (revision uint32, serial string, err error) {
+	f, err := fsys.Open(CPUInfo)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	return ParseCPUInfo(f)
+}
+
+// ParseCPUInfo returns the revision code and the serial number found in the
+// content of /proc/cpuinfo. The revision code is 0 if it is missing.
+func ParseCPUInfo(r io.Reader) (revision uint32, serial string, err error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Revision":
+			v, err := strconv.ParseUint(strings.TrimSpace(value), 16, 32)
+			if err != nil {
+				return 0, "", fmt.Errorf("invalid revision code %q", strings.TrimSpace(value))
+			}
+			revision = uint32(v)
+		case "Serial":
+			serial = strings.TrimSpace(value)
+		}
+	}
+	return revision, serial, s.Err()
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package board
+
+import (
+	"errors"
+	"fmt"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+)
+
+// Driver is the peripheral used by the C library to generate the signal of a
+// channel.
+type Driver int
+
+// Drivers of the C library.
+const (
+	// NoDriver is returned for the pins that can not drive LEDs
+	NoDriver Driver = iota
+	// PWM0 is the channel 0 of the PWM
+	PWM0
+	// PWM1 is the channel 1 of the PWM
+	PWM1
+	// PCM is the PCM (I2S) data output, only for channel 0
+	PCM
+	// SPI is the MOSI of SPI0, only for channel 0
+	SPI
+)
+
+// String returns the name of the driver.
+func (d Driver) String() string {
+	switch d {
+	case PWM0:
+		return "PWM0"
+	case PWM1:
+		return "PWM1"
+	case PCM:
+		return "PCM"
+	case SPI:
+		return "SPI"
+	}
+	return "none"
+}
+
+// drivers are the GPIO pins that the C library accepts, by driver.
+// nolint: gochecknoglobals
+var drivers = map[int]Driver{
+	12: PWM0, 18: PWM0, 40: PWM0, 52: PWM0,
+	13: PWM1, 19: PWM1, 41: PWM1, 45: PWM1, 53: PWM1,
+	21: PCM, 31: PCM,
+	10: SPI, 38: SPI,
+}
+
+// Highest GPIO pin available to the user, on the header of the boards or on
+// the connector of the compute modules.
+const (
+	maxHeaderPin        = 27
+	maxComputeModulePin = 45
+)
+
+// spi1Pins are the pins of SPI1, enabled by the spi1 overlays.
+// nolint: gochecknoglobals
+var spi1Pins = map[int]bool{16: true, 17: true, 18: true, 19: true, 20: true, 21: true}
+
+// DriverOf returns the driver of a GPIO pin, or NoDriver if the C library can
+// not drive LEDs with it.
+func DriverOf(pin int) Driver {
+	return drivers[pin]
+}
+
+// Available reports whether a GPIO pin can be wired on the board.
+func (b Board) Available(pin int) bool {
+	last := maxHeaderPin
+	switch b.Type {
+	case TypeCM1, TypeCM3, TypeCM3Plus, TypeCM4, TypeCM4S:
+		last = maxComputeModulePin
+	}
+	return pin >= 0 && pin <= last
+}
+
+// ChannelCheck is the result of the check of a channel.
+type ChannelCheck struct {
+	// Channel is the channel number
+	Channel int
+	// GpioPin is the GPIO pin of the channel
+	GpioPin int
+	// Driver is the driver of the pin
+	Driver Driver
+	// Clashes are the features of the system that can not be used at the
+	// same time as the driver, with the way to disable them
+	Clashes []string
+}
+
+// Check checks the GPIO pins of the used channels of the options, before
+// ws2811.WS2811.Init fails with "Selected GPIO not possible". It returns the
+// driver and the clashes of each used channel, and an error listing all the
+// problems found.
+func (b Board) Check(opt *ws2811.Option) ([]ChannelCheck, error) {
+	if !b.Supported() {
+		return nil, fmt.Errorf("the %s is not supported by the C library", b.Model)
+	}
+	var checks []ChannelCheck
+	var errs []error
+	for i, ch := range opt.Channels {
+		if ch.GpioPin == 0 || ch.LedCount == 0 {
+			continue
+		}
+		c := ChannelCheck{Channel: i, GpioPin: ch.GpioPin, Driver: DriverOf(ch.GpioPin)}
+		switch {
+		case !b.Available(ch.GpioPin):
+			errs = append(errs, fmt.Errorf("channel %d: GPIO %d is not available on the %s", i, ch.GpioPin, b.Model))
+		case c.Driver == NoDriver:
+			errs = append(errs, fmt.Errorf("channel %d: GPIO %d can not drive LEDs, use GPIO 12 or 18 (PWM0), 13 or 19 (PWM1), 21 (PCM) or 10 (SPI)", i, ch.GpioPin))
+		case i == 0 && c.Driver == PWM1:
+			errs = append(errs, fmt.Errorf("channel 0: GPIO %d is on PWM1, which is channel 1", ch.GpioPin))
+		case i == 1 && c.Driver != PWM1:
+			errs = append(errs, fmt.Errorf("channel 1: GPIO %d is on %v, but channel 1 can only use PWM1 (GPIO 13 or 19)", ch.GpioPin, c.Driver))
+		}
+		c.Clashes = b.clashes(c)
+		checks = append(checks, c)
+	}
+
+	if len(checks) == 2 {
+		switch {
+		case checks[0].GpioPin == checks[1].GpioPin:
+			errs = append(errs, fmt.Errorf("both channels use GPIO %d", checks[0].GpioPin))
+		case checks[0].Driver == PCM || checks[0].Driver == SPI:
+			errs = append(errs, fmt.Errorf("channel 1 can not be used when channel 0 is on %v, only PWM drives two channels", checks[0].Driver))
+		}
+	}
+	return checks, errors.Join(errs...)
+}
+
+// clashes returns the clashes of the driver of a channel.
+func (b Board) clashes(c ChannelCheck) []string {
+	var clashes []string
+	switch c.Driver {
+	case PWM0, PWM1:
+		clashes = append(clashes, "analog audio uses the PWM, disable it with dtparam=audio=off")
+	case PCM:
+		clashes = append(clashes, "I2S audio uses the PCM, disable I2S sound cards and dtparam=i2s")
+	case SPI:
+		clashes = append(clashes, "SPI0 must be enabled with dtparam=spi=on, and its other devices share GPIO 10")
+		if b.Processor == BCM2837 || b.Processor == BCM2711 {
+			clashes = append(clashes, "the SPI clock follows the core clock, fix it with core_freq=250 (core_freq_min=500 on Pi 4)")
+		}
+	}
+	if spi1Pins[c.GpioPin] && c.Driver != NoDriver {
+		clashes = append(clashes, "SPI1 uses GPIO 16 to 21, do not load the spi1 overlays")
+	}
+	return clashes
+}
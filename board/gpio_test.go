@@ -0,0 +1,94 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package board
+
+import (
+	"testing"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDriverOf(t *testing.T) {
+	for pin, want := range map[int]Driver{
+		12: PWM0, 18: PWM0, 40: PWM0, 52: PWM0,
+		13: PWM1, 19: PWM1, 41: PWM1, 45: PWM1, 53: PWM1,
+		21: PCM, 31: PCM,
+		10: SPI, 38: SPI,
+		4: NoDriver, 20: NoDriver,
+	} {
+		assert.Equal(t, want, DriverOf(pin), pin)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	pi4, err := Decode(0xc03114)
+	assert.Nil(t, err)
+	cm4, err := Decode(0xb03140)
+	assert.Nil(t, err)
+	pi5, err := Decode(0xc04170)
+	assert.Nil(t, err)
+
+	option := func(pins ...int) *ws2811.Option {
+		opt := &ws2811.Option{}
+		for _, pin := range pins {
+			opt.Channels = append(opt.Channels, ws2811.ChannelOption{GpioPin: pin, LedCount: 10})
+		}
+		return opt
+	}
+
+	checks, err := pi4.Check(option(18, 13))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(checks))
+	assert.Equal(t, PWM0, checks[0].Driver)
+	assert.Equal(t, PWM1, checks[1].Driver)
+	assert.Contains(t, checks[0].Clashes[0], "audio")
+	assert.Contains(t, checks[0].Clashes[1], "SPI1")
+	assert.Equal(t, 1, len(checks[1].Clashes))
+
+	checks, err = pi4.Check(option(10))
+	assert.Nil(t, err)
+	assert.Equal(t, SPI, checks[0].Driver)
+	assert.Contains(t, checks[0].Clashes[1], "core_freq")
+
+	checks, err = pi4.Check(option(21, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(checks))
+	assert.Equal(t, PCM, checks[0].Driver)
+
+	_, err = cm4.Check(option(40, 41))
+	assert.Nil(t, err)
+
+	for _, tt := range []struct {
+		pins []int
+		want string
+	}{
+		{[]int{40}, "channel 0: GPIO 40 is not available"},
+		{[]int{4}, "channel 0: GPIO 4 can not drive LEDs"},
+		{[]int{13}, "channel 0: GPIO 13 is on PWM1"},
+		{[]int{18, 12}, "channel 1: GPIO 12 is on PWM0"},
+		{[]int{19, 19}, "both channels use GPIO 19"},
+		{[]int{21, 13}, "channel 1 can not be used when channel 0 is on PCM"},
+		{[]int{10, 19}, "channel 1 can not be used when channel 0 is on SPI"},
+	} {
+		_, err := pi4.Check(option(tt.pins...))
+		if assert.NotNil(t, err, tt.pins) {
+			assert.Contains(t, err.Error(), tt.want)
+		}
+	}
+
+	_, err = pi5.Check(option(18))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,196 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/board"
+	"github.com/rpi-ws281x/rpi-ws281x-go/effects"
+	"github.com/rpi-ws281x/rpi-ws281x-go/timeline"
+)
+
+// colors are the color names accepted by parseColor.
+// nolint: gochecknoglobals
+var colors = map[string]uint32{
+	"black":   0x000000,
+	"off":     0x000000,
+	"red":     0xff0000,
+	"green":   0x00ff00,
+	"blue":    0x0000ff,
+	"white":   0xffffff,
+	"yellow":  0xffff00,
+	"cyan":    0x00ffff,
+	"magenta": 0xff00ff,
+	"orange":  0xff8000,
+	"purple":  0x8000ff,
+	"warm":    0xff000000, // the white LED of RGBW strips
+}
+
+// parseColor parses a color name, "#RRGGBB" or "#RRGGBBWW".
+func parseColor(s string) (uint32, error) {
+	if c, ok := colors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	c, err := timeline.ParseColor(s)
+	return uint32(c), err
+}
+
+func detect(e *env, args []string) error {
+	hw := ws2811.HwDetect()
+	fmt.Fprintf(e.out, "Hardware Type    : %d\n", hw.Type)
+	fmt.Fprintf(e.out, "Hardware Version : 0x%08X\n", hw.Version)
+	fmt.Fprintf(e.out, "Periph base      : 0x%08X\n", hw.PeriphBase)
+	fmt.Fprintf(e.out, "Video core base  : 0x%08X\n", hw.VideocoreBase)
+	fmt.Fprintf(e.out, "Description      : %v\n", hw.Desc)
+
+	b, err := board.Detect()
+	if err != nil {
+		fmt.Fprintf(e.out, "Board            : %v\n", err)
+		return nil
+	}
+	fmt.Fprintf(e.out, "Board            : %v\n", b)
+	fmt.Fprintf(e.out, "Revision code    : %06x\n", b.Revision)
+	if b.Serial != "" {
+		fmt.Fprintf(e.out, "Serial           : %s\n", b.Serial)
+	}
+	fmt.Fprintf(e.out, "Supported        : %v\n", b.Supported())
+
+	checks, err := b.Check(e.opt)
+	for _, c := range checks {
+		fmt.Fprintf(e.out, "Channel %d        : GPIO %d, %v\n", c.Channel, c.GpioPin, c.Driver)
+		for _, clash := range c.Clashes {
+			fmt.Fprintf(e.out, "                   %s\n", clash)
+		}
+	}
+	return err
+}
+
+func show(e *env, color uint32) error {
+	if err := e.dev.Wait(); err != nil {
+		return err
+	}
+	effects.Fill(e.leds(), color)
+	return e.dev.Render()
+}
+
+func fill(e *env, args []string) error {
+	color, err := parseColor(args[0])
+	if err != nil {
+		return err
+	}
+	return show(e, color)
+}
+
+func off(e *env, args []string) error {
+	return show(e, 0)
+}
+
+func test(e *env, args []string) error {
+	delay := e.delay
+	if delay == 0 {
+		delay = time.Second
+	}
+	steps := []struct {
+		name  string
+		color uint32
+	}{
+		{"red", 0xff0000},
+		{"green", 0x00ff00},
+		{"blue", 0x0000ff},
+		{"white", 0xffffff},
+	}
+	if ws2811.StripeComponents(e.opt.Channels[e.channel].StripeType) == 4 {
+		steps[3].color = 0xff000000
+	}
+	for _, s := range steps {
+		fmt.Fprintf(e.out, "all the LEDs should be %s\n", strings.ToUpper(s.name))
+		if err := show(e, s.color); err != nil {
+			return err
+		}
+		if err := e.sleep(delay); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(e.out, "if the colors were wrong, try another strip type")
+	return show(e, 0)
+}
+
+// count lights the LEDs one by one. Every 10th LED stays red and every 100th
+// stays blue, which makes it easier to count them.
+func count(e *env, args []string) error {
+	delay := e.delay
+	if delay == 0 {
+		delay = 200 * time.Millisecond
+	}
+	leds := e.leds()
+	for i := range leds {
+		if err := e.dev.Wait(); err != nil {
+			return err
+		}
+		if i > 0 {
+			leds[i-1] = marker(i - 1)
+		}
+		leds[i] = 0xffffff
+		if err := e.dev.Render(); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.out, "\rLED %d", i+1)
+		if err := e.sleep(delay); err != nil {
+			fmt.Fprintln(e.out)
+			return err
+		}
+	}
+	fmt.Fprintln(e.out)
+	return nil
+}
+
+func marker(i int) uint32 {
+	switch {
+	case (i+1)%100 == 0:
+		return 0x0000ff
+	case (i+1)%10 == 0:
+		return 0xff0000
+	}
+	return 0
+}
+
+func effect(e *env, args []string) error {
+	eff, err := effects.New(args[0])
+	if err != nil {
+		return fmt.Errorf("%v (available: %s)", err, strings.Join(effects.Names(), ", "))
+	}
+	ticker := time.NewTicker(time.Second / 50)
+	defer ticker.Stop()
+	start := time.Now()
+	defer show(e, 0) // nolint: errcheck
+	for {
+		if err := e.dev.Wait(); err != nil {
+			return err
+		}
+		eff.Render(e.leds(), time.Since(start))
+		if err := e.dev.Render(); err != nil {
+			return err
+		}
+		select {
+		case <-ticker.C:
+		case <-e.ctx.Done():
+			return e.ctx.Err()
+		}
+	}
+}
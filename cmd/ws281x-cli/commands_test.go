@@ -0,0 +1,108 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// device is a simulated device that records the frames of channel 1.
+type device struct {
+	*ws2811.WS2811
+	frames [][]uint32
+}
+
+func (d *device) Render() error {
+	d.frames = append(d.frames, append([]uint32(nil), d.Leds(1)...))
+	return nil
+}
+
+func newEnv(t *testing.T, ledCount int, stripeType int) (*env, *device, *bytes.Buffer) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{}, {LedCount: ledCount, StripeType: stripeType}}}
+	ws, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	dev := &device{WS2811: ws}
+	var out bytes.Buffer
+	return &env{ctx: context.Background(), dev: dev, opt: &opt, channel: 1, delay: time.Millisecond, out: &out}, dev, &out
+}
+
+func TestParseColor(t *testing.T) {
+	for s, want := range map[string]uint32{
+		"red":       0xff0000,
+		"WHITE":     0xffffff,
+		"#102030":   0x102030,
+		"10203040":  0x40102030,
+		"#000000ff": 0xff000000,
+	} {
+		c, err := parseColor(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, want, c, s)
+	}
+	for _, s := range []string{"", "#12345", "#1234567", "nope"} {
+		_, err := parseColor(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestFillOff(t *testing.T) {
+	e, dev, _ := newEnv(t, 3, ws2811.WS2812Strip)
+	assert.Nil(t, fill(e, []string{"#010203"}))
+	assert.Nil(t, off(e, nil))
+	assert.Equal(t, [][]uint32{{0x010203, 0x010203, 0x010203}, {0, 0, 0}}, dev.frames)
+	assert.NotNil(t, fill(e, []string{"nope"}))
+}
+
+func TestTest(t *testing.T) {
+	e, dev, out := newEnv(t, 1, ws2811.WS2812Strip)
+	assert.Nil(t, test(e, nil))
+	assert.Equal(t, [][]uint32{{0xff0000}, {0x00ff00}, {0x0000ff}, {0xffffff}, {0}}, dev.frames)
+	assert.True(t, strings.HasPrefix(out.String(), "all the LEDs should be RED\n"))
+
+	// the white step lights the white LED of RGBW strips
+	e, dev, _ = newEnv(t, 1, ws2811.SK6812StripGRBW)
+	assert.Nil(t, test(e, nil))
+	assert.Equal(t, []uint32{0xff000000}, dev.frames[3])
+}
+
+func TestCount(t *testing.T) {
+	e, dev, out := newEnv(t, 12, ws2811.WS2812Strip)
+	assert.Nil(t, count(e, nil))
+	assert.Equal(t, 12, len(dev.frames))
+	last := dev.frames[11]
+	assert.Equal(t, uint32(0xff0000), last[9])
+	assert.Equal(t, uint32(0), last[10])
+	assert.Equal(t, uint32(0xffffff), last[11])
+	assert.True(t, strings.HasSuffix(out.String(), "\rLED 12\n"))
+}
+
+func TestEffect(t *testing.T) {
+	e, dev, _ := newEnv(t, 4, ws2811.WS2812Strip)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	e.ctx = ctx
+	assert.Equal(t, context.DeadlineExceeded, effect(e, []string{"rainbow"}))
+	assert.Greater(t, len(dev.frames), 1)
+	// the LEDs are turned off at the end
+	assert.Equal(t, []uint32{0, 0, 0, 0}, dev.frames[len(dev.frames)-1])
+	assert.NotNil(t, effect(e, []string{"nope"}))
+}
@@ -0,0 +1,204 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command ws281x-cli tests LED strips from the command line:
+//
+//	ws281x-cli detect                 show the hardware
+//	ws281x-cli fill [flags] <color>   fill the strip with a color
+//	ws281x-cli test [flags]           light red, green, blue and white in turn
+//	ws281x-cli count [flags]          light the LEDs one by one
+//	ws281x-cli effect [flags] <name>  run an effect until interrupted
+//	ws281x-cli off [flags]            turn the LEDs off
+//	ws281x-cli wizard [flags]         find the strip type of the strip
+//
+// All the commands accept the flags of the device (GPIO pin, channel, LED
+// count, strip type, frequency, DMA and brightness); run a command with -h to
+// list them.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/board"
+	"github.com/rpi-ws281x/rpi-ws281x-go/terminal"
+)
+
+// env is the environment of a command.
+type env struct {
+	ctx     context.Context
+	dev     ws2811.Device
+	opt     *ws2811.Option
+	channel int
+	delay   time.Duration
+	in      io.Reader
+	out     io.Writer
+	// open creates and initializes a device
+	open func(opt *ws2811.Option) (ws2811.Device, error)
+}
+
+// leds returns the LEDs of the channel.
+func (e *env) leds() []uint32 {
+	return e.dev.Leds(e.channel)
+}
+
+// sleep waits for the delay, or returns an error if the context is done.
+func (e *env) sleep(d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-e.ctx.Done():
+		return e.ctx.Err()
+	}
+}
+
+type command struct {
+	args  string
+	help  string
+	nargs int
+	// device is false for commands that do not use the device
+	device bool
+	run    func(e *env, args []string) error
+}
+
+// nolint: gochecknoglobals
+var commands = map[string]command{
+	"detect": {help: "show the hardware", run: detect},
+	"fill":   {args: "<color>", help: "fill the LEDs with a color (name, #RRGGBB or #RRGGBBWW)", nargs: 1, device: true, run: fill},
+	"test":   {help: "light red, green, blue and white in turn to check the strip type", device: true, run: test},
+	"count":  {help: "light the LEDs one by one to find the length of the strip", device: true, run: count},
+	"effect": {args: "<name>", help: "run an effect until interrupted", nargs: 1, device: true, run: effect},
+	"off":    {help: "turn the LEDs off", device: true, run: off},
+	"wizard": {help: "find the strip type by answering questions about test patterns", run: wizard},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags] [args]\n\ncommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := commands[name]
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name+" "+c.args, c.help)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	gpioPin := fs.Int("gpio-pin", ws2811.DefaultGpioPin, "GPIO pin")
+	channel := fs.Int("channel", 0, "channel of the GPIO pin (0 or 1)")
+	ledCount := fs.Int("led-count", ws2811.DefaultLedCount, "number of LEDs")
+	stripType := fs.String("strip-type", "ws2812", "strip type: order of the components (e.g. grb, grbw), LED type (ws2812, sk6812w) or StripeType value")
+	brightness := fs.Int("brightness", ws2811.DefaultBrightness, "brightness (0-255)")
+	freq := fs.Int("freq", ws2811.TargetFreq, "output frequency")
+	dmaNum := fs.Int("dma", ws2811.DefaultDmaNum, "DMA number")
+	invert := fs.Bool("invert", false, "invert the output signal")
+	delay := fs.Duration("delay", 0, "delay between the steps of test and count (default 1s and 200ms)")
+	term := fs.Bool("terminal", false, "render to the terminal instead of the LEDs")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s %s [flags] %s\n\n%s\n\nflags:\n", os.Args[0], name, cmd.args, cmd.help)
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[2:]) // nolint: errcheck
+	if fs.NArg() != cmd.nargs {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if *channel < 0 || *channel >= ws2811.RpiPwmChannels {
+		fatal(fmt.Errorf("invalid channel %d", *channel))
+	}
+	st, err := ws2811.ParseStripeType(*stripType)
+	if err != nil {
+		fatal(err)
+	}
+	opt := ws2811.DefaultOptions
+	opt.Frequency = *freq
+	opt.DmaNum = *dmaNum
+	opt.Channels = make([]ws2811.ChannelOption, *channel+1)
+	opt.Channels[*channel] = ws2811.ChannelOption{
+		GpioPin:    *gpioPin,
+		LedCount:   *ledCount,
+		StripeType: st,
+		Brightness: *brightness,
+		Invert:     *invert,
+		Gamma:      ws2811.DefaultOptions.Channels[0].Gamma,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	e := &env{ctx: ctx, opt: &opt, channel: *channel, delay: *delay, in: os.Stdin, out: os.Stdout}
+	e.open = func(opt *ws2811.Option) (ws2811.Device, error) {
+		var dev ws2811.Device
+		if *term {
+			dev = terminal.MakeTerminal(opt, terminal.Config{})
+		} else {
+			// on a Raspberry Pi, fail with a useful message rather than
+			// "Selected GPIO not possible"
+			if b, err := board.Detect(); err == nil {
+				if _, err := b.Check(opt); err != nil {
+					return nil, err
+				}
+			}
+			ws, err := ws2811.MakeWS2811(opt)
+			if err != nil {
+				return nil, err
+			}
+			dev = ws
+		}
+		return dev, dev.Init()
+	}
+	if cmd.device {
+		if e.dev, err = e.open(&opt); err != nil {
+			fatal(err)
+		}
+	}
+	err = cmd.run(e, fs.Args())
+	if e.dev != nil {
+		e.dev.Fini()
+	}
+	if errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "ws281x-cli:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+)
+
+// Components of a color and their shift in an LED value (0xWWRRGGBB).
+// nolint: gochecknoglobals
+var components = []struct {
+	key   string
+	name  string
+	shift int
+}{
+	{"r", "red", 16},
+	{"g", "green", 8},
+	{"b", "blue", 0},
+	{"w", "white", 24},
+}
+
+// Raw strip types, which send the components of the LED values in the order
+// R, G, B (and W) on the wire.
+const (
+	rawRGB  = ws2811.WS2811StripRGB
+	rawRGBW = ws2811.SK6812StripRGBW
+)
+
+// wireByte returns the LED value that only sets byte i on the wire with a raw
+// strip type.
+func wireByte(i int) uint32 {
+	return 0xff << uint(components[i].shift)
+}
+
+// stripeType returns the strip type that sends each component in the byte
+// where the strip expects it. order[i] is the index in components of the
+// color seen for wire byte i.
+func stripeType(order []int) int {
+	shift := func(i int) int { return components[order[i]].shift }
+	t := shift(0)<<16 | shift(1)<<8 | shift(2)
+	if len(order) == 4 {
+		t |= shift(3) << 24
+	}
+	return t
+}
+
+// wizard finds the strip type by lighting test patterns and asking what they
+// look like.
+func wizard(e *env, args []string) error {
+	in := bufio.NewScanner(e.in)
+	ask := func(question string, answers ...string) (string, error) {
+		for {
+			fmt.Fprintf(e.out, "%s [%s] ", question, strings.Join(answers, "/"))
+			if !in.Scan() {
+				if err := in.Err(); err != nil {
+					return "", err
+				}
+				return "", io.ErrUnexpectedEOF
+			}
+			a := strings.ToLower(strings.TrimSpace(in.Text()))
+			for _, v := range answers {
+				if a != "" && a[0] == v[0] {
+					return v, nil
+				}
+			}
+		}
+	}
+
+	// With 3 bytes per LED, the first byte of 4 LEDs lands on different
+	// components of an RGBW strip, which expects 4 bytes per LED.
+	fmt.Fprintln(e.out, "Lighting the first 4 LEDs...")
+	if err := e.light(rawRGB, 4, wireByte(0)); err != nil {
+		return err
+	}
+	a, err := ask("Do the first 4 LEDs show the same color?", "yes", "no")
+	if err != nil {
+		return err
+	}
+	n, raw := 3, rawRGB
+	if a == "no" {
+		fmt.Fprintln(e.out, "The strip has 4 components per LED: it is an RGBW strip.")
+		n, raw = 4, rawRGBW
+	}
+
+	var order []int
+	seen := make(map[int]bool)
+	for i := 0; i < n; i++ {
+		if err := e.light(raw, len(e.leds()), wireByte(i)); err != nil {
+			return err
+		}
+		answers := []string{"red", "green", "blue"}
+		if n == 4 {
+			answers = append(answers, "white")
+		}
+		a, err := ask(fmt.Sprintf("Step %d/%d: what color do the LEDs show?", i+1, n), answers...)
+		if err != nil {
+			return err
+		}
+		c := 0
+		for c < len(components) && components[c].name != a {
+			c++
+		}
+		if seen[c] {
+			return errors.New("the same color was seen twice, please run the wizard again")
+		}
+		seen[c] = true
+		order = append(order, c)
+	}
+	if err := e.light(raw, len(e.leds()), 0); err != nil {
+		return err
+	}
+
+	t := stripeType(order)
+	if ws2811.StripeComponents(t) != n {
+		// the library only sends 4 bytes per LED when the white shift is 16 or 24
+		return errors.New("this order of components cannot be expressed as a StripeType")
+	}
+	name := ws2811.StripeTypeName(t)
+	if strings.HasPrefix(name, "0x") {
+		name = "no constant"
+	}
+	fmt.Fprintf(e.out, "\nStripeType: 0x%08X (%s)\n", t, name)
+	fmt.Fprintf(e.out, "Shifts: WShift=%d RShift=%d GShift=%d BShift=%d\n", t>>24&0xff, t>>16&0xff, t>>8&0xff, t&0xff)
+	fmt.Fprintf(e.out, "Check it with: ws281x-cli test -strip-type %s\n", ws2811.StripeTypeName(t))
+	return nil
+}
+
+// light opens the device with a strip type if needed and sets the first count
+// LEDs to a value.
+func (e *env) light(stripeType int, count int, value uint32) error {
+	ch := &e.opt.Channels[e.channel]
+	if e.dev == nil || ch.StripeType != stripeType {
+		if e.dev != nil {
+			e.dev.Fini()
+		}
+		ch.StripeType = stripeType
+		dev, err := e.open(e.opt)
+		if err != nil {
+			e.dev = nil
+			return err
+		}
+		e.dev = dev
+	}
+	if err := e.dev.Wait(); err != nil {
+		return err
+	}
+	leds := e.leds()
+	for i := range leds {
+		leds[i] = 0
+		if i < count {
+			leds[i] = value
+		}
+	}
+	return e.dev.Render()
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// strip models a physical strip that expects the components in a given order
+// on the wire, e.g. "GRBW".
+type strip struct {
+	*ws2811.WS2811
+	stripeType int
+	order      string
+	seen       []string // colors shown by the LEDs
+}
+
+func (s *strip) Render() error {
+	// the bytes sent by the C library for the strip type
+	var wire []byte
+	n := ws2811.StripeComponents(s.stripeType)
+	for _, led := range s.Leds(1) {
+		for _, field := range []uint{16, 8, 0, 24}[:n] {
+			shift := uint(s.stripeType>>field) & 0xff
+			wire = append(wire, byte(led>>shift))
+		}
+	}
+	// the colors shown by the strip
+	names := map[byte]string{'R': "red", 'G': "green", 'B': "blue", 'W': "white"}
+	s.seen = nil
+	for i := 0; i+len(s.order) <= len(wire); i += len(s.order) {
+		var on []string
+		for k := range s.order {
+			if wire[i+k] != 0 {
+				on = append(on, names[s.order[k]])
+			}
+		}
+		s.seen = append(s.seen, strings.Join(on, "+"))
+	}
+	return nil
+}
+
+// user answers the questions of the wizard by looking at the strip.
+type user struct {
+	out     *bytes.Buffer
+	strip   **strip
+	pending []byte
+	reads   int
+}
+
+func (u *user) Read(p []byte) (int, error) {
+	if len(u.pending) == 0 {
+		if u.reads++; u.reads > 10 {
+			return 0, io.EOF
+		}
+		s := *u.strip
+		if strings.HasSuffix(u.out.String(), "[yes/no] ") {
+			same := s.seen[0] != "" && s.seen[0] == s.seen[1] && s.seen[1] == s.seen[2] && s.seen[2] == s.seen[3]
+			u.pending = []byte("no\n")
+			if same {
+				u.pending = []byte("yes\n")
+			}
+		} else {
+			u.pending = []byte(s.seen[0] + "\n")
+		}
+	}
+	n := copy(p, u.pending)
+	u.pending = u.pending[n:]
+	return n, nil
+}
+
+func runWizard(t *testing.T, order string) (string, error) {
+	var out bytes.Buffer
+	var s *strip
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{}, {LedCount: 8}}}
+	e := &env{ctx: context.Background(), opt: &opt, channel: 1, out: &out}
+	e.in = &user{out: &out, strip: &s}
+	e.open = func(opt *ws2811.Option) (ws2811.Device, error) {
+		ws, err := ws2811.MakeWS2811(opt)
+		assert.Nil(t, err)
+		s = &strip{WS2811: ws, stripeType: opt.Channels[1].StripeType, order: order}
+		return s, ws.Init()
+	}
+	err := wizard(e, nil)
+	return out.String(), err
+}
+
+func TestWizard(t *testing.T) {
+	for order, want := range map[string]string{
+		"RGB":  "StripeType: 0x00100800 (WS2811StripRGB)",
+		"GRB":  "StripeType: 0x00081000 (WS2811StripGRB)",
+		"BRG":  "StripeType: 0x00001008 (WS2811StripBRG)",
+		"GRBW": "StripeType: 0x18081000 (SK6812StripGRBW)",
+		"RGBW": "StripeType: 0x18100800 (SK6812StripRGBW)",
+		"BGRW": "StripeType: 0x18000810 (SK6812StripBGRW)",
+		"WGBR": "StripeType: 0x10180800 (no constant)",
+		"WRGB": "cannot be expressed as a StripeType",
+	} {
+		out, err := runWizard(t, order)
+		if err != nil {
+			out += err.Error()
+		}
+		assert.Contains(t, out, want, order)
+		assert.Equal(t, len(order) == 4, strings.Contains(out, "RGBW strip"), order)
+	}
+}
+
+func TestWizardInconsistent(t *testing.T) {
+	var out bytes.Buffer
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{}, {LedCount: 8}}}
+	e := &env{ctx: context.Background(), opt: &opt, channel: 1, out: &out, in: strings.NewReader("y\nred\nmaybe\nred\n")}
+	e.open = func(opt *ws2811.Option) (ws2811.Device, error) {
+		ws, err := ws2811.MakeWS2811(opt)
+		assert.Nil(t, err)
+		return ws, ws.Init()
+	}
+	assert.NotNil(t, wizard(e, nil))
+	// invalid answers are asked again
+	assert.Equal(t, 2, strings.Count(out.String(), "Step 2/3"))
+
+	e.dev = nil
+	e.in = strings.NewReader("y\n")
+	assert.NotNil(t, wizard(e, nil))
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command ws281x-export records an effect and writes it as an animated GIF
+// (.gif), an animated PNG (.png) or a directory of PNG frames (any other
+// output name).
+//
+//	ws281x-export -effect rainbow -layout 16x16s -duration 5s -o rainbow.gif
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rpi-ws281x/rpi-ws281x-go/effects"
+	"github.com/rpi-ws281x/rpi-ws281x-go/export"
+	"github.com/rpi-ws281x/rpi-ws281x-go/layout"
+)
+
+func main() {
+	effect := flag.String("effect", "rainbow", "effect: "+strings.Join(effects.Names(), ", "))
+	ledCount := flag.Int("led-count", 16, "number of LEDs of a strip")
+	layoutName := flag.String("layout", "strip", "layout of the LEDs: strip or <width>x<height>[s]")
+	fps := flag.Int("fps", export.DefaultFPS, "frames per second")
+	scale := flag.Int("scale", export.DefaultScale, "size of an LED in pixels")
+	duration := flag.Duration("duration", 5*time.Second, "duration of the recording")
+	output := flag.String("o", "", "output file or directory")
+	flag.Parse()
+	if *output == "" {
+		fmt.Fprintln(os.Stderr, "missing output (-o)")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	l, err := layout.Parse(*layoutName, *ledCount)
+	if err != nil {
+		log.Fatal(err)
+	}
+	e, err := effects.New(*effect)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	exp := export.MakeExporter(l.Len(), export.Options{Layout: l, Scale: *scale, FPS: *fps})
+	exp.Record(e, *duration)
+
+	switch strings.ToLower(filepath.Ext(*output)) {
+	case ".gif":
+		err = writeFile(*output, exp.WriteGIF)
+	case ".png", ".apng":
+		err = writeFile(*output, exp.WriteAPNG)
+	default:
+		err = exp.WritePNGs(*output)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeFile(name string, write func(w io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command ws281x-remoted drives the LEDs connected to a Raspberry Pi on behalf
+// of remote.Client instances running on other machines.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/remote"
+)
+
+func main() {
+	listen := flag.String("listen", fmt.Sprintf(":%d", remote.DefaultPort), "address to listen on")
+	network := flag.String("network", "tcp", "network: tcp or udp")
+	gpioPin := flag.Int("gpio-pin", ws2811.DefaultGpioPin, "GPIO pin")
+	ledCount := flag.Int("led-count", ws2811.DefaultLedCount, "number of LEDs")
+	brightness := flag.Int("brightness", ws2811.DefaultBrightness, "brightness (0-255)")
+	dmaNum := flag.Int("dma", ws2811.DefaultDmaNum, "DMA number")
+	freq := flag.Int("freq", ws2811.TargetFreq, "output frequency")
+	flag.Parse()
+
+	opt := ws2811.DefaultOptions
+	opt.Frequency = *freq
+	opt.DmaNum = *dmaNum
+	opt.Channels = []ws2811.ChannelOption{opt.Channels[0]}
+	opt.Channels[0].GpioPin = *gpioPin
+	opt.Channels[0].LedCount = *ledCount
+	opt.Channels[0].Brightness = *brightness
+
+	dev, err := ws2811.MakeWS2811(&opt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := dev.Init(); err != nil {
+		log.Fatal(err)
+	}
+	defer dev.Fini()
+
+	s := remote.MakeServer(dev, &opt)
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		s.Close() // nolint: errcheck
+	}()
+
+	log.Printf("listening on %s/%s", *network, *listen)
+	if err := serve(s, *network, *listen); err != nil {
+		log.Print(err)
+	}
+}
+
+func serve(s *remote.Server, network, addr string) error {
+	switch network {
+	case "udp", "udp4", "udp6":
+		conn, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return err
+		}
+		return s.ServePacket(conn)
+	default:
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			return err
+		}
+		return s.Serve(l)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rpi-ws281x/rpi-ws281x-go/controller"
+	"github.com/rpi-ws281x/rpi-ws281x-go/effects"
+	"github.com/rpi-ws281x/rpi-ws281x-go/timeline"
+)
+
+// maxBody limits the size of the request bodies.
+const maxBody = 1 << 20
+
+// api is the REST API of the daemon:
+//
+//	GET    /api/status                      status of the device
+//	GET    /api/effects                     names of the effects
+//	GET    /api/channels/{c}/pixels         colors of the LEDs
+//	PUT    /api/channels/{c}/pixels         set a range: {"start": 0, "colors": ["#ff0000", ...]}
+//	                                        or fill it: {"start": 0, "count": 10, "color": "#ff0000"}
+//	PUT    /api/channels/{c}/pixels/{i}     set a LED: {"color": "#ff0000"}
+//	PUT    /api/channels/{c}/frame          upload a frame: R, G, B bytes per LED
+//	GET    /api/channels/{c}/brightness     {"brightness": 64}
+//	PUT    /api/channels/{c}/brightness     {"brightness": 64}
+//	GET    /api/channels/{c}/effect         {"name": "rainbow"}
+//	PUT    /api/channels/{c}/effect         {"name": "rainbow"}
+//	DELETE /api/channels/{c}/effect         stop the effect
+//
+// Colors are "#RRGGBB", or "#RRGGBBWW" with a white component.
+type api struct {
+	ctrl *controller.Controller
+}
+
+type pixelsRequest struct {
+	Start  int              `json:"start"`
+	Colors []timeline.Color `json:"colors,omitempty"`
+	Count  *int             `json:"count,omitempty"`
+	Color  *timeline.Color  `json:"color,omitempty"`
+}
+
+type brightnessBody struct {
+	Brightness int `json:"brightness"`
+}
+
+type effectBody struct {
+	Name string `json:"name"`
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+func (a *api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api"), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "status":
+		if r.Method == http.MethodGet {
+			writeJSON(w, http.StatusOK, a.ctrl.Status())
+			return
+		}
+	case len(parts) == 1 && parts[0] == "effects":
+		if r.Method == http.MethodGet {
+			writeJSON(w, http.StatusOK, effects.Names())
+			return
+		}
+	case len(parts) >= 3 && parts[0] == "channels":
+		channel, err := strconv.Atoi(parts[1])
+		if err != nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("invalid channel %q", parts[1]))
+			return
+		}
+		if a.serveChannel(w, r, channel, parts[2:]) {
+			return
+		}
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found: %s", r.URL.Path))
+		return
+	}
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+}
+
+// serveChannel serves the resources of a channel. It returns false if the
+// method is not allowed.
+func (a *api) serveChannel(w http.ResponseWriter, r *http.Request, channel int, parts []string) bool {
+	switch {
+	case len(parts) == 1 && parts[0] == "pixels":
+		switch r.Method {
+		case http.MethodGet:
+			pixels, err := a.ctrl.Pixels(channel)
+			reply(w, colors(pixels), err)
+		case http.MethodPut:
+			var req pixelsRequest
+			if !readJSON(w, r, &req) {
+				return true
+			}
+			switch {
+			case req.Color != nil && req.Count == nil:
+				writeError(w, http.StatusBadRequest, fmt.Errorf("missing count"))
+			case req.Color != nil:
+				reply(w, nil, a.ctrl.Fill(channel, req.Start, *req.Count, uint32(*req.Color)))
+			default:
+				reply(w, nil, a.ctrl.SetPixels(channel, req.Start, uint32s(req.Colors)))
+			}
+		default:
+			return false
+		}
+	case len(parts) == 2 && parts[0] == "pixels":
+		index, err := strconv.Atoi(parts[1])
+		if err != nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("invalid LED %q", parts[1]))
+			return true
+		}
+		if r.Method != http.MethodPut {
+			return false
+		}
+		var req pixelsRequest
+		if !readJSON(w, r, &req) {
+			return true
+		}
+		if req.Color == nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("missing color"))
+			return true
+		}
+		reply(w, nil, a.ctrl.SetPixels(channel, index, []uint32{uint32(*req.Color)}))
+	case len(parts) == 1 && parts[0] == "frame":
+		if r.Method != http.MethodPut {
+			return false
+		}
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return true
+		}
+		frame := make([]uint32, len(data)/3)
+		for i := range frame {
+			frame[i] = uint32(data[3*i])<<16 | uint32(data[3*i+1])<<8 | uint32(data[3*i+2])
+		}
+		reply(w, nil, a.ctrl.SetPixels(channel, 0, frame))
+	case len(parts) == 1 && parts[0] == "brightness":
+		switch r.Method {
+		case http.MethodGet:
+			b, err := a.ctrl.Brightness(channel)
+			reply(w, brightnessBody{Brightness: b}, err)
+		case http.MethodPut:
+			var req brightnessBody
+			if readJSON(w, r, &req) {
+				reply(w, nil, a.ctrl.SetBrightness(channel, req.Brightness))
+			}
+		default:
+			return false
+		}
+	case len(parts) == 1 && parts[0] == "effect":
+		switch r.Method {
+		case http.MethodGet:
+			name, err := a.ctrl.Effect(channel)
+			reply(w, effectBody{Name: name}, err)
+		case http.MethodPut:
+			var req effectBody
+			if readJSON(w, r, &req) {
+				reply(w, nil, a.ctrl.StartEffect(channel, req.Name))
+			}
+		case http.MethodDelete:
+			reply(w, nil, a.ctrl.StopEffect(channel))
+		default:
+			return false
+		}
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found: %s", r.URL.Path))
+	}
+	return true
+}
+
+func colors(pixels []uint32) []timeline.Color {
+	c := make([]timeline.Color, len(pixels))
+	for i, p := range pixels {
+		c[i] = timeline.Color(p)
+	}
+	return c
+}
+
+func uint32s(colors []timeline.Color) []uint32 {
+	p := make([]uint32, len(colors))
+	for i, c := range colors {
+		p[i] = uint32(c)
+	}
+	return p
+}
+
+// readJSON decodes the body of the request into v. It writes an error and
+// returns false if the body is invalid.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBody)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+// reply writes v, or the error of the controller if err is not nil. A nil v
+// is a "204 No Content" reply.
+func reply(w http.ResponseWriter, v interface{}, err error) {
+	switch {
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	case v == nil:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusOK, v)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v) // nolint: errcheck
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorBody{Error: err.Error()})
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 4, Brightness: 10}}}
+	dev, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, dev.Init())
+	ctrl := controller.MakeController(dev, &opt, 0)
+	server := httptest.NewServer(&api{ctrl: ctrl})
+	defer server.Close()
+
+	do := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		assert.Nil(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body) // nolint: errcheck
+		return resp.StatusCode, buf.String()
+	}
+
+	code, _ := do("PUT", "/api/channels/0/pixels", `{"start": 1, "colors": ["#ff0000", "#00ff0080"]}`)
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _ = do("PUT", "/api/channels/0/pixels/3", `{"color": "#0000ff"}`)
+	assert.Equal(t, http.StatusNoContent, code)
+	code, body := do("GET", "/api/channels/0/pixels", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `["#000000", "#ff0000", "#00ff0080", "#0000ff"]`, body)
+
+	code, _ = do("PUT", "/api/channels/0/pixels", `{"start": 0, "count": 2, "color": "#010203"}`)
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _ = do("PUT", "/api/channels/0/pixels", `{"start": 3, "count": 2, "color": "#010203"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do("PUT", "/api/channels/0/pixels", `{"start": 0, "count": -1, "color": "#010203"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do("PUT", "/api/channels/0/pixels", `{"start": 0, "color": "#010203"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do("PUT", "/api/channels/0/pixels", `{"start": 1, "count": 9223372036854775807, "color": "#010203"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do("PUT", "/api/channels/0/pixels", `{"start": 9223372036854775807, "colors": ["#010203"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = do("PUT", "/api/channels/0/frame", "\x01\x01\x01\x02\x02\x02")
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Nil(t, ctrl.RenderFrame(time.Now()))
+	assert.Equal(t, []uint32{0x010101, 0x020202, 0x80000000 | 0x00ff00, 0x0000ff}, dev.Leds(0))
+
+	code, _ = do("PUT", "/api/channels/0/brightness", `{"brightness": 300}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do("PUT", "/api/channels/0/brightness", `{"brightness": 200}`)
+	assert.Equal(t, http.StatusNoContent, code)
+	_, body = do("GET", "/api/channels/0/brightness", "")
+	assert.JSONEq(t, `{"brightness": 200}`, body)
+
+	code, _ = do("PUT", "/api/channels/0/effect", `{"name": "nope"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do("PUT", "/api/channels/0/effect", `{"name": "rainbow"}`)
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Nil(t, ctrl.RenderFrame(time.Now()))
+	assert.NotEqual(t, uint32(0x010101), dev.Leds(0)[0])
+
+	code, body = do("GET", "/api/status", "")
+	assert.Equal(t, http.StatusOK, code)
+	var status controller.Status
+	assert.Nil(t, json.Unmarshal([]byte(body), &status))
+	assert.Equal(t, "DUMMY", status.Hardware.Desc)
+	assert.Equal(t, uint64(2), status.Frames)
+	assert.Equal(t, "rainbow", status.Channels[0].Effect)
+	assert.Equal(t, 200, status.Channels[0].Brightness)
+
+	code, _ = do("DELETE", "/api/channels/0/effect", "")
+	assert.Equal(t, http.StatusNoContent, code)
+	_, body = do("GET", "/api/channels/0/effect", "")
+	assert.JSONEq(t, `{"name": ""}`, body)
+
+	code, _ = do("GET", "/api/effects", "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = do("GET", "/api/channels/5/pixels", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do("GET", "/api/nope", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = do("POST", "/api/status", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+}
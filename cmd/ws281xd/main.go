@@ -0,0 +1,166 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command ws281xd is a daemon that owns a WS2811 device and exposes a REST
+// API to control it (see api), the WLED JSON API and a live preview of the
+// LEDs on /preview/. With -mqtt, it also exposes the channels to Home
+// Assistant through MQTT. On other hardware than a Raspberry Pi, it runs with
+// the simulated device; -terminal draws the LEDs in the terminal instead.
+// With -record, the frames are also recorded to a sequence file. With
+// -config, the options of the device are read from a YAML, JSON or TOML file
+// (see config) instead of the flags.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/config"
+	"github.com/rpi-ws281x/rpi-ws281x-go/controller"
+	"github.com/rpi-ws281x/rpi-ws281x-go/homeassistant"
+	"github.com/rpi-ws281x/rpi-ws281x-go/layout"
+	"github.com/rpi-ws281x/rpi-ws281x-go/preview"
+	"github.com/rpi-ws281x/rpi-ws281x-go/sequence"
+	"github.com/rpi-ws281x/rpi-ws281x-go/terminal"
+	"github.com/rpi-ws281x/rpi-ws281x-go/wled"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "HTTP address to listen on")
+	fps := flag.Int("fps", controller.DefaultFPS, "frames per second")
+	gpioPin := flag.Int("gpio-pin", ws2811.DefaultGpioPin, "GPIO pin")
+	ledCount := flag.Int("led-count", ws2811.DefaultLedCount, "number of LEDs")
+	brightness := flag.Int("brightness", ws2811.DefaultBrightness, "brightness (0-255)")
+	dmaNum := flag.Int("dma", ws2811.DefaultDmaNum, "DMA number")
+	freq := flag.Int("freq", ws2811.TargetFreq, "output frequency")
+	configFile := flag.String("config", "", "configuration file of the device, replaces the device flags")
+	name := flag.String("name", "ws281xd", "name of the device in the WLED apps")
+	layoutName := flag.String("layout", "strip", "layout of the LEDs in the previews: strip or <width>x<height>[s]")
+	term := flag.Bool("terminal", false, "render to the terminal instead of the LEDs")
+	record := flag.String("record", "", "record the frames to a sequence file")
+	mqttBroker := flag.String("mqtt", "", "host:port of the MQTT broker for Home Assistant, disabled if empty")
+	mqttUser := flag.String("mqtt-user", "", "MQTT username")
+	mqttPassword := flag.String("mqtt-password", os.Getenv("WS281XD_MQTT_PASSWORD"), "MQTT password")
+	nodeID := flag.String("node-id", homeassistant.DefaultNodeID, "unique ID of the device in Home Assistant")
+	flag.Parse()
+
+	opt := ws2811.DefaultOptions
+	opt.Frequency = *freq
+	opt.DmaNum = *dmaNum
+	opt.Channels = []ws2811.ChannelOption{opt.Channels[0]}
+	opt.Channels[0].GpioPin = *gpioPin
+	opt.Channels[0].LedCount = *ledCount
+	opt.Channels[0].Brightness = *brightness
+	if *configFile != "" {
+		c, err := config.Load(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if opt, err = c.Option(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	l, err := layout.Parse(*layoutName, opt.Channels[0].LedCount)
+	if err != nil {
+		log.Fatal(err)
+	}
+	layouts := map[int]layout.Layout{0: l}
+
+	var dev ws2811.Device
+	if *term {
+		dev = terminal.MakeTerminal(&opt, terminal.Config{Layouts: layouts, HalfBlocks: l.Height > 1})
+	} else if dev, err = ws2811.MakeWS2811(&opt); err != nil {
+		log.Fatal(err)
+	}
+	if err := dev.Init(); err != nil {
+		log.Fatal(err)
+	}
+	defer dev.Fini()
+
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rec, err := sequence.MakeRecorder(dev, &opt, f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			if err := rec.Close(); err != nil {
+				log.Print(err)
+			}
+			f.Close()
+		}()
+		dev = rec
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var ctrl *controller.Controller
+	pv := preview.MakePreview(dev, &opt, preview.Config{
+		Layouts: layouts,
+		Paint:   func(channel, start int, leds []uint32) error { return ctrl.SetPixels(channel, start, leds) },
+	})
+	ctrl = controller.MakeController(pv, &opt, *fps)
+	mux := http.NewServeMux()
+	mux.Handle("/preview/", pv)
+	mux.Handle("/api/", &api{ctrl: ctrl})
+	wled.MakeHandler(ctrl, *name).Register(mux)
+	server := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown) // nolint: errcheck
+	}()
+	go func() {
+		log.Printf("listening on %s", *listen)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Print(err)
+			stop()
+		}
+	}()
+
+	if *mqttBroker != "" {
+		bridge := homeassistant.MakeBridge(ctrl, homeassistant.Config{
+			Broker:   *mqttBroker,
+			Username: *mqttUser,
+			Password: *mqttPassword,
+			NodeID:   *nodeID,
+			Name:     *name,
+			OnError:  func(err error) { log.Printf("mqtt: %v", err) },
+		})
+		go bridge.Run(ctx) // nolint: errcheck
+	}
+
+	if err := ctrl.Run(ctx); err != nil {
+		log.Print(err)
+	}
+	// turn the LEDs off before leaving
+	for i := 0; i < ws2811.RpiPwmChannels; i++ {
+		ctrl.Fill(i, 0, len(dev.Leds(i)), 0) // nolint: errcheck
+	}
+	ctrl.RenderFrame(time.Now()) // nolint: errcheck
+}
@@ -0,0 +1,334 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config loads and saves the options of a WS2811 device from YAML,
+// JSON or TOML files, so that the same binary can run on devices with
+// different wiring. For example, in YAML:
+//
+//	frequency: 800000
+//	dma: 10
+//	channels:
+//	  - gpio: 18
+//	    led_count: 60
+//	    strip_type: grb
+//	    brightness: 128
+//	    gamma: 2.8
+//	    segments:
+//	      - {name: desk, start: 0, length: 30}
+//	      - {name: shelf, start: 30, length: 30}
+//
+// The values of the file can be overridden with environment variables (see
+// Override), and are validated before use.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"gopkg.in/yaml.v2"
+)
+
+// Format is the format of a configuration file.
+type Format string
+
+// Supported formats.
+const (
+	YAML Format = "yaml"
+	JSON Format = "json"
+	TOML Format = "toml"
+)
+
+// Limits of the values checked by Validate.
+const (
+	// MaxFrequency is the highest output frequency
+	MaxFrequency = 1200000
+	// MaxDmaNum is the highest DMA number
+	MaxDmaNum = 14
+	// MaxGpioPin is the highest GPIO pin number
+	MaxGpioPin = 53
+)
+
+// Config is the configuration of a device. Zero values are replaced by the
+// defaults of ws2811.DefaultOptions.
+type Config struct {
+	// RenderWaitTime is the time in µs before the next render can run
+	RenderWaitTime int `json:"render_wait_time,omitempty" yaml:"render_wait_time,omitempty" toml:"render_wait_time,omitempty"`
+	// Frequency is the output frequency, 0 for ws2811.TargetFreq
+	Frequency int `json:"frequency,omitempty" yaml:"frequency,omitempty" toml:"frequency,omitempty"`
+	// DmaNum is the DMA number, 0 for ws2811.DefaultDmaNum
+	DmaNum int `json:"dma,omitempty" yaml:"dma,omitempty" toml:"dma,omitempty"`
+	// Channels are the channels of the device
+	Channels []Channel `json:"channels" yaml:"channels" toml:"channels"`
+}
+
+// Channel is the configuration of a channel.
+type Channel struct {
+	// GpioPin is the GPIO pin, 0 if the channel is unused
+	GpioPin int `json:"gpio" yaml:"gpio" toml:"gpio"`
+	// LedCount is the number of LEDs, 0 if the channel is unused
+	LedCount int `json:"led_count" yaml:"led_count" toml:"led_count"`
+	// StripType is the name of the strip type (see ws2811.ParseStripeType),
+	// empty for ws2811.WS2812Strip
+	StripType string `json:"strip_type,omitempty" yaml:"strip_type,omitempty" toml:"strip_type,omitempty"`
+	// Brightness is the maximum brightness, 0 for ws2811.DefaultBrightness
+	Brightness int `json:"brightness,omitempty" yaml:"brightness,omitempty" toml:"brightness,omitempty"`
+	// Gamma is the gamma correction factor, 0 for the default table of the
+	// library
+	Gamma float64 `json:"gamma,omitempty" yaml:"gamma,omitempty" toml:"gamma,omitempty"`
+	// Invert inverts the output signal
+	Invert bool `json:"invert,omitempty" yaml:"invert,omitempty" toml:"invert,omitempty"`
+	// Segments are named ranges of LEDs of the channel
+	Segments []Segment `json:"segments,omitempty" yaml:"segments,omitempty" toml:"segments,omitempty"`
+}
+
+// Segment is a named range of LEDs of a channel.
+type Segment struct {
+	// Name is the name of the segment, unique in the channel
+	Name string `json:"name" yaml:"name" toml:"name"`
+	// Start is the index of the first LED
+	Start int `json:"start" yaml:"start" toml:"start"`
+	// Length is the number of LEDs
+	Length int `json:"length" yaml:"length" toml:"length"`
+}
+
+// FormatOf returns the format of a file from its extension.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return YAML, nil
+	case ".json":
+		return JSON, nil
+	case ".toml":
+		return TOML, nil
+	}
+	return "", fmt.Errorf("unknown configuration format for %q", path)
+}
+
+// Load reads a configuration file, applies the overrides of the environment
+// and validates the result. The format is given by the extension of the file.
+func Load(path string) (*Config, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := Decode(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.Override(os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Save writes a configuration file. The format is given by the extension of
+// the file.
+func (c *Config) Save(path string) error {
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := c.Encode(&buf, format); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644) // nolint: gosec
+}
+
+// Decode reads a configuration. Unknown keys are errors, to catch typos. The
+// configuration is not validated.
+func Decode(r io.Reader, format Format) (*Config, error) {
+	c := &Config{}
+	switch format {
+	case YAML:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(data, c); err != nil {
+			return nil, err
+		}
+	case JSON:
+		d := json.NewDecoder(r)
+		d.DisallowUnknownFields()
+		if err := d.Decode(c); err != nil {
+			return nil, err
+		}
+	case TOML:
+		md, err := toml.NewDecoder(r).Decode(c)
+		if err != nil {
+			return nil, err
+		}
+		if keys := md.Undecoded(); len(keys) > 0 {
+			return nil, fmt.Errorf("unknown key %q", keys[0].String())
+		}
+	default:
+		return nil, fmt.Errorf("unknown configuration format %q", format)
+	}
+	return c, nil
+}
+
+// Encode writes a configuration.
+func (c *Config) Encode(w io.Writer, format Format) error {
+	switch format {
+	case YAML:
+		data, err := yaml.Marshal(c)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case JSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(c)
+	case TOML:
+		return toml.NewEncoder(w).Encode(c)
+	}
+	return fmt.Errorf("unknown configuration format %q", format)
+}
+
+// Validate checks the configuration and returns all the problems found.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, a ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, a...))
+		}
+	}
+	check(c.RenderWaitTime >= 0, "render_wait_time: must not be negative")
+	check(c.Frequency >= 0 && c.Frequency <= MaxFrequency, "frequency: must be between 0 and %d", MaxFrequency)
+	check(c.DmaNum >= 0 && c.DmaNum <= MaxDmaNum, "dma: must be between 0 and %d", MaxDmaNum)
+	check(len(c.Channels) > 0, "channels: at least one channel is needed")
+	check(len(c.Channels) <= ws2811.RpiPwmChannels, "channels: at most %d channels are supported", ws2811.RpiPwmChannels)
+
+	pins := make(map[int]int)
+	for i, ch := range c.Channels {
+		p := fmt.Sprintf("channels[%d]", i)
+		check(ch.GpioPin >= 0 && ch.GpioPin <= MaxGpioPin, "%s.gpio: must be between 0 and %d", p, MaxGpioPin)
+		if other, ok := pins[ch.GpioPin]; ok && ch.GpioPin != 0 {
+			check(false, "%s.gpio: GPIO %d is already used by channel %d", p, ch.GpioPin, other)
+		}
+		pins[ch.GpioPin] = i
+		check(ch.LedCount >= 0, "%s.led_count: must not be negative", p)
+		if ch.StripType != "" {
+			_, err := ws2811.ParseStripeType(ch.StripType)
+			check(err == nil, "%s.strip_type: %v", p, err)
+		}
+		check(ch.Brightness >= 0 && ch.Brightness <= 255, "%s.brightness: must be between 0 and 255", p)
+		check(ch.Gamma >= 0 && !math.IsInf(ch.Gamma, 0) && !math.IsNaN(ch.Gamma), "%s.gamma: must be a positive number", p)
+
+		names := make(map[string]bool)
+		for j, s := range ch.Segments {
+			p := fmt.Sprintf("%s.segments[%d]", p, j)
+			check(s.Name != "", "%s.name: must not be empty", p)
+			check(!names[s.Name], "%s.name: duplicate name %q", p, s.Name)
+			names[s.Name] = true
+			check(s.Start >= 0 && s.Length > 0 && s.Start+s.Length <= ch.LedCount,
+				"%s: LEDs %d to %d are outside of the %d LEDs of the channel", p, s.Start, s.Start+s.Length-1, ch.LedCount)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Option returns the options of the device. The configuration should be
+// valid.
+func (c *Config) Option() (ws2811.Option, error) {
+	opt := ws2811.Option{
+		RenderWaitTime: c.RenderWaitTime,
+		Frequency:      c.Frequency,
+		DmaNum:         c.DmaNum,
+	}
+	if opt.Frequency == 0 {
+		opt.Frequency = ws2811.TargetFreq
+	}
+	if opt.DmaNum == 0 {
+		opt.DmaNum = ws2811.DefaultDmaNum
+	}
+	for i, ch := range c.Channels {
+		co := ws2811.ChannelOption{
+			GpioPin:    ch.GpioPin,
+			LedCount:   ch.LedCount,
+			StripeType: ws2811.WS2812Strip,
+			Brightness: ch.Brightness,
+			Invert:     ch.Invert,
+			Gamma:      ws2811.DefaultOptions.Channels[0].Gamma,
+		}
+		if ch.StripType != "" {
+			t, err := ws2811.ParseStripeType(ch.StripType)
+			if err != nil {
+				return ws2811.Option{}, fmt.Errorf("channels[%d].strip_type: %w", i, err)
+			}
+			co.StripeType = t
+		}
+		if co.Brightness == 0 {
+			co.Brightness = ws2811.DefaultBrightness
+		}
+		if ch.Gamma > 0 {
+			co.Gamma = GammaTable(ch.Gamma)
+		}
+		opt.Channels = append(opt.Channels, co)
+	}
+	return opt, nil
+}
+
+// FromOption returns the configuration of a device. Custom gamma tables can
+// not be expressed as a factor and are replaced by the default table.
+func FromOption(opt *ws2811.Option) *Config {
+	c := &Config{
+		RenderWaitTime: opt.RenderWaitTime,
+		Frequency:      opt.Frequency,
+		DmaNum:         opt.DmaNum,
+	}
+	for _, co := range opt.Channels {
+		c.Channels = append(c.Channels, Channel{
+			GpioPin:    co.GpioPin,
+			LedCount:   co.LedCount,
+			StripType:  ws2811.StripeTypeName(co.StripeType),
+			Brightness: co.Brightness,
+			Invert:     co.Invert,
+		})
+	}
+	return c
+}
+
+// GammaTable returns the gamma correction table for a factor, computed as
+// ws2811_set_custom_gamma_factor does in the C library.
+func GammaTable(factor float64) []byte {
+	table := make([]byte, 256)
+	for i := range table {
+		table[i] = byte(i)
+		if factor > 0 {
+			table[i] = byte(math.Pow(float64(i)/255, factor)*255 + 0.5)
+		}
+	}
+	return table
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const yamlConfig = `
+frequency: 400000
+dma: 5
+channels:
+  - gpio: 18
+    led_count: 60
+    strip_type: grbw
+    brightness: 128
+    gamma: 2.2
+    segments:
+      - {name: desk, start: 0, length: 30}
+      - {name: shelf, start: 30, length: 30}
+  - gpio: 13
+    led_count: 10
+    strip_type: sk6812
+    invert: true
+`
+
+const jsonConfig = `{
+  "frequency": 400000,
+  "dma": 5,
+  "channels": [
+    {"gpio": 18, "led_count": 60, "strip_type": "grbw", "brightness": 128, "gamma": 2.2,
+     "segments": [{"name": "desk", "start": 0, "length": 30}, {"name": "shelf", "start": 30, "length": 30}]},
+    {"gpio": 13, "led_count": 10, "strip_type": "sk6812", "invert": true}
+  ]
+}`
+
+const tomlConfig = `
+frequency = 400000
+dma = 5
+
+[[channels]]
+gpio = 18
+led_count = 60
+strip_type = "grbw"
+brightness = 128
+gamma = 2.2
+segments = [{name = "desk", start = 0, length = 30}, {name = "shelf", start = 30, length = 30}]
+
+[[channels]]
+gpio = 13
+led_count = 10
+strip_type = "sk6812"
+invert = true
+`
+
+func TestDecode(t *testing.T) {
+	want := &Config{
+		Frequency: 400000,
+		DmaNum:    5,
+		Channels: []Channel{
+			{GpioPin: 18, LedCount: 60, StripType: "grbw", Brightness: 128, Gamma: 2.2, Segments: []Segment{
+				{Name: "desk", Start: 0, Length: 30},
+				{Name: "shelf", Start: 30, Length: 30},
+			}},
+			{GpioPin: 13, LedCount: 10, StripType: "sk6812", Invert: true},
+		},
+	}
+	for format, data := range map[Format]string{YAML: yamlConfig, JSON: jsonConfig, TOML: tomlConfig} {
+		c, err := Decode(strings.NewReader(data), format)
+		assert.Nil(t, err, format)
+		assert.Equal(t, want, c, format)
+		assert.Nil(t, c.Validate(), format)
+	}
+
+	opt, err := want.Option()
+	assert.Nil(t, err)
+	assert.Equal(t, 400000, opt.Frequency)
+	assert.Equal(t, 5, opt.DmaNum)
+	assert.Equal(t, ws2811.SK6812StripGRBW, opt.Channels[0].StripeType)
+	assert.Equal(t, GammaTable(2.2), opt.Channels[0].Gamma)
+	assert.Equal(t, ws2811.DefaultBrightness, opt.Channels[1].Brightness)
+	assert.Equal(t, ws2811.WS2811StripGRB, opt.Channels[1].StripeType)
+	assert.True(t, opt.Channels[1].Invert)
+}
+
+func TestUnknownKey(t *testing.T) {
+	for format, data := range map[Format]string{
+		YAML: "channels:\n  - gpio: 18\n    led_cout: 10\n",
+		JSON: `{"channels": [{"gpio": 18, "led_cout": 10}]}`,
+		TOML: "[[channels]]\ngpio = 18\nled_cout = 10\n",
+	} {
+		_, err := Decode(strings.NewReader(data), format)
+		assert.NotNil(t, err, format)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	opt := ws2811.DefaultOptions
+	opt.Channels = []ws2811.ChannelOption{opt.Channels[0], opt.Channels[0]}
+	opt.Channels[1].GpioPin = 13
+	opt.Channels[1].StripeType = ws2811.SK6812StrioBRGW
+	c := FromOption(&opt)
+	assert.Equal(t, "WS2811StripGRB", c.Channels[0].StripType)
+	assert.Equal(t, "SK6812StrioBRGW", c.Channels[1].StripType)
+
+	dir := t.TempDir()
+	for _, name := range []string{"ws281x.yml", "ws281x.json", "ws281x.toml"} {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, c.Save(path))
+		loaded, err := Load(path)
+		assert.Nil(t, err, name)
+		assert.Equal(t, c, loaded, name)
+		got, err := loaded.Option()
+		assert.Nil(t, err)
+		assert.Equal(t, opt, got, name)
+	}
+
+	_, err := Load(filepath.Join(dir, "ws281x.ini"))
+	assert.NotNil(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	c := &Config{
+		Frequency: 2000000,
+		Channels: []Channel{
+			{GpioPin: 18, LedCount: 10, StripType: "rgbx", Brightness: 300, Segments: []Segment{
+				{Name: "a", Start: 0, Length: 5},
+				{Name: "a", Start: 5, Length: 6},
+			}},
+			{GpioPin: 18, LedCount: -1, Gamma: -1},
+		},
+	}
+	err := c.Validate()
+	assert.NotNil(t, err)
+	for _, msg := range []string{
+		"frequency",
+		"channels[0].strip_type",
+		"channels[0].brightness",
+		`channels[0].segments[1].name: duplicate name "a"`,
+		"channels[0].segments[1]: LEDs 5 to 10",
+		"channels[1].gpio: GPIO 18 is already used by channel 0",
+		"channels[1].led_count",
+		"channels[1].gamma",
+	} {
+		assert.Contains(t, err.Error(), msg)
+	}
+	assert.NotNil(t, (&Config{}).Validate())
+}
+
+func TestOverride(t *testing.T) {
+	c, err := Decode(strings.NewReader(yamlConfig), YAML)
+	assert.Nil(t, err)
+	assert.Nil(t, c.Override([]string{
+		"HOME=/root",
+		"WS281X_DMA=10",
+		"WS281X_CHANNEL0_LED_COUNT=120",
+		"WS281X_CHANNEL0_STRIP_TYPE=0x100800",
+		"WS281X_CHANNEL1_INVERT=false",
+		"WS281X_CHANNEL1_GAMMA=1.5",
+	}))
+	assert.Equal(t, 10, c.DmaNum)
+	assert.Equal(t, 120, c.Channels[0].LedCount)
+	assert.Equal(t, "0x100800", c.Channels[0].StripType)
+	assert.False(t, c.Channels[1].Invert)
+	assert.Equal(t, 1.5, c.Channels[1].Gamma)
+
+	c = &Config{}
+	assert.Nil(t, c.Override([]string{"WS281X_CHANNEL1_GPIO=13"}))
+	assert.Equal(t, 2, len(c.Channels))
+	assert.Equal(t, 13, c.Channels[1].GpioPin)
+
+	for _, kv := range []string{
+		"WS281X_DMA=ten",
+		"WS281X_CHANNEL2_GPIO=13",
+		"WS281X_CHANNEL0_COLOR=red",
+		"WS281X_FREQ=800000",
+		"WS281X_CHANNEL0_INVERT=maybe",
+	} {
+		assert.NotNil(t, (&Config{}).Override([]string{kv}), kv)
+	}
+
+	path := filepath.Join(t.TempDir(), "ws281x.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(yamlConfig), 0o600))
+	t.Setenv("WS281X_CHANNEL0_BRIGHTNESS", "255")
+	c, err = Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 255, c.Channels[0].Brightness)
+	t.Setenv("WS281X_CHANNEL0_BRIGHTNESS", "256")
+	_, err = Load(path)
+	assert.NotNil(t, err)
+}
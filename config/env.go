@@ -0,0 +1,104 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+)
+
+// EnvPrefix is the prefix of the environment variables read by Override.
+const EnvPrefix = "WS281X_"
+
+// Override applies the environment variables of environ, in the "KEY=value"
+// form of os.Environ, to the configuration. The variables are
+// WS281X_RENDER_WAIT_TIME, WS281X_FREQUENCY and WS281X_DMA for the device,
+// and WS281X_CHANNEL<n>_GPIO, _LED_COUNT, _STRIP_TYPE, _BRIGHTNESS, _GAMMA
+// and _INVERT for channel n, which is added if needed. Unknown variables with
+// the WS281X_ prefix are errors.
+func (c *Config) Override(environ []string) error {
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, EnvPrefix) {
+			continue
+		}
+		if err := c.override(strings.TrimPrefix(key, EnvPrefix), value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) override(key, value string) error {
+	switch key {
+	case "RENDER_WAIT_TIME":
+		return parseInt(value, &c.RenderWaitTime)
+	case "FREQUENCY":
+		return parseInt(value, &c.Frequency)
+	case "DMA":
+		return parseInt(value, &c.DmaNum)
+	}
+
+	var n int
+	if _, err := fmt.Sscanf(key, "CHANNEL%d_", &n); err != nil {
+		return fmt.Errorf("unknown variable")
+	}
+	field := key[strings.IndexByte(key, '_')+1:]
+	if n < 0 || n >= ws2811.RpiPwmChannels {
+		return fmt.Errorf("invalid channel %d", n)
+	}
+	for len(c.Channels) <= n {
+		c.Channels = append(c.Channels, Channel{})
+	}
+	ch := &c.Channels[n]
+	switch field {
+	case "GPIO":
+		return parseInt(value, &ch.GpioPin)
+	case "LED_COUNT":
+		return parseInt(value, &ch.LedCount)
+	case "STRIP_TYPE":
+		ch.StripType = value
+		return nil
+	case "BRIGHTNESS":
+		return parseInt(value, &ch.Brightness)
+	case "GAMMA":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		ch.Gamma = v
+		return nil
+	case "INVERT":
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		ch.Invert = v
+		return nil
+	}
+	return fmt.Errorf("unknown variable")
+}
+
+func parseInt(s string, v *int) error {
+	i, err := strconv.ParseInt(s, 0, 0)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", s)
+	}
+	*v = int(i)
+	return nil
+}
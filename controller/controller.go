@@ -0,0 +1,297 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package controller runs a WS2811 device for a daemon: it owns the frames of
+// the channels, runs effects in a render loop and keeps statistics, so that
+// several front-ends (HTTP, MQTT, ...) can control the same device.
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/effects"
+)
+
+// DefaultFPS is the default frame rate of the render loop.
+const DefaultFPS = 50
+
+// Controller controls a device. All its methods are safe for concurrent use.
+type Controller struct {
+	dev ws2811.Device
+	fps int
+
+	// devMu serializes the calls to the device, it is locked before mu
+	devMu sync.Mutex
+
+	mu       sync.Mutex
+	channels []*channel
+	frames   uint64
+	fpsValue float64
+	lastErr  error
+}
+
+// channel is the state of a channel.
+type channel struct {
+	frame      []uint32
+	brightness int
+	stripeType int
+	effect     effects.Effect
+	effectName string
+	effectAt   time.Time
+}
+
+// Status is the status of a controller.
+type Status struct {
+	// Hardware is the description of the hardware
+	Hardware ws2811.HwDesc `json:"hardware"`
+	// FPS is the measured frame rate
+	FPS float64 `json:"fps"`
+	// Frames is the number of rendered frames
+	Frames uint64 `json:"frames"`
+	// LastError is the last render error, empty if none
+	LastError string `json:"last_error,omitempty"`
+	// Channels is the status of the channels
+	Channels []ChannelStatus `json:"channels"`
+}
+
+// ChannelStatus is the status of a channel.
+type ChannelStatus struct {
+	LedCount   int    `json:"led_count"`
+	StripeType int    `json:"stripe_type"`
+	Brightness int    `json:"brightness"`
+	Effect     string `json:"effect,omitempty"`
+}
+
+// MakeController creates a controller for an initialized device configured
+// with opt. fps is the frame rate of the render loop (DefaultFPS if 0).
+func MakeController(dev ws2811.Device, opt *ws2811.Option, fps int) *Controller {
+	if fps <= 0 {
+		fps = DefaultFPS
+	}
+	c := &Controller{dev: dev, fps: fps}
+	for i := 0; i < ws2811.RpiPwmChannels; i++ {
+		ch := &channel{frame: make([]uint32, len(dev.Leds(i)))}
+		if i < len(opt.Channels) {
+			ch.brightness = opt.Channels[i].Brightness
+			ch.stripeType = opt.Channels[i].StripeType
+		}
+		c.channels = append(c.channels, ch)
+	}
+	return c
+}
+
+// Run renders frames until the context is done.
+func (c *Controller) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Second / time.Duration(c.fps))
+	defer ticker.Stop()
+	start := time.Now()
+	count := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			err := c.RenderFrame(now)
+			c.mu.Lock()
+			if err != nil {
+				c.lastErr = err
+			}
+			count++
+			if elapsed := now.Sub(start); elapsed >= time.Second {
+				c.fpsValue = float64(count) / elapsed.Seconds()
+				start, count = now, 0
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// RenderFrame renders the effects at time now and sends the frame to the
+// device. It is called by Run at every tick.
+func (c *Controller) RenderFrame(now time.Time) error {
+	c.devMu.Lock()
+	defer c.devMu.Unlock()
+	if err := c.dev.Wait(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	for i, ch := range c.channels {
+		if ch.effect != nil {
+			ch.effect.Render(ch.frame, now.Sub(ch.effectAt))
+		}
+		copy(c.dev.Leds(i), ch.frame)
+	}
+	c.frames++
+	c.mu.Unlock()
+	return c.dev.Render()
+}
+
+func (c *Controller) channel(i int) (*channel, error) {
+	if i < 0 || i >= len(c.channels) {
+		return nil, fmt.Errorf("invalid channel %d", i)
+	}
+	return c.channels[i], nil
+}
+
+// Pixels returns a copy of the frame of a channel.
+func (c *Controller) Pixels(channel int) ([]uint32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, err := c.channel(channel)
+	if err != nil {
+		return nil, err
+	}
+	return append([]uint32(nil), ch.frame...), nil
+}
+
+// SetPixels sets the colors of the LEDs of a channel from index start. It
+// stops the effect of the channel.
+func (c *Controller) SetPixels(channel int, start int, colors []uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	leds, err := c.leds(channel, start, len(colors))
+	if err != nil {
+		return err
+	}
+	copy(leds, colors)
+	return nil
+}
+
+// Fill sets count LEDs of a channel from index start to the same color. It
+// stops the effect of the channel.
+func (c *Controller) Fill(channel int, start, count int, color uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	leds, err := c.leds(channel, start, count)
+	if err != nil {
+		return err
+	}
+	effects.Fill(leds, color)
+	return nil
+}
+
+// leds checks a range of LEDs of a channel, stops the effect of the channel
+// and returns the range of its frame. c.mu must be locked.
+func (c *Controller) leds(channel int, start, count int) ([]uint32, error) {
+	ch, err := c.channel(channel)
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 || count < 0 || start > len(ch.frame) || count > len(ch.frame)-start {
+		return nil, fmt.Errorf("invalid range %d+%d for %d LEDs", start, count, len(ch.frame))
+	}
+	ch.effect, ch.effectName = nil, ""
+	return ch.frame[start : start+count], nil
+}
+
+// Brightness returns the brightness of a channel.
+func (c *Controller) Brightness(channel int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, err := c.channel(channel)
+	if err != nil {
+		return 0, err
+	}
+	return ch.brightness, nil
+}
+
+// SetBrightness changes the brightness of a channel. Value between 0 and 255
+func (c *Controller) SetBrightness(channel int, brightness int) error {
+	if brightness < 0 || brightness > 255 {
+		return fmt.Errorf("invalid brightness %d", brightness)
+	}
+	c.devMu.Lock()
+	defer c.devMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, err := c.channel(channel)
+	if err != nil {
+		return err
+	}
+	ch.brightness = brightness
+	c.dev.SetBrightness(channel, brightness)
+	return nil
+}
+
+// Effect returns the name of the effect running on a channel, empty if none.
+func (c *Controller) Effect(channel int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, err := c.channel(channel)
+	if err != nil {
+		return "", err
+	}
+	return ch.effectName, nil
+}
+
+// StartEffect starts a registered effect (see effects.Names) on a channel.
+func (c *Controller) StartEffect(channel int, name string) error {
+	e, err := effects.New(name)
+	if err != nil {
+		return err
+	}
+	return c.SetEffect(channel, name, e)
+}
+
+// SetEffect starts an effect on a channel. The name is reported by Status.
+func (c *Controller) SetEffect(channel int, name string, e effects.Effect) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, err := c.channel(channel)
+	if err != nil {
+		return err
+	}
+	ch.effect, ch.effectName, ch.effectAt = e, name, time.Now()
+	return nil
+}
+
+// StopEffect stops the effect of a channel. The last frame of the effect
+// stays on.
+func (c *Controller) StopEffect(channel int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, err := c.channel(channel)
+	if err != nil {
+		return err
+	}
+	ch.effect, ch.effectName = nil, ""
+	return nil
+}
+
+// Status returns the status of the controller.
+func (c *Controller) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := Status{
+		Hardware: ws2811.HwDetect(),
+		FPS:      c.fpsValue,
+		Frames:   c.frames,
+	}
+	if c.lastErr != nil {
+		s.LastError = c.lastErr.Error()
+	}
+	for _, ch := range c.channels {
+		s.Channels = append(s.Channels, ChannelStatus{
+			LedCount:   len(ch.frame),
+			StripeType: ch.stripeType,
+			Brightness: ch.brightness,
+			Effect:     ch.effectName,
+		})
+	}
+	return s
+}
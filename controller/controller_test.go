@@ -0,0 +1,154 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/effects"
+	"github.com/stretchr/testify/assert"
+)
+
+// device is a device that records the brightness and checks that its calls
+// do not overlap.
+type device struct {
+	leds       [][]uint32
+	brightness []int
+
+	mu       sync.Mutex
+	busy     bool
+	overlaps int
+}
+
+func (d *device) enter() {
+	d.mu.Lock()
+	if d.busy {
+		d.overlaps++
+	}
+	d.busy = true
+	d.mu.Unlock()
+}
+
+func (d *device) leave() {
+	d.mu.Lock()
+	d.busy = false
+	d.mu.Unlock()
+}
+
+func (d *device) Init() error            { return nil }
+func (d *device) Fini()                  {}
+func (d *device) Leds(i int) []uint32    { return d.leds[i] }
+func (d *device) Wait() error            { return nil }
+func (d *device) Render() error          { d.enter(); time.Sleep(time.Millisecond); d.leave(); return nil }
+func (d *device) SetBrightness(i, b int) { d.enter(); d.brightness[i] = b; d.leave() }
+
+func setup() (*Controller, *device) {
+	dev := &device{leds: [][]uint32{make([]uint32, 4), make([]uint32, 2)}, brightness: make([]int, 2)}
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{
+		{LedCount: 4, Brightness: 64},
+		{LedCount: 2, Brightness: 128, StripeType: ws2811.SK6812StripGRBW},
+	}}
+	return MakeController(dev, &opt, 0), dev
+}
+
+func TestFill(t *testing.T) {
+	c, dev := setup()
+	assert.Nil(t, c.Fill(0, 1, 2, 0x010203))
+	assert.Nil(t, c.RenderFrame(time.Now()))
+	assert.Equal(t, []uint32{0, 0x010203, 0x010203, 0}, dev.leds[0])
+
+	assert.Nil(t, c.Fill(0, 4, 0, 0x010203))
+	for _, tt := range []struct{ channel, start, count int }{
+		{0, 0, -1},
+		{0, -1, 2},
+		{0, 3, 2},
+		{1, 0, 3},
+		{2, 0, 1},
+		{0, 1, math.MaxInt},
+		{0, math.MaxInt, 1},
+		{0, math.MaxInt, math.MaxInt},
+	} {
+		assert.NotNil(t, c.Fill(tt.channel, tt.start, tt.count, 0), tt)
+	}
+
+	assert.Nil(t, c.SetPixels(1, 1, []uint32{0xff000000}))
+	pixels, err := c.Pixels(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{0, 0xff000000}, pixels)
+	assert.NotNil(t, c.SetPixels(1, 1, []uint32{1, 2}))
+	assert.NotNil(t, c.SetPixels(1, math.MaxInt, []uint32{1}))
+}
+
+func TestSetBrightness(t *testing.T) {
+	c, dev := setup()
+	b, err := c.Brightness(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 128, b)
+
+	assert.Nil(t, c.SetBrightness(1, 200))
+	assert.Equal(t, 200, dev.brightness[1])
+	assert.NotNil(t, c.SetBrightness(1, 256))
+	assert.NotNil(t, c.SetBrightness(-1, 10))
+	assert.NotNil(t, c.SetBrightness(ws2811.RpiPwmChannels, 10))
+
+	// the brightness is never changed while the device renders
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			c.RenderFrame(time.Now()) // nolint: errcheck
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, c.SetBrightness(0, i))
+	}
+	wg.Wait()
+	assert.Equal(t, 0, dev.overlaps)
+}
+
+func TestEffect(t *testing.T) {
+	c, dev := setup()
+	assert.NotNil(t, c.StartEffect(0, "no such effect"))
+	assert.Nil(t, c.StartEffect(0, "solid"))
+	name, err := c.Effect(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "solid", name)
+	assert.Equal(t, "solid", c.Status().Channels[0].Effect)
+
+	assert.Nil(t, c.SetEffect(1, "white", effects.WithColor(&effects.Solid{}, 0xff000000)))
+	assert.Nil(t, c.RenderFrame(time.Now()))
+	assert.Equal(t, []uint32{0xff000000, 0xff000000}, dev.leds[1])
+
+	// the last frame of the effect stays on
+	assert.Nil(t, c.StopEffect(1))
+	name, err = c.Effect(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "", name)
+	assert.Nil(t, c.Fill(1, 0, 1, 0x0000ff))
+	assert.Nil(t, c.RenderFrame(time.Now()))
+	assert.Equal(t, []uint32{0x0000ff, 0xff000000}, dev.leds[1])
+
+	// setting pixels stops the effect
+	assert.Nil(t, c.Fill(0, 0, 1, 0))
+	name, err = c.Effect(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "", name)
+	assert.Equal(t, uint64(2), c.Status().Frames)
+}
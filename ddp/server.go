@@ -0,0 +1,358 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ddp implements a Distributed Display Protocol (DDP) server that
+// drives the channels of a WS2811 device.
+//
+// Unlike the DMX based protocols, DDP addresses the LEDs of a channel with a
+// byte offset, so a long strip does not need to be split into universes. The
+// server accepts RGB and RGBW pixel data, renders the frame when a packet has
+// the PUSH flag, and answers status and config queries.
+package ddp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/internal/dmx"
+)
+
+// DefaultPort is the UDP port of DDP.
+const DefaultPort = 4048
+
+// Flags of the first byte of the header.
+const (
+	FlagVersion1 = 0x40
+	FlagTimecode = 0x10
+	FlagStorage  = 0x08
+	FlagReply    = 0x04
+	FlagQuery    = 0x02
+	FlagPush     = 0x01
+
+	versionMask = 0xc0
+)
+
+// Data types of 8-bit pixels.
+const (
+	TypeUndefined = 0x00
+	TypeRGB       = 0x0b
+	TypeRGBW      = 0x1b
+)
+
+// Destination IDs.
+const (
+	IDDisplay = 1
+	IDControl = 246
+	IDConfig  = 250
+	IDStatus  = 251
+	IDAll     = 255
+)
+
+const headerLen = 10
+
+var errInvalidPacket = errors.New("invalid DDP packet")
+
+// Config is the configuration of a Server.
+type Config struct {
+	// Addr is the UDP address to listen on (default ":4048")
+	Addr string
+	// Outputs maps destination IDs to channels. By default ID 1 (the default
+	// display) is channel 0 and ID 2 is channel 1.
+	Outputs map[byte]int
+	// Manufacturer, Model and Version are reported in status replies
+	Manufacturer string
+	Model        string
+	Version      string
+	// OnError, if not nil, is called with the render errors of the device,
+	// which do not stop the server. They are logged by default.
+	OnError func(error)
+}
+
+// Server is a DDP server.
+type Server struct {
+	dev ws2811.Device
+	opt *ws2811.Option
+	cfg Config
+
+	mu     sync.Mutex
+	conn   net.PacketConn
+	closed bool
+
+	// buffers hold the pixel data of the channels, by channel and number of
+	// components, as packets can start and end in the middle of a pixel
+	buffers map[[2]int][]byte
+}
+
+// packet is a DDP packet.
+type packet struct {
+	flags    uint8
+	sequence uint8
+	dataType uint8
+	id       uint8
+	offset   uint32
+	data     []byte
+}
+
+func parsePacket(b []byte) (*packet, error) {
+	if len(b) < headerLen || b[0]&versionMask != FlagVersion1 {
+		return nil, errInvalidPacket
+	}
+	p := &packet{
+		flags:    b[0],
+		sequence: b[1] & 0x0f,
+		dataType: b[2],
+		id:       b[3],
+		offset:   binary.BigEndian.Uint32(b[4:]),
+	}
+	start := headerLen
+	if p.flags&FlagTimecode != 0 {
+		start += 4
+	}
+	end := start + int(binary.BigEndian.Uint16(b[8:]))
+	if end > len(b) {
+		return nil, errInvalidPacket
+	}
+	p.data = b[start:end]
+	return p, nil
+}
+
+// MakeServer creates a server for a device configured with opt. The device
+// must be initialized.
+func MakeServer(dev ws2811.Device, opt *ws2811.Option, cfg Config) *Server {
+	if cfg.Addr == "" {
+		cfg.Addr = fmt.Sprintf(":%d", DefaultPort)
+	}
+	if cfg.Outputs == nil {
+		cfg.Outputs = map[byte]int{IDDisplay: 0, IDDisplay + 1: 1}
+	}
+	if cfg.Manufacturer == "" {
+		cfg.Manufacturer = "rpi-ws281x"
+	}
+	if cfg.Model == "" {
+		cfg.Model = "rpi-ws281x-go"
+	}
+	return &Server{dev: dev, opt: opt, cfg: cfg, buffers: make(map[[2]int][]byte)}
+}
+
+// ListenAndServe listens on the configured address and serves the packets
+// until Close is called.
+func (s *Server) ListenAndServe() error {
+	conn, err := net.ListenPacket("udp4", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(conn)
+}
+
+// Serve reads the packets from conn until Close is called. Serve closes conn
+// when it returns. The render errors of the device are passed to
+// Config.OnError.
+func (s *Server) Serve(conn net.PacketConn) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return net.ErrClosed
+	}
+	s.conn = conn
+	s.mu.Unlock()
+	defer conn.Close()
+
+	buf := make([]byte, 1500)
+	for {
+		size, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return err
+		}
+		s.error(s.handle(conn, addr, buf[:size]))
+	}
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) error(err error) {
+	if err == nil {
+		return
+	}
+	if s.cfg.OnError != nil {
+		s.cfg.OnError(err)
+		return
+	}
+	log.Printf("ddp: %v", err)
+}
+
+// handle processes a packet. Invalid packets are ignored; only errors of the
+// device are returned.
+func (s *Server) handle(conn net.PacketConn, addr net.Addr, b []byte) error {
+	p, err := parsePacket(b)
+	if err != nil || p.flags&FlagReply != 0 {
+		return nil
+	}
+
+	if p.flags&FlagQuery != 0 {
+		if reply := s.reply(p); reply != nil {
+			// replies are best effort, like any UDP packet
+			conn.WriteTo(reply, addr) // nolint: errcheck
+		}
+		return nil
+	}
+
+	switch p.id {
+	case IDAll:
+		for _, channel := range s.cfg.Outputs {
+			s.write(channel, p)
+		}
+	default:
+		if channel, ok := s.cfg.Outputs[p.id]; ok {
+			s.write(channel, p)
+		}
+	}
+
+	if p.flags&FlagPush != 0 {
+		return s.dev.Render()
+	}
+	return nil
+}
+
+// components returns the number of bytes per pixel of a channel.
+func (s *Server) components(channel int) int {
+	if channel < len(s.opt.Channels) {
+		return ws2811.StripeComponents(s.opt.Channels[channel].StripeType)
+	}
+	return 3
+}
+
+// write copies the pixel data of a packet into the buffer of a channel at its
+// byte offset, then updates the LEDs of the pixels it touches.
+func (s *Server) write(channel int, p *packet) {
+	var components int
+	switch p.dataType {
+	case TypeUndefined:
+		components = s.components(channel)
+	case TypeRGB:
+		components = 3
+	case TypeRGBW:
+		components = 4
+	default:
+		return
+	}
+	if channel < 0 || channel >= ws2811.RpiPwmChannels {
+		return
+	}
+	leds := s.dev.Leds(channel)
+	key := [2]int{channel, components}
+	buf, ok := s.buffers[key]
+	if !ok {
+		buf = make([]byte, len(leds)*components)
+		s.buffers[key] = buf
+	}
+	if uint64(p.offset) >= uint64(len(buf)) {
+		return
+	}
+	start := int(p.offset)
+	end := start + copy(buf[start:], p.data)
+	first, last := start/components, (end+components-1)/components
+	u := dmx.Universe{
+		Channel:    channel,
+		Start:      first,
+		Components: components,
+	}
+	u.Write(leds, buf[first*components:last*components])
+}
+
+// status is the JSON reply to a status query.
+type status struct {
+	Status struct {
+		Update string `json:"update"`
+		State  string `json:"state"`
+		Man    string `json:"man"`
+		Mod    string `json:"mod"`
+		Ver    string `json:"ver,omitempty"`
+	} `json:"status"`
+}
+
+// config is the JSON reply to a config query.
+type config struct {
+	Config struct {
+		Ports []port `json:"ports"`
+	} `json:"config"`
+}
+
+type port struct {
+	Port int `json:"port"`
+	TS   int `json:"ts"`
+	L    int `json:"l"`
+	SS   int `json:"ss"`
+}
+
+// reply returns the reply to a query, nil if the query is not supported.
+func (s *Server) reply(p *packet) []byte {
+	var v interface{}
+	switch p.id {
+	case IDStatus:
+		st := &status{}
+		st.Status.Update = "change"
+		st.Status.State = "up"
+		st.Status.Man = s.cfg.Manufacturer
+		st.Status.Mod = s.cfg.Model
+		st.Status.Ver = s.cfg.Version
+		v = st
+	case IDConfig:
+		c := &config{}
+		c.Config.Ports = []port{}
+		for i, ch := range s.opt.Channels {
+			if ch.LedCount > 0 {
+				c.Config.Ports = append(c.Config.Ports, port{Port: i, L: ch.LedCount})
+			}
+		}
+		v = c
+	default:
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	b := make([]byte, headerLen+len(data))
+	b[0] = FlagVersion1 | FlagReply | FlagPush
+	b[1] = p.sequence
+	b[3] = p.id
+	binary.BigEndian.PutUint16(b[8:], uint16(len(data)))
+	copy(b[headerLen:], data)
+	return b
+}
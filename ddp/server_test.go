@@ -0,0 +1,170 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// device is a simulated device that reports renders.
+type device struct {
+	*ws2811.WS2811
+	rendered chan [][]uint32
+}
+
+func (d *device) Render() error {
+	d.rendered <- [][]uint32{
+		append([]uint32(nil), d.Leds(0)...),
+		append([]uint32(nil), d.Leds(1)...),
+	}
+	return nil
+}
+
+func packetBytes(flags, dataType, id uint8, offset uint32, data []byte) []byte {
+	b := make([]byte, headerLen+len(data))
+	b[0] = FlagVersion1 | flags
+	b[2] = dataType
+	b[3] = id
+	binary.BigEndian.PutUint32(b[4:], offset)
+	binary.BigEndian.PutUint16(b[8:], uint16(len(data)))
+	copy(b[headerLen:], data)
+	return b
+}
+
+func TestServer(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{
+		{LedCount: 3, StripeType: ws2811.WS2812Strip},
+		{LedCount: 2, StripeType: ws2811.SK6812StripGRBW},
+	}}
+	ws, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	dev := &device{WS2811: ws, rendered: make(chan [][]uint32, 16)}
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := MakeServer(dev, &opt, Config{Version: "1.2"})
+	go s.Serve(conn) // nolint: errcheck
+	defer s.Close()
+
+	client, err := net.Dial("udp4", conn.LocalAddr().String())
+	assert.Nil(t, err)
+	defer client.Close()
+
+	expectFrame := func(want [][]uint32) {
+		select {
+		case got := <-dev.rendered:
+			assert.Equal(t, want, got)
+		case <-time.After(time.Second):
+			t.Fatal("no frame rendered")
+		}
+	}
+
+	// RGB data at an offset, the data type of channel 1 is taken from its strip type
+	client.Write(packetBytes(0, TypeRGB, IDDisplay, 3, []byte{1, 2, 3, 4, 5, 6}))          // nolint: errcheck
+	client.Write(packetBytes(FlagPush, TypeUndefined, IDDisplay+1, 4, []byte{1, 2, 3, 4})) // nolint: errcheck
+	expectFrame([][]uint32{{0, 0x010203, 0x040506}, {0, 0x04010203}})
+
+	// a pixel split across two packets
+	client.Write(packetBytes(0, TypeRGB, IDDisplay, 0, []byte{7, 8, 9, 10}))           // nolint: errcheck
+	client.Write(packetBytes(FlagPush, TypeRGB, IDDisplay, 4, []byte{11, 12, 13, 14})) // nolint: errcheck
+	expectFrame([][]uint32{{0x070809, 0x0a0b0c, 0x0d0e06}, {0, 0x04010203}})
+
+	// push without data
+	client.Write(packetBytes(FlagPush, TypeRGB, IDDisplay, 0, nil)) // nolint: errcheck
+	expectFrame([][]uint32{{0x070809, 0x0a0b0c, 0x0d0e06}, {0, 0x04010203}})
+
+	// status query
+	client.Write(packetBytes(FlagQuery, 0, IDStatus, 0, nil)) // nolint: errcheck
+	assert.Nil(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 1500)
+	size, err := client.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(FlagReply), buf[0]&FlagReply)
+	assert.Equal(t, uint8(IDStatus), buf[3])
+	var st status
+	assert.Nil(t, json.Unmarshal(buf[headerLen:size], &st))
+	assert.Equal(t, "up", st.Status.State)
+	assert.Equal(t, "1.2", st.Status.Ver)
+
+	// config query
+	client.Write(packetBytes(FlagQuery, 0, IDConfig, 0, nil)) // nolint: errcheck
+	size, err = client.Read(buf)
+	assert.Nil(t, err)
+	var c config
+	assert.Nil(t, json.Unmarshal(buf[headerLen:size], &c))
+	assert.Equal(t, []port{{Port: 0, L: 3}, {Port: 1, L: 2}}, c.Config.Ports)
+}
+
+// failingDevice fails its first render.
+type failingDevice struct {
+	*device
+	failed bool
+}
+
+func (d *failingDevice) Render() error {
+	if !d.failed {
+		d.failed = true
+		return errors.New("render failed")
+	}
+	return d.device.Render()
+}
+
+func TestRenderError(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 1}}}
+	ws, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	dev := &device{WS2811: ws, rendered: make(chan [][]uint32, 16)}
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.Nil(t, err)
+	errs := make(chan error, 1)
+	s := MakeServer(&failingDevice{device: dev}, &opt, Config{
+		// outputs of channels the device does not have are ignored
+		Outputs: map[byte]int{IDDisplay: 0, IDDisplay + 1: 5},
+		OnError: func(err error) { errs <- err },
+	})
+	go s.Serve(conn) // nolint: errcheck
+	defer s.Close()
+
+	client, err := net.Dial("udp4", conn.LocalAddr().String())
+	assert.Nil(t, err)
+	defer client.Close()
+
+	client.Write(packetBytes(FlagPush, TypeRGB, IDAll, 0, []byte{1, 1, 1})) // nolint: errcheck
+	select {
+	case err := <-errs:
+		assert.EqualError(t, err, "render failed")
+	case <-time.After(time.Second):
+		t.Fatal("no error reported")
+	}
+	// the server keeps serving
+	client.Write(packetBytes(FlagPush, TypeRGB, IDDisplay, 0, []byte{2, 2, 2})) // nolint: errcheck
+	select {
+	case got := <-dev.rendered:
+		assert.Equal(t, []uint32{0x020202}, got[0])
+	case <-time.After(time.Second):
+		t.Fatal("no frame rendered")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e131
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// Vectors and offsets of ANSI E1.31-2018.
+const (
+	vectorRootData     = 0x00000004
+	vectorRootExtended = 0x00000008
+	vectorFramingData  = 0x00000002
+	vectorFramingSync  = 0x00000001
+	vectorDMPSetProp   = 0x02
+
+	optionPreview    = 0x80
+	optionTerminated = 0x40
+
+	dataHeaderLen = 126
+	syncLen       = 49
+)
+
+// nolint: gochecknoglobals
+var acnPacketIdentifier = []byte("ASC-E1.17\x00\x00\x00")
+
+var errInvalidPacket = errors.New("invalid E1.31 packet")
+
+// dataPacket is an E1.31 data packet.
+type dataPacket struct {
+	cid         [16]byte
+	sourceName  string
+	priority    uint8
+	syncAddress uint16
+	sequence    uint8
+	options     uint8
+	universe    uint16
+	startCode   uint8
+	slots       []byte
+}
+
+// syncPacket is an E1.31 synchronization packet.
+type syncPacket struct {
+	cid         [16]byte
+	sequence    uint8
+	syncAddress uint16
+}
+
+// parsePacket decodes a data packet or a synchronization packet. It returns
+// a *dataPacket or a *syncPacket.
+func parsePacket(b []byte) (interface{}, error) {
+	if len(b) < syncLen ||
+		binary.BigEndian.Uint16(b[0:]) != 0x0010 ||
+		!bytes.Equal(b[4:16], acnPacketIdentifier) {
+		return nil, errInvalidPacket
+	}
+	var cid [16]byte
+	copy(cid[:], b[22:38])
+
+	switch binary.BigEndian.Uint32(b[18:]) {
+	case vectorRootData:
+		if len(b) < dataHeaderLen ||
+			binary.BigEndian.Uint32(b[40:]) != vectorFramingData ||
+			b[117] != vectorDMPSetProp || b[118] != 0xa1 {
+			return nil, errInvalidPacket
+		}
+		count := int(binary.BigEndian.Uint16(b[123:]))
+		if count < 1 || count > 513 || dataHeaderLen-1+count > len(b) {
+			return nil, errInvalidPacket
+		}
+		return &dataPacket{
+			cid:         cid,
+			sourceName:  string(bytes.TrimRight(b[44:108], "\x00")),
+			priority:    b[108],
+			syncAddress: binary.BigEndian.Uint16(b[109:]),
+			sequence:    b[111],
+			options:     b[112],
+			universe:    binary.BigEndian.Uint16(b[113:]),
+			startCode:   b[125],
+			slots:       b[dataHeaderLen : dataHeaderLen-1+count],
+		}, nil
+	case vectorRootExtended:
+		if binary.BigEndian.Uint32(b[40:]) != vectorFramingSync {
+			return nil, errInvalidPacket
+		}
+		return &syncPacket{
+			cid:         cid,
+			sequence:    b[44],
+			syncAddress: binary.BigEndian.Uint16(b[45:]),
+		}, nil
+	default:
+		return nil, errInvalidPacket
+	}
+}
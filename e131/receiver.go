@@ -0,0 +1,326 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package e131 implements an E1.31 (Streaming ACN, sACN) receiver that
+// drives the channels of a WS2811 device from a lighting console.
+//
+// The receiver maps DMX universes onto LEDs, listens for unicast and,
+// optionally, multicast packets, follows the priority of the sources, honours
+// synchronization packets and handles the loss of sources.
+package e131
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/internal/dmx"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	// DefaultPort is the UDP port of E1.31
+	DefaultPort = 5568
+	// DefaultSourceTimeout is the time after which a silent source is
+	// considered lost (E131_NETWORK_DATA_LOSS_TIMEOUT)
+	DefaultSourceTimeout = 2500 * time.Millisecond
+	// DefaultSyncTimeout is the time after which the data waiting for a
+	// synchronization packet is rendered without it
+	// (E131_NETWORK_DATA_LOSS_TIMEOUT)
+	DefaultSyncTimeout = 2500 * time.Millisecond
+
+	// pollInterval is the maximum time between two checks for lost sources
+	pollInterval = 100 * time.Millisecond
+)
+
+// Universe maps a DMX universe onto consecutive LEDs of a channel.
+type Universe = dmx.Universe
+
+// Universes returns the consecutive universes, starting with first, needed
+// to cover all the LEDs of a channel.
+func Universes(first uint16, channel int, opt ws2811.ChannelOption) []Universe {
+	return dmx.Split(first, channel, opt.LedCount, ws2811.StripeComponents(opt.StripeType))
+}
+
+// Config is the configuration of a Receiver.
+type Config struct {
+	// Addr is the UDP address to listen on (default ":5568")
+	Addr string
+	// Multicast joins the multicast group of every universe
+	Multicast bool
+	// Interface is the network interface used to join the multicast groups,
+	// nil for the system default
+	Interface *net.Interface
+	// Universes are the universes to receive
+	Universes []Universe
+	// SourceTimeout is the time after which a silent source is dropped
+	// (default DefaultSourceTimeout)
+	SourceTimeout time.Duration
+	// Blackout turns the LEDs of a universe off when its last source is lost.
+	// Otherwise the last frame is held.
+	Blackout bool
+	// SyncTimeout is the time to wait for a synchronization packet (default
+	// DefaultSyncTimeout). When it is exceeded, the data is rendered at once
+	// until a synchronization packet is received again.
+	SyncTimeout time.Duration
+	// OnError, if not nil, is called with the render errors of the device,
+	// which do not stop the receiver. They are logged by default.
+	OnError func(error)
+}
+
+// Receiver receives E1.31 packets and renders them on a device.
+type Receiver struct {
+	dev       ws2811.Device
+	cfg       Config
+	universes map[uint16]*universe
+	// pending holds the synchronization addresses of the received data
+	// waiting for a synchronization packet, with the time of the first data
+	pending map[uint16]time.Time
+	// unsynced holds the synchronization addresses whose synchronization
+	// packets did not come within SyncTimeout
+	unsynced map[uint16]bool
+
+	mu     sync.Mutex
+	conn   net.PacketConn
+	closed bool
+}
+
+type universe struct {
+	Universe
+	sources map[[16]byte]*source
+}
+
+type source struct {
+	priority uint8
+	sequence uint8
+	seen     time.Time
+}
+
+// MakeReceiver creates a receiver for a device. The device must be initialized.
+// The universes of channels that the device does not have are ignored.
+func MakeReceiver(dev ws2811.Device, cfg Config) *Receiver {
+	if cfg.Addr == "" {
+		cfg.Addr = fmt.Sprintf(":%d", DefaultPort)
+	}
+	if cfg.SourceTimeout <= 0 {
+		cfg.SourceTimeout = DefaultSourceTimeout
+	}
+	if cfg.SyncTimeout <= 0 {
+		cfg.SyncTimeout = DefaultSyncTimeout
+	}
+	r := &Receiver{
+		dev:       dev,
+		cfg:       cfg,
+		universes: make(map[uint16]*universe),
+		pending:   make(map[uint16]time.Time),
+		unsynced:  make(map[uint16]bool),
+	}
+	for _, u := range cfg.Universes {
+		if u.Channel < 0 || u.Channel >= ws2811.RpiPwmChannels {
+			continue
+		}
+		r.universes[u.Number] = &universe{Universe: u, sources: make(map[[16]byte]*source)}
+	}
+	return r
+}
+
+// MulticastGroup returns the multicast address of a universe.
+func MulticastGroup(universe uint16) net.IP {
+	return net.IPv4(239, 255, byte(universe>>8), byte(universe))
+}
+
+// ListenAndServe listens on the configured address, joins the multicast
+// groups if needed and serves the packets until Close is called.
+func (r *Receiver) ListenAndServe() error {
+	conn, err := net.ListenPacket("udp4", r.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	if r.cfg.Multicast {
+		p := ipv4.NewPacketConn(conn)
+		for number := range r.universes {
+			err := p.JoinGroup(r.cfg.Interface, &net.UDPAddr{IP: MulticastGroup(number)})
+			if err != nil {
+				conn.Close()
+				return fmt.Errorf("error joining multicast group of universe %d: %v", number, err)
+			}
+		}
+	}
+	return r.Serve(conn)
+}
+
+// Serve reads the packets from conn until Close is called. Serve closes conn
+// when it returns. The render errors of the device are passed to
+// Config.OnError.
+func (r *Receiver) Serve(conn net.PacketConn) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		conn.Close()
+		return net.ErrClosed
+	}
+	r.conn = conn
+	r.mu.Unlock()
+	defer conn.Close()
+
+	buf := make([]byte, 1500)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(pollInterval)); err != nil {
+			return err
+		}
+		n, _, err := conn.ReadFrom(buf)
+		now := time.Now()
+		if err != nil {
+			var ne net.Error
+			if !errors.As(err, &ne) || !ne.Timeout() {
+				if r.isClosed() {
+					return nil
+				}
+				return err
+			}
+		} else {
+			r.error(r.handle(buf[:n], now))
+		}
+		r.expire(now)
+	}
+}
+
+// Close stops the receiver.
+func (r *Receiver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.conn != nil {
+		return r.conn.Close()
+	}
+	return nil
+}
+
+func (r *Receiver) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+func (r *Receiver) error(err error) {
+	if err == nil {
+		return
+	}
+	if r.cfg.OnError != nil {
+		r.cfg.OnError(err)
+		return
+	}
+	log.Printf("e131: %v", err)
+}
+
+// handle processes a packet. Invalid packets are ignored; only errors of the
+// device are returned.
+func (r *Receiver) handle(b []byte, now time.Time) error {
+	p, err := parsePacket(b)
+	if err != nil {
+		return nil
+	}
+	switch p := p.(type) {
+	case *dataPacket:
+		return r.handleData(p, now)
+	case *syncPacket:
+		delete(r.unsynced, p.syncAddress)
+		if _, ok := r.pending[p.syncAddress]; ok {
+			delete(r.pending, p.syncAddress)
+			return r.dev.Render()
+		}
+	}
+	return nil
+}
+
+func (r *Receiver) handleData(p *dataPacket, now time.Time) error {
+	u, ok := r.universes[p.universe]
+	if !ok || p.options&optionPreview != 0 || p.startCode != 0 {
+		return nil
+	}
+
+	src, known := u.sources[p.cid]
+	if p.options&optionTerminated != 0 {
+		if known {
+			delete(u.sources, p.cid)
+			return r.lost(u)
+		}
+		return nil
+	}
+	if known {
+		// discard late packets (E1.31 6.7.2)
+		if diff := int8(p.sequence - src.sequence); diff <= 0 && diff > -20 {
+			return nil
+		}
+	} else {
+		src = &source{}
+		u.sources[p.cid] = src
+	}
+	src.priority = p.priority
+	src.sequence = p.sequence
+	src.seen = now
+
+	// only the sources with the highest priority are used
+	for _, other := range u.sources {
+		if other.priority > p.priority {
+			return nil
+		}
+	}
+
+	u.Write(r.dev.Leds(u.Channel), p.slots)
+	if p.syncAddress != 0 && !r.unsynced[p.syncAddress] {
+		if _, ok := r.pending[p.syncAddress]; !ok {
+			r.pending[p.syncAddress] = now
+		}
+		return nil
+	}
+	return r.dev.Render()
+}
+
+// expire drops the sources that have been silent for too long, and renders
+// the data that has waited too long for a synchronization packet.
+func (r *Receiver) expire(now time.Time) {
+	for _, u := range r.universes {
+		dropped := false
+		for cid, src := range u.sources {
+			if now.Sub(src.seen) > r.cfg.SourceTimeout {
+				delete(u.sources, cid)
+				dropped = true
+			}
+		}
+		if dropped {
+			r.error(r.lost(u))
+		}
+	}
+	for address, since := range r.pending {
+		if now.Sub(since) > r.cfg.SyncTimeout {
+			delete(r.pending, address)
+			r.unsynced[address] = true
+			r.error(r.dev.Render())
+		}
+	}
+}
+
+// lost is called when a source of a universe is lost.
+func (r *Receiver) lost(u *universe) error {
+	if len(u.sources) > 0 || !r.cfg.Blackout {
+		return nil
+	}
+	u.Clear(r.dev.Leds(u.Channel))
+	return r.dev.Render()
+}
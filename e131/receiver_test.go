@@ -0,0 +1,244 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e131
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// device is a simulated device that reports renders.
+type device struct {
+	*ws2811.WS2811
+	rendered chan []uint32
+	fail     atomic.Bool
+}
+
+func (d *device) Render() error {
+	if d.fail.Load() {
+		return errors.New("render failed")
+	}
+	d.rendered <- append([]uint32(nil), d.Leds(0)...)
+	return nil
+}
+
+func newDevice(t *testing.T, ledCount int) *device {
+	ws, err := ws2811.MakeWS2811(&ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: ledCount}}})
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	return &device{WS2811: ws, rendered: make(chan []uint32, 16)}
+}
+
+func dataPacketBytes(cid byte, universe uint16, priority, seq, options uint8, sync uint16, slots []byte) []byte {
+	b := make([]byte, dataHeaderLen+len(slots))
+	binary.BigEndian.PutUint16(b[0:], 0x0010)
+	copy(b[4:], acnPacketIdentifier)
+	binary.BigEndian.PutUint16(b[16:], 0x7000|uint16(len(b)-16))
+	binary.BigEndian.PutUint32(b[18:], vectorRootData)
+	b[22] = cid
+	binary.BigEndian.PutUint16(b[38:], 0x7000|uint16(len(b)-38))
+	binary.BigEndian.PutUint32(b[40:], vectorFramingData)
+	copy(b[44:], "test")
+	b[108] = priority
+	binary.BigEndian.PutUint16(b[109:], sync)
+	b[111] = seq
+	b[112] = options
+	binary.BigEndian.PutUint16(b[113:], universe)
+	binary.BigEndian.PutUint16(b[115:], 0x7000|uint16(len(b)-115))
+	b[117] = vectorDMPSetProp
+	b[118] = 0xa1
+	binary.BigEndian.PutUint16(b[121:], 1)
+	binary.BigEndian.PutUint16(b[123:], uint16(len(slots)+1))
+	copy(b[dataHeaderLen:], slots)
+	return b
+}
+
+func syncPacketBytes(cid byte, seq uint8, sync uint16) []byte {
+	b := make([]byte, syncLen)
+	binary.BigEndian.PutUint16(b[0:], 0x0010)
+	copy(b[4:], acnPacketIdentifier)
+	binary.BigEndian.PutUint16(b[16:], 0x7000|uint16(len(b)-16))
+	binary.BigEndian.PutUint32(b[18:], vectorRootExtended)
+	b[22] = cid
+	binary.BigEndian.PutUint16(b[38:], 0x7000|uint16(len(b)-38))
+	binary.BigEndian.PutUint32(b[40:], vectorFramingSync)
+	b[44] = seq
+	binary.BigEndian.PutUint16(b[45:], sync)
+	return b
+}
+
+func startReceiver(t *testing.T, dev ws2811.Device, cfg Config) (*Receiver, net.Conn) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.Nil(t, err)
+	r := MakeReceiver(dev, cfg)
+	go r.Serve(conn) // nolint: errcheck
+	client, err := net.Dial("udp4", conn.LocalAddr().String())
+	assert.Nil(t, err)
+	return r, client
+}
+
+func expectFrame(t *testing.T, dev *device, want []uint32) {
+	select {
+	case got := <-dev.rendered:
+		assert.Equal(t, want, got)
+	case <-time.After(time.Second):
+		t.Fatal("no frame rendered")
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	dev := newDevice(t, 4)
+	r, client := startReceiver(t, dev, Config{
+		Universes: []Universe{{Number: 1, Channel: 0, Start: 1}},
+	})
+	defer r.Close()
+	defer client.Close()
+
+	client.Write(dataPacketBytes(1, 1, 100, 1, 0, 0, []byte{1, 2, 3, 4, 5, 6})) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0, 0x010203, 0x040506, 0})
+
+	// late packet is discarded, the next one is rendered
+	client.Write(dataPacketBytes(1, 1, 100, 0, 0, 0, []byte{9, 9, 9})) // nolint: errcheck
+	client.Write(dataPacketBytes(1, 1, 100, 2, 0, 0, []byte{7, 8, 9})) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0, 0x070809, 0x040506, 0})
+
+	// a source with a higher priority takes over
+	client.Write(dataPacketBytes(2, 1, 150, 1, 0, 0, []byte{0xff, 0, 0})) // nolint: errcheck
+	client.Write(dataPacketBytes(1, 1, 100, 3, 0, 0, []byte{1, 1, 1}))    // nolint: errcheck
+	client.Write(dataPacketBytes(2, 1, 150, 2, 0, 0, []byte{0, 0xff, 0})) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0, 0xff0000, 0x040506, 0})
+	expectFrame(t, dev, []uint32{0, 0x00ff00, 0x040506, 0})
+
+	// other universes are ignored
+	client.Write(dataPacketBytes(2, 2, 150, 3, 0, 0, []byte{1, 1, 1})) // nolint: errcheck
+	client.Write(dataPacketBytes(2, 1, 150, 4, 0, 0, []byte{2, 2, 2})) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0, 0x020202, 0x040506, 0})
+}
+
+func TestReceiverSync(t *testing.T) {
+	dev := newDevice(t, 2)
+	r, client := startReceiver(t, dev, Config{
+		Universes: []Universe{{Number: 1, Count: 1}, {Number: 2, Start: 1}},
+	})
+	defer r.Close()
+	defer client.Close()
+
+	client.Write(dataPacketBytes(1, 1, 100, 1, 0, 7, []byte{1, 1, 1})) // nolint: errcheck
+	client.Write(dataPacketBytes(1, 2, 100, 1, 0, 7, []byte{2, 2, 2})) // nolint: errcheck
+	client.Write(syncPacketBytes(1, 1, 7))                             // nolint: errcheck
+	expectFrame(t, dev, []uint32{0x010101, 0x020202})
+}
+
+func TestReceiverSyncTimeout(t *testing.T) {
+	dev := newDevice(t, 1)
+	r, client := startReceiver(t, dev, Config{
+		Universes:   []Universe{{Number: 1}},
+		SyncTimeout: 50 * time.Millisecond,
+	})
+	defer r.Close()
+	defer client.Close()
+
+	// without synchronization packets, the data is rendered after the timeout
+	start := time.Now()
+	client.Write(dataPacketBytes(1, 1, 100, 1, 0, 7, []byte{1, 1, 1})) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0x010101})
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	// and then at once
+	client.Write(dataPacketBytes(1, 1, 100, 2, 0, 7, []byte{2, 2, 2})) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0x020202})
+
+	// until a synchronization packet comes back
+	client.Write(syncPacketBytes(1, 1, 7))                             // nolint: errcheck
+	client.Write(dataPacketBytes(1, 1, 100, 3, 0, 7, []byte{3, 3, 3})) // nolint: errcheck
+	client.Write(syncPacketBytes(1, 2, 7))                             // nolint: errcheck
+	expectFrame(t, dev, []uint32{0x030303})
+}
+
+func TestReceiverRenderError(t *testing.T) {
+	dev := newDevice(t, 1)
+	errs := make(chan error, 1)
+	r, client := startReceiver(t, dev, Config{
+		Universes: []Universe{{Number: 1}},
+		OnError:   func(err error) { errs <- err },
+	})
+	defer r.Close()
+	defer client.Close()
+
+	dev.fail.Store(true)
+	client.Write(dataPacketBytes(1, 1, 100, 1, 0, 0, []byte{1, 1, 1})) // nolint: errcheck
+	select {
+	case err := <-errs:
+		assert.EqualError(t, err, "render failed")
+	case <-time.After(time.Second):
+		t.Fatal("no error reported")
+	}
+
+	// the receiver keeps serving
+	dev.fail.Store(false)
+	client.Write(dataPacketBytes(1, 1, 100, 2, 0, 0, []byte{2, 2, 2})) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0x020202})
+}
+
+func TestReceiverMissingChannel(t *testing.T) {
+	dev := newDevice(t, 1)
+	r, client := startReceiver(t, dev, Config{
+		Universes: []Universe{{Number: 1}, {Number: 2, Channel: ws2811.RpiPwmChannels}, {Number: 3, Channel: -1}},
+	})
+	defer r.Close()
+	defer client.Close()
+
+	// the universes of missing channels are ignored
+	client.Write(dataPacketBytes(1, 2, 100, 1, 0, 0, []byte{2, 2, 2})) // nolint: errcheck
+	client.Write(dataPacketBytes(1, 3, 100, 1, 0, 0, []byte{3, 3, 3})) // nolint: errcheck
+	client.Write(dataPacketBytes(1, 1, 100, 1, 0, 0, []byte{1, 1, 1})) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0x010101})
+}
+
+func TestReceiverSourceTimeout(t *testing.T) {
+	dev := newDevice(t, 2)
+	r, client := startReceiver(t, dev, Config{
+		Universes:     []Universe{{Number: 1}},
+		SourceTimeout: 50 * time.Millisecond,
+		Blackout:      true,
+	})
+	defer r.Close()
+	defer client.Close()
+
+	client.Write(dataPacketBytes(1, 1, 100, 1, 0, 0, []byte{1, 1, 1, 2, 2, 2})) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0x010101, 0x020202})
+	expectFrame(t, dev, []uint32{0, 0})
+
+	// terminated streams are dropped at once
+	client.Write(dataPacketBytes(1, 1, 100, 2, 0, 0, []byte{1, 1, 1}))                // nolint: errcheck
+	client.Write(dataPacketBytes(1, 1, 100, 3, optionTerminated, 0, []byte{1, 1, 1})) // nolint: errcheck
+	expectFrame(t, dev, []uint32{0x010101, 0})
+	expectFrame(t, dev, []uint32{0, 0})
+}
+
+func TestUniverses(t *testing.T) {
+	u := Universes(10, 1, ws2811.ChannelOption{LedCount: 300, StripeType: ws2811.SK6812StripGRBW})
+	assert.Equal(t, []Universe{
+		{Number: 10, Channel: 1, Start: 0, Count: 128, Components: 4},
+		{Number: 11, Channel: 1, Start: 128, Count: 128, Components: 4},
+		{Number: 12, Channel: 1, Start: 256, Count: 44, Components: 4},
+	}, u)
+}
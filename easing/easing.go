@@ -0,0 +1,112 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package easing provides easing functions. An easing function maps the
+// progress of an animation, from 0 to 1, to the progress of the animated
+// value, also from 0 (start) to 1 (end).
+package easing
+
+import (
+	"fmt"
+	"math"
+)
+
+// Func is an easing function.
+type Func func(p float64) float64
+
+// Linear progresses at a constant speed.
+func Linear(p float64) float64 {
+	return p
+}
+
+// InQuad starts slowly and accelerates.
+func InQuad(p float64) float64 {
+	return p * p
+}
+
+// OutQuad starts fast and decelerates.
+func OutQuad(p float64) float64 {
+	return 1 - (1-p)*(1-p)
+}
+
+// InOutQuad accelerates until half-way, then decelerates.
+func InOutQuad(p float64) float64 {
+	if p < 0.5 {
+		return 2 * p * p
+	}
+	return 1 - 2*(1-p)*(1-p)
+}
+
+// InCubic starts slowly and accelerates, more sharply than InQuad.
+func InCubic(p float64) float64 {
+	return p * p * p
+}
+
+// OutCubic starts fast and decelerates, more sharply than OutQuad.
+func OutCubic(p float64) float64 {
+	return 1 - math.Pow(1-p, 3)
+}
+
+// InOutCubic accelerates until half-way, then decelerates.
+func InOutCubic(p float64) float64 {
+	if p < 0.5 {
+		return 4 * p * p * p
+	}
+	return 1 - math.Pow(-2*p+2, 3)/2
+}
+
+// InOutSine follows a sine wave, the smoothest of the in-out functions.
+func InOutSine(p float64) float64 {
+	return -(math.Cos(math.Pi*p) - 1) / 2
+}
+
+// Clamp limits p to the range 0 to 1.
+func Clamp(p float64) float64 {
+	return math.Max(0, math.Min(1, p))
+}
+
+// Step jumps to the end value at the end of the animation.
+func Step(p float64) float64 {
+	if p >= 1 {
+		return 1
+	}
+	return 0
+}
+
+// byName maps the names of the easing functions to the functions.
+// nolint: gochecknoglobals
+var byName = map[string]Func{
+	"linear":       Linear,
+	"step":         Step,
+	"in-quad":      InQuad,
+	"out-quad":     OutQuad,
+	"in-out-quad":  InOutQuad,
+	"in-cubic":     InCubic,
+	"out-cubic":    OutCubic,
+	"in-out-cubic": InOutCubic,
+	"in-out-sine":  InOutSine,
+}
+
+// ByName returns the easing function with the given name, for instance
+// "linear" or "in-out-cubic". The empty name is Linear.
+func ByName(name string) (Func, error) {
+	if name == "" {
+		return Linear, nil
+	}
+	f, ok := byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown easing function %q", name)
+	}
+	return f, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package easing
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestByName(t *testing.T) {
+	cases := []struct {
+		name string
+		f    Func
+	}{
+		{"", Linear},
+		{"linear", Linear},
+		{"step", Step},
+		{"in-quad", InQuad},
+		{"out-quad", OutQuad},
+		{"in-out-quad", InOutQuad},
+		{"in-cubic", InCubic},
+		{"out-cubic", OutCubic},
+		{"in-out-cubic", InOutCubic},
+		{"in-out-sine", InOutSine},
+	}
+	for _, c := range cases {
+		f, err := ByName(c.name)
+		assert.Nil(t, err, c.name)
+		assert.Equal(t, reflect.ValueOf(c.f).Pointer(), reflect.ValueOf(f).Pointer(), c.name)
+	}
+
+	for _, name := range []string{"bounce", "Linear", " linear"} {
+		f, err := ByName(name)
+		assert.NotNil(t, err, name)
+		assert.Nil(t, f, name)
+	}
+}
+
+func TestBounds(t *testing.T) {
+	for name, f := range byName {
+		assert.InDelta(t, 0, f(0), 1e-9, name)
+		assert.InDelta(t, 1, f(1), 1e-9, name)
+	}
+	assert.Equal(t, 0.0, Clamp(-1))
+	assert.Equal(t, 0.5, Clamp(0.5))
+	assert.Equal(t, 1.0, Clamp(2))
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package effects
+
+import (
+	"math"
+	"time"
+)
+
+// Solid sets all LEDs to the same color.
+type Solid struct {
+	Color uint32
+}
+
+// Render implements Effect.
+func (e *Solid) Render(leds []uint32, t time.Duration) {
+	Fill(leds, e.Color)
+}
+
+// ColorWipe lights the LEDs one after the other with the same color.
+type ColorWipe struct {
+	// Color is the color of the wipe
+	Color uint32
+	// Background is the color of the LEDs not reached yet
+	Background uint32
+	// Step is the time between two LEDs (default 50ms)
+	Step time.Duration
+}
+
+// Render implements Effect.
+func (e *ColorWipe) Render(leds []uint32, t time.Duration) {
+	lit := int(t/durationOr(e.Step, 50*time.Millisecond)) + 1
+	for i := range leds {
+		if i < lit {
+			leds[i] = e.Color
+		} else {
+			leds[i] = e.Background
+		}
+	}
+}
+
+// Rainbow spreads the whole color wheel over the LEDs and rotates it.
+type Rainbow struct {
+	// Period is the time for a full rotation of the wheel (default 5s)
+	Period time.Duration
+}
+
+// Render implements Effect.
+func (e *Rainbow) Render(leds []uint32, t time.Duration) {
+	period := durationOr(e.Period, 5*time.Second)
+	offset := int((t % period) * 256 / period)
+	for i := range leds {
+		leds[i] = Wheel(uint8(i*256/len(leds) + offset))
+	}
+}
+
+// TheaterChase lights every Spacing-th LED and moves the pattern along the
+// strip, like the marquee lights of a theater.
+type TheaterChase struct {
+	// Color is the color of the lit LEDs
+	Color uint32
+	// Background is the color of the other LEDs
+	Background uint32
+	// Spacing is the distance between two lit LEDs (default 3)
+	Spacing int
+	// Step is the time between two moves (default 50ms)
+	Step time.Duration
+}
+
+// Render implements Effect.
+func (e *TheaterChase) Render(leds []uint32, t time.Duration) {
+	spacing := intOr(e.Spacing, 3)
+	offset := int(t/durationOr(e.Step, 50*time.Millisecond)) % spacing
+	for i := range leds {
+		if i%spacing == offset {
+			leds[i] = e.Color
+		} else {
+			leds[i] = e.Background
+		}
+	}
+}
+
+// Breathing slowly fades all LEDs in and out.
+type Breathing struct {
+	// Color is the color at full brightness
+	Color uint32
+	// Period is the duration of a full breath (default 4s)
+	Period time.Duration
+}
+
+// Render implements Effect.
+func (e *Breathing) Render(leds []uint32, t time.Duration) {
+	period := durationOr(e.Period, 4*time.Second)
+	phase := float64(t%period) / float64(period)
+	level := (1 - math.Cos(2*math.Pi*phase)) / 2
+	Fill(leds, Scale(e.Color, uint8(math.Round(level*255))))
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package effects
+
+// Colors use the layout of the LEDs array of the C library: 0xWWRRGGBB.
+
+// RGB returns the color made of the given red, green and blue components.
+func RGB(r, g, b uint8) uint32 {
+	return uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+}
+
+// RGBW returns the color made of the given red, green, blue and white components.
+func RGBW(r, g, b, w uint8) uint32 {
+	return uint32(w)<<24 | RGB(r, g, b)
+}
+
+// Split returns the red, green, blue and white components of a color.
+func Split(c uint32) (r, g, b, w uint8) {
+	return uint8(c >> 16), uint8(c >> 8), uint8(c), uint8(c >> 24)
+}
+
+// Scale multiplies all components of a color by level/255.
+func Scale(c uint32, level uint8) uint32 {
+	r, g, b, w := Split(c)
+	l := uint32(level)
+	return RGBW(
+		uint8(uint32(r)*l/255),
+		uint8(uint32(g)*l/255),
+		uint8(uint32(b)*l/255),
+		uint8(uint32(w)*l/255),
+	)
+}
+
+// Wheel returns a color of the rainbow. The colors transition
+// red -> green -> blue -> red as pos goes from 0 to 255.
+func Wheel(pos uint8) uint32 {
+	switch {
+	case pos < 85:
+		return RGB(255-pos*3, pos*3, 0)
+	case pos < 170:
+		pos -= 85
+		return RGB(0, 255-pos*3, pos*3)
+	default:
+		pos -= 170
+		return RGB(pos*3, 0, 255-pos*3)
+	}
+}
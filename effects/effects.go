@@ -0,0 +1,120 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package effects provides classic LED animations. Effects render into any
+// []uint32 buffer, such as the LEDs array of a channel or a sub-slice of it
+// (a segment), and are deterministic: an effect rendered at a given time into
+// a buffer of a given size always produces the same frame. The effects that
+// use randomness take a seed.
+package effects
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Effect renders an animation frame into a LED buffer.
+type Effect interface {
+	// Render draws the frame at time t (relative to the start of the
+	// animation) into leds.
+	Render(leds []uint32, t time.Duration)
+}
+
+// EffectFunc is an adapter to use an ordinary function as an Effect.
+type EffectFunc func(leds []uint32, t time.Duration)
+
+// Render calls f(leds, t).
+func (f EffectFunc) Render(leds []uint32, t time.Duration) {
+	f(leds, t)
+}
+
+// registry maps the effect names to a constructor with default parameters.
+// nolint: gochecknoglobals
+var registry = map[string]func() Effect{
+	"solid":         func() Effect { return &Solid{Color: 0xffffff} },
+	"color-wipe":    func() Effect { return &ColorWipe{Color: 0xff0000} },
+	"rainbow":       func() Effect { return &Rainbow{} },
+	"theater-chase": func() Effect { return &TheaterChase{Color: 0xffffff} },
+	"fire":          func() Effect { return &Fire{} },
+	"twinkle":       func() Effect { return &Twinkle{Color: 0xffffff} },
+	"comet":         func() Effect { return &Comet{Color: 0x00ffff} },
+	"breathing":     func() Effect { return &Breathing{Color: 0x0000ff} },
+	"larson":        func() Effect { return &Larson{Color: 0xff0000} },
+}
+
+// Names returns the sorted names of the registered effects.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns a new instance of a registered effect with its default
+// parameters.
+func New(name string) (Effect, error) {
+	ctor, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown effect %q", name)
+	}
+	return ctor(), nil
+}
+
+// Fill sets all LEDs to the same color.
+func Fill(leds []uint32, color uint32) {
+	for i := range leds {
+		leds[i] = color
+	}
+}
+
+// durationOr returns d, or def if d is not positive.
+func durationOr(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+// intOr returns v, or def if v is not positive.
+func intOr(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+// WithColor sets the main color of the effects that have one, and returns
+// the effect. The other effects are returned unchanged.
+func WithColor(e Effect, color uint32) Effect {
+	switch e := e.(type) {
+	case *Solid:
+		e.Color = color
+	case *ColorWipe:
+		e.Color = color
+	case *TheaterChase:
+		e.Color = color
+	case *Twinkle:
+		e.Color = color
+	case *Comet:
+		e.Color = color
+	case *Breathing:
+		e.Color = color
+	case *Larson:
+		e.Color = color
+	}
+	return e
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package effects
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeterministic(t *testing.T) {
+	for _, name := range Names() {
+		a, err := New(name)
+		assert.Nil(t, err)
+		b, err := New(name)
+		assert.Nil(t, err)
+
+		la := make([]uint32, 30)
+		lb := make([]uint32, 30)
+		// a is rendered frame by frame, b jumps directly to the last frame
+		for ts := time.Duration(0); ts <= time.Second; ts += 10 * time.Millisecond {
+			a.Render(la, ts)
+		}
+		b.Render(lb, time.Second)
+		assert.Equal(t, la, lb, name)
+
+		// rendering an earlier time again gives the same frame
+		a.Render(la, 500*time.Millisecond)
+		b.Render(lb, 500*time.Millisecond)
+		assert.Equal(t, la, lb, name)
+	}
+}
+
+func TestUnknownEffect(t *testing.T) {
+	_, err := New("nope")
+	assert.NotNil(t, err)
+}
+
+func TestColorWipe(t *testing.T) {
+	leds := make([]uint32, 4)
+	e := &ColorWipe{Color: 1, Background: 2, Step: time.Second}
+	e.Render(leds, 1500*time.Millisecond)
+	assert.Equal(t, []uint32{1, 1, 2, 2}, leds)
+	e.Render(leds, time.Hour)
+	assert.Equal(t, []uint32{1, 1, 1, 1}, leds)
+}
+
+func TestTheaterChase(t *testing.T) {
+	leds := make([]uint32, 6)
+	e := &TheaterChase{Color: 1, Step: time.Second}
+	e.Render(leds, time.Second)
+	assert.Equal(t, []uint32{0, 1, 0, 0, 1, 0}, leds)
+}
+
+func TestLarson(t *testing.T) {
+	leds := make([]uint32, 4)
+	e := &Larson{Color: 0xff, Width: 2, Step: time.Second}
+	e.Render(leds, 2*time.Second)
+	assert.Equal(t, []uint32{0, 0x7f, 0xff, 0}, leds)
+	// bounces back
+	e.Render(leds, 4*time.Second)
+	assert.Equal(t, []uint32{0, 0, 0xff, 0x7f}, leds)
+}
+
+func TestSeed(t *testing.T) {
+	a := make([]uint32, 30)
+	b := make([]uint32, 30)
+	(&Fire{Seed: 1}).Render(a, time.Second)
+	(&Fire{Seed: 2}).Render(b, time.Second)
+	assert.NotEqual(t, a, b)
+}
+
+func TestWheel(t *testing.T) {
+	assert.Equal(t, uint32(0xff0000), Wheel(0))
+	assert.Equal(t, uint32(0x00ff00), Wheel(85))
+	assert.Equal(t, uint32(0x0000ff), Wheel(170))
+}
@@ -0,0 +1,160 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package effects
+
+import (
+	"math/rand"
+	"time"
+)
+
+// simulation runs a frame based simulation so that it can be rendered at any
+// time. Frames are computed at a fixed interval from a seeded random source;
+// rendering a time before the last computed frame, or into a buffer of another
+// size, restarts the simulation from the seed.
+type simulation struct {
+	rng   *rand.Rand
+	frame int64
+	size  int
+}
+
+// advance computes the frames up to time t. reset is called to start the
+// simulation over and step to compute the next frame.
+func (s *simulation) advance(t, interval time.Duration, seed int64, size int,
+	reset func(), step func(rng *rand.Rand)) {
+	target := int64(t / interval)
+	if s.rng == nil || target < s.frame || size != s.size {
+		s.rng = rand.New(rand.NewSource(seed)) // nolint: gosec
+		s.frame = -1
+		s.size = size
+		reset()
+	}
+	for s.frame < target {
+		step(s.rng)
+		s.frame++
+	}
+}
+
+// Fire simulates flames rising from the start of the strip (the Fire2012
+// algorithm).
+type Fire struct {
+	// Cooling is how much the air cools as it rises (default 55)
+	Cooling int
+	// Sparking is the chance (out of 255) that a new spark is lit (default 120)
+	Sparking int
+	// Interval is the time between two simulation steps (default 16ms)
+	Interval time.Duration
+	// Seed is the seed of the random source
+	Seed int64
+
+	sim  simulation
+	heat []int
+}
+
+// Render implements Effect.
+func (e *Fire) Render(leds []uint32, t time.Duration) {
+	n := len(leds)
+	cooling := intOr(e.Cooling, 55)
+	sparking := intOr(e.Sparking, 120)
+	e.sim.advance(t, durationOr(e.Interval, 16*time.Millisecond), e.Seed, n,
+		func() { e.heat = make([]int, n) },
+		func(rng *rand.Rand) {
+			if n == 0 {
+				return
+			}
+			// cool down every cell a little
+			for i := range e.heat {
+				e.heat[i] -= rng.Intn(cooling*10/n + 2)
+				if e.heat[i] < 0 {
+					e.heat[i] = 0
+				}
+			}
+			// heat drifts up and diffuses
+			for k := n - 1; k >= 2; k-- {
+				e.heat[k] = (e.heat[k-1] + 2*e.heat[k-2]) / 3
+			}
+			// randomly ignite new sparks near the bottom
+			if rng.Intn(255) < sparking {
+				y := rng.Intn(7)
+				if y >= n {
+					y = n - 1
+				}
+				e.heat[y] += 160 + rng.Intn(96)
+				if e.heat[y] > 255 {
+					e.heat[y] = 255
+				}
+			}
+		})
+	for i := range leds {
+		leds[i] = heatColor(e.heat[i])
+	}
+}
+
+// heatColor maps a temperature between 0 and 255 to a black body color.
+func heatColor(heat int) uint32 {
+	t := heat * 191 / 255
+	ramp := uint8((t & 0x3f) << 2)
+	switch {
+	case t&0x80 != 0:
+		return RGB(255, 255, ramp)
+	case t&0x40 != 0:
+		return RGB(255, ramp, 0)
+	default:
+		return RGB(ramp, 0, 0)
+	}
+}
+
+// Twinkle randomly lights LEDs that then slowly fade out.
+type Twinkle struct {
+	// Color is the color of a LED when it lights up
+	Color uint32
+	// Density is the probability that a dark LED lights up at each step (default 0.02)
+	Density float64
+	// Fade is the brightness lost by a LED at each step (default 8)
+	Fade int
+	// Interval is the time between two steps (default 20ms)
+	Interval time.Duration
+	// Seed is the seed of the random source
+	Seed int64
+
+	sim    simulation
+	levels []int
+}
+
+// Render implements Effect.
+func (e *Twinkle) Render(leds []uint32, t time.Duration) {
+	n := len(leds)
+	density := e.Density
+	if density <= 0 {
+		density = 0.02
+	}
+	fade := intOr(e.Fade, 8)
+	e.sim.advance(t, durationOr(e.Interval, 20*time.Millisecond), e.Seed, n,
+		func() { e.levels = make([]int, n) },
+		func(rng *rand.Rand) {
+			for i := range e.levels {
+				if e.levels[i] > 0 {
+					e.levels[i] -= fade
+					if e.levels[i] < 0 {
+						e.levels[i] = 0
+					}
+				} else if rng.Float64() < density {
+					e.levels[i] = 255
+				}
+			}
+		})
+	for i := range leds {
+		leds[i] = Scale(e.Color, uint8(e.levels[i]))
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package effects
+
+import "time"
+
+// Comet moves a LED with a fading tail along the strip and wraps around at
+// the end.
+type Comet struct {
+	// Color is the color of the head
+	Color uint32
+	// Length is the length of the tail, head included (default 8)
+	Length int
+	// Step is the time between two moves (default 20ms)
+	Step time.Duration
+}
+
+// Render implements Effect.
+func (e *Comet) Render(leds []uint32, t time.Duration) {
+	n := len(leds)
+	if n == 0 {
+		return
+	}
+	Fill(leds, 0)
+	length := intOr(e.Length, 8)
+	head := int(t/durationOr(e.Step, 20*time.Millisecond)) % n
+	drawTail(leds, e.Color, head, 1, length, true)
+}
+
+// Larson is the Larson scanner (a.k.a. Cylon or KITT): a LED with a fading
+// tail bouncing between both ends of the strip.
+type Larson struct {
+	// Color is the color of the eye
+	Color uint32
+	// Width is the length of the tail, eye included (default 4)
+	Width int
+	// Step is the time between two moves (default 30ms)
+	Step time.Duration
+}
+
+// Render implements Effect.
+func (e *Larson) Render(leds []uint32, t time.Duration) {
+	n := len(leds)
+	if n == 0 {
+		return
+	}
+	Fill(leds, 0)
+	width := intOr(e.Width, 4)
+	if n == 1 {
+		leds[0] = e.Color
+		return
+	}
+	period := 2 * (n - 1)
+	pos := int(t/durationOr(e.Step, 30*time.Millisecond)) % period
+	dir := 1
+	if pos >= n-1 {
+		pos = period - pos
+		dir = -1
+	}
+	drawTail(leds, e.Color, pos, dir, width, false)
+}
+
+// drawTail draws a LED at head and a tail fading over length LEDs behind it,
+// opposite to the direction dir. The tail wraps around if wrap is set and is
+// clipped otherwise.
+func drawTail(leds []uint32, color uint32, head, dir, length int, wrap bool) {
+	n := len(leds)
+	for d := 0; d < length && d < n; d++ {
+		i := head - dir*d
+		if wrap {
+			i = ((i % n) + n) % n
+		} else if i < 0 || i >= n {
+			break
+		}
+		leds[i] = Scale(color, uint8(255*(length-d)/length))
+	}
+}
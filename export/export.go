@@ -0,0 +1,310 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package export records frames of LEDs and writes them as an animated GIF, an
+// animated PNG (APNG) or a directory of PNG images, to document effects.
+//
+// Each LED is drawn as a square of Scale pixels, placed according to the
+// layout of the channel. The white component of RGBW LEDs is added to the
+// other components.
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/effects"
+	"github.com/rpi-ws281x/rpi-ws281x-go/layout"
+)
+
+const (
+	// DefaultScale is the size of an LED in pixels when Options.Scale is zero.
+	DefaultScale = 8
+	// DefaultFPS is the frame rate when Options.FPS is zero.
+	DefaultFPS = 25
+)
+
+// Options is the list of exporter options.
+type Options struct {
+	// Layout is the layout of the LEDs, a strip if zero
+	Layout layout.Layout
+	// Scale is the size of an LED in pixels
+	Scale int
+	// FPS is the number of frames per second of the animation
+	FPS int
+}
+
+// Exporter records frames.
+type Exporter struct {
+	opt    Options
+	frames []*image.RGBA
+}
+
+// MakeExporter creates an exporter for a channel of ledCount LEDs.
+func MakeExporter(ledCount int, opt Options) *Exporter {
+	opt.Layout = opt.Layout.For(ledCount)
+	if opt.Scale <= 0 {
+		opt.Scale = DefaultScale
+	}
+	if opt.FPS <= 0 {
+		opt.FPS = DefaultFPS
+	}
+	return &Exporter{opt: opt}
+}
+
+// Len returns the number of recorded frames.
+func (e *Exporter) Len() int {
+	return len(e.frames)
+}
+
+// Frame returns a recorded frame.
+func (e *Exporter) Frame(i int) *image.RGBA {
+	return e.frames[i]
+}
+
+// Add records a frame. LEDs that do not fit in the layout are ignored.
+func (e *Exporter) Add(leds []uint32) {
+	l, s := e.opt.Layout, e.opt.Scale
+	img := image.NewRGBA(image.Rect(0, 0, l.Width*s, l.Height*s))
+	draw.Draw(img, img.Bounds(), image.Black, image.Point{}, draw.Src)
+	for i, led := range leds {
+		if i >= l.Len() {
+			break
+		}
+		x, y := l.XY(i)
+		r := image.Rect(x*s, y*s, (x+1)*s, (y+1)*s)
+		draw.Draw(img, r, image.NewUniform(RGBA(led)), image.Point{}, draw.Src)
+	}
+	e.frames = append(e.frames, img)
+}
+
+// RGBA converts an LED color to an opaque color.
+func RGBA(led uint32) color.RGBA {
+	w := led >> 24
+	c := func(shift uint) uint8 {
+		v := (led>>shift)&0xff + w
+		if v > 0xff {
+			v = 0xff
+		}
+		return uint8(v)
+	}
+	return color.RGBA{R: c(16), G: c(8), B: c(0), A: 0xff}
+}
+
+// Record renders an effect for a duration at the frame rate of the exporter.
+func (e *Exporter) Record(effect effects.Effect, d time.Duration) {
+	leds := make([]uint32, e.opt.Layout.Len())
+	n := int(d * time.Duration(e.opt.FPS) / time.Second)
+	for i := 0; i < n; i++ {
+		effect.Render(leds, time.Duration(i)*time.Second/time.Duration(e.opt.FPS))
+		e.Add(leds)
+	}
+}
+
+// capture is a Device that records the frames of a channel.
+type capture struct {
+	ws2811.Device
+	e       *Exporter
+	channel int
+}
+
+func (c *capture) Render() error {
+	c.e.Add(c.Leds(c.channel))
+	return c.Device.Render()
+}
+
+// Capture wraps a device so that every Render records a frame of a channel.
+func (e *Exporter) Capture(dev ws2811.Device, channel int) ws2811.Device {
+	return &capture{Device: dev, e: e, channel: channel}
+}
+
+// delay returns the display time of frame i in units of 1/den second, such
+// that the rounding errors do not accumulate.
+func (e *Exporter) delay(i, den int) int {
+	at := func(i int) int { return (i*den + e.opt.FPS/2) / e.opt.FPS }
+	return at(i+1) - at(i)
+}
+
+// WriteGIF writes the frames as an animated GIF that loops forever. The
+// palette of each frame is made of its colors if there are at most 256 of
+// them, otherwise the colors are approximated with the Plan 9 palette.
+func (e *Exporter) WriteGIF(w io.Writer) error {
+	if len(e.frames) == 0 {
+		return errors.New("Error exporting: no frames")
+	}
+	anim := &gif.GIF{}
+	for i, frame := range e.frames {
+		anim.Image = append(anim.Image, paletted(frame))
+		anim.Delay = append(anim.Delay, e.delay(i, 100))
+	}
+	if err := gif.EncodeAll(w, anim); err != nil {
+		return errors.WithMessage(err, "Error exporting GIF")
+	}
+	return nil
+}
+
+func paletted(img *image.RGBA) *image.Paletted {
+	p := colors(img, 256)
+	if p == nil {
+		p = palette.Plan9
+	}
+	out := image.NewPaletted(img.Bounds(), p)
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+	return out
+}
+
+// colors returns the colors of an image, or nil if there are more than max.
+func colors(img *image.RGBA, max int) color.Palette {
+	var p color.Palette
+	seen := make(map[color.RGBA]bool)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			if seen[c] {
+				continue
+			}
+			if len(p) == max {
+				return nil
+			}
+			seen[c] = true
+			p = append(p, c)
+		}
+	}
+	return p
+}
+
+// WriteAPNG writes the frames as an animated PNG that loops forever.
+func (e *Exporter) WriteAPNG(w io.Writer) error {
+	if len(e.frames) == 0 {
+		return errors.New("Error exporting: no frames")
+	}
+	out := &chunkWriter{w: w}
+	out.write([]byte("\x89PNG\r\n\x1a\n"))
+	seq := uint32(0)
+	b := e.frames[0].Bounds()
+	for i, frame := range e.frames {
+		chunks, err := encodePNG(frame)
+		if err != nil {
+			return errors.WithMessage(err, "Error exporting APNG")
+		}
+		if i == 0 {
+			out.chunk("IHDR", chunks["IHDR"][0])
+			actl := binary.BigEndian.AppendUint32(nil, uint32(len(e.frames)))
+			out.chunk("acTL", binary.BigEndian.AppendUint32(actl, 0))
+		}
+
+		fctl := binary.BigEndian.AppendUint32(nil, seq)
+		fctl = binary.BigEndian.AppendUint32(fctl, uint32(b.Dx()))
+		fctl = binary.BigEndian.AppendUint32(fctl, uint32(b.Dy()))
+		fctl = binary.BigEndian.AppendUint32(fctl, 0) // x offset
+		fctl = binary.BigEndian.AppendUint32(fctl, 0) // y offset
+		fctl = binary.BigEndian.AppendUint16(fctl, uint16(e.delay(i, 1000)))
+		fctl = binary.BigEndian.AppendUint16(fctl, 1000)
+		fctl = append(fctl, 0, 0) // no dispose, no blend
+		out.chunk("fcTL", fctl)
+		seq++
+
+		for _, data := range chunks["IDAT"] {
+			if i == 0 {
+				out.chunk("IDAT", data)
+				continue
+			}
+			out.chunk("fdAT", append(binary.BigEndian.AppendUint32(nil, seq), data...))
+			seq++
+		}
+	}
+	out.chunk("IEND", nil)
+	if out.err != nil {
+		return errors.WithMessage(out.err, "Error exporting APNG")
+	}
+	return nil
+}
+
+// encodePNG encodes an image as a PNG and returns its chunks by type.
+func encodePNG(img image.Image) (map[string][][]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()[8:]
+	chunks := make(map[string][][]byte)
+	for len(b) >= 12 {
+		n := int(binary.BigEndian.Uint32(b))
+		typ := string(b[4:8])
+		chunks[typ] = append(chunks[typ], b[8:8+n])
+		b = b[12+n:]
+	}
+	return chunks, nil
+}
+
+type chunkWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (c *chunkWriter) write(b []byte) {
+	if c.err == nil {
+		_, c.err = c.w.Write(b)
+	}
+}
+
+func (c *chunkWriter) chunk(typ string, data []byte) {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	b = append(b, typ...)
+	b = append(b, data...)
+	crc := crc32.ChecksumIEEE(b[4:])
+	c.write(binary.BigEndian.AppendUint32(b, crc))
+}
+
+// WritePNGs writes the frames as PNG images named frame-00000.png,
+// frame-00001.png, ... in a directory, which is created if needed. They can be
+// assembled into a video with e.g. ffmpeg -framerate <FPS> -i frame-%05d.png.
+func (e *Exporter) WritePNGs(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.WithMessage(err, "Error exporting PNG frames")
+	}
+	for i, frame := range e.frames {
+		if err := writePNG(filepath.Join(dir, fmt.Sprintf("frame-%05d.png", i)), frame); err != nil {
+			return errors.WithMessage(err, "Error exporting PNG frames")
+		}
+	}
+	return nil
+}
+
+func writePNG(name string, img image.Image) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
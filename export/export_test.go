@@ -0,0 +1,124 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/effects"
+	"github.com/rpi-ws281x/rpi-ws281x-go/layout"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdd(t *testing.T) {
+	e := MakeExporter(4, Options{Layout: layout.Matrix(2, 2, true), Scale: 2})
+	e.Add([]uint32{0xff0000, 0x00ff00, 0x0000ff, 0x80000010})
+	img := e.Frame(0)
+	assert.Equal(t, 4, img.Bounds().Dx())
+	assert.Equal(t, color.RGBA{0xff, 0, 0, 0xff}, img.RGBAAt(1, 1))
+	assert.Equal(t, color.RGBA{0, 0xff, 0, 0xff}, img.RGBAAt(2, 0))
+	// serpentine
+	assert.Equal(t, color.RGBA{0, 0, 0xff, 0xff}, img.RGBAAt(3, 3))
+	assert.Equal(t, color.RGBA{0x80, 0x80, 0x90, 0xff}, img.RGBAAt(0, 2))
+}
+
+func TestGIF(t *testing.T) {
+	e := MakeExporter(8, Options{FPS: 30})
+	e.Record(&effects.Rainbow{}, time.Second)
+	assert.Equal(t, 30, e.Len())
+
+	var buf bytes.Buffer
+	assert.Nil(t, e.WriteGIF(&buf))
+	anim, err := gif.DecodeAll(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 30, len(anim.Image))
+	total := 0
+	for _, d := range anim.Delay {
+		assert.True(t, d == 3 || d == 4)
+		total += d
+	}
+	assert.Equal(t, 100, total)
+	assert.Equal(t, 8*DefaultScale, anim.Config.Width)
+
+	assert.NotNil(t, MakeExporter(8, Options{}).WriteGIF(&buf))
+}
+
+func TestAPNG(t *testing.T) {
+	e := MakeExporter(3, Options{FPS: 10, Scale: 1})
+	e.Add([]uint32{0xff0000, 0, 0})
+	e.Add([]uint32{0, 0xff0000, 0})
+	e.Add([]uint32{0, 0, 0xff0000})
+
+	var buf bytes.Buffer
+	assert.Nil(t, e.WriteAPNG(&buf))
+	data := buf.Bytes()
+
+	// decoders without APNG support show the first frame
+	img, err := png.Decode(bytes.NewReader(data))
+	assert.Nil(t, err)
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+
+	var types []string
+	seqs := []uint32{}
+	for b := data[8:]; len(b) >= 12; {
+		n := int(binary.BigEndian.Uint32(b))
+		typ := string(b[4:8])
+		types = append(types, typ)
+		switch typ {
+		case "acTL":
+			assert.Equal(t, uint32(3), binary.BigEndian.Uint32(b[8:]))
+		case "fcTL":
+			seqs = append(seqs, binary.BigEndian.Uint32(b[8:]))
+			assert.Equal(t, uint16(100), binary.BigEndian.Uint16(b[8+20:]))
+			assert.Equal(t, uint16(1000), binary.BigEndian.Uint16(b[8+22:]))
+		case "fdAT":
+			seqs = append(seqs, binary.BigEndian.Uint32(b[8:]))
+		}
+		b = b[12+n:]
+	}
+	assert.Equal(t, []string{"IHDR", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "fcTL", "fdAT", "IEND"}, types)
+	assert.Equal(t, []uint32{0, 1, 2, 3, 4}, seqs)
+}
+
+func TestPNGs(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 2}}}
+	ws, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	e := MakeExporter(2, Options{})
+	dev := e.Capture(ws, 0)
+	for i := 0; i < 3; i++ {
+		dev.Leds(0)[0] = uint32(i)
+		assert.Nil(t, dev.Render())
+	}
+	assert.Equal(t, 3, e.Len())
+
+	dir := filepath.Join(t.TempDir(), "frames")
+	assert.Nil(t, e.WritePNGs(dir))
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "frame-00002.png", entries[2].Name())
+}
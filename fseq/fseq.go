@@ -0,0 +1,347 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fseq reads the FSEQ sequences exported by xLights and plays them on
+// a device.
+//
+// Versions 1 and 2 of the format are supported, including the zstd and zlib
+// compression and the sparse ranges of version 2. See
+// https://github.com/FalconChristmas/fpp/blob/master/docs/FSEQ_Sequence_File_Format.txt
+package fseq
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// Compression is the compression of the channel data.
+type Compression int
+
+// Compressions.
+const (
+	None Compression = 0
+	Zstd Compression = 1
+	Zlib Compression = 2
+)
+
+func (c Compression) String() string {
+	switch c {
+	case None:
+		return "none"
+	case Zstd:
+		return "zstd"
+	case Zlib:
+		return "zlib"
+	}
+	return fmt.Sprintf("compression(%d)", int(c))
+}
+
+// maxFrameSize limits the memory allocated for a frame.
+const maxFrameSize = 1 << 24
+
+// Range is a sparse range of channels. The channel data of a sequence with
+// sparse ranges only holds the channels of the ranges, in order.
+type Range struct {
+	Start int
+	Count int
+}
+
+type block struct {
+	frame  int   // first frame of the block
+	offset int64 // offset of the block in the file
+	length int64
+	size   int64 // size of the decompressed block
+}
+
+// File is an FSEQ sequence.
+type File struct {
+	// MajorVersion and MinorVersion are the version of the format
+	MajorVersion int
+	MinorVersion int
+	// ChannelCount is the number of channels of a frame in the file
+	ChannelCount int
+	// FrameCount is the number of frames
+	FrameCount int
+	// StepTime is the duration of a frame
+	StepTime time.Duration
+	// Compression is the compression of the channel data
+	Compression Compression
+	// SparseRanges are the sparse ranges, if any
+	SparseRanges []Range
+	// Headers are the variable headers by code, e.g. "mf" for the media file
+	Headers map[string]string
+
+	r          io.ReaderAt
+	dataOffset int64
+	blocks     []block
+
+	mu         sync.Mutex
+	cached     int // index of the cached block, -1 if none
+	cachedData []byte
+	zstd       *zstd.Decoder
+}
+
+// Open reads the header of a sequence.
+func Open(r io.ReaderAt) (*File, error) {
+	h := make([]byte, 32)
+	if _, err := r.ReadAt(h[:28], 0); err != nil {
+		return nil, errors.WithMessage(err, "Error reading FSEQ header")
+	}
+	magic := string(h[:4])
+	if magic != "PSEQ" && magic != "FSEQ" && magic != "ESEQ" {
+		return nil, errors.New("Error reading FSEQ header: not an FSEQ file")
+	}
+	if magic == "ESEQ" {
+		return nil, errors.New("Error reading FSEQ header: effect sequences are not supported")
+	}
+	f := &File{
+		MajorVersion: int(h[7]),
+		MinorVersion: int(h[6]),
+		ChannelCount: int(binary.LittleEndian.Uint32(h[10:])),
+		FrameCount:   int(binary.LittleEndian.Uint32(h[14:])),
+		StepTime:     time.Duration(h[18]) * time.Millisecond,
+		Headers:      make(map[string]string),
+		r:            r,
+		dataOffset:   int64(binary.LittleEndian.Uint16(h[4:])),
+		cached:       -1,
+	}
+	if f.StepTime == 0 {
+		return nil, errors.New("Error reading FSEQ header: invalid step time")
+	}
+	headerEnd := int64(binary.LittleEndian.Uint16(h[8:]))
+
+	switch f.MajorVersion {
+	case 1:
+	case 2:
+		if _, err := r.ReadAt(h, 0); err != nil {
+			return nil, errors.WithMessage(err, "Error reading FSEQ header")
+		}
+		f.Compression = Compression(h[20] & 0x0f)
+		blockCount := int(h[20]>>4)<<8 | int(h[21])
+		rangeCount := int(h[22])
+		table := make([]byte, 8*blockCount+6*rangeCount)
+		if _, err := r.ReadAt(table, 32); err != nil {
+			return nil, errors.WithMessage(err, "Error reading FSEQ header")
+		}
+		offset := f.dataOffset
+		for i := 0; i < blockCount; i++ {
+			b := block{
+				frame:  int(binary.LittleEndian.Uint32(table[8*i:])),
+				offset: offset,
+				length: int64(binary.LittleEndian.Uint32(table[8*i+4:])),
+			}
+			if b.length == 0 {
+				break
+			}
+			f.blocks = append(f.blocks, b)
+			offset += b.length
+		}
+		for i := 0; i < rangeCount; i++ {
+			e := table[8*blockCount+6*i:]
+			f.SparseRanges = append(f.SparseRanges, Range{Start: uint24(e), Count: uint24(e[3:])})
+		}
+		count := 0
+		for _, r := range f.SparseRanges {
+			count += r.Count
+			if r.Start+r.Count > 1<<24 || count > f.ChannelCount {
+				return nil, errors.New("Error reading FSEQ header: invalid sparse ranges")
+			}
+		}
+		// the blocks hold the frames up to the next block
+		for i := range f.blocks {
+			next := f.FrameCount
+			if i+1 < len(f.blocks) {
+				next = f.blocks[i+1].frame
+			}
+			if next > f.blocks[i].frame {
+				f.blocks[i].size = int64(next-f.blocks[i].frame) * int64(f.ChannelCount)
+			}
+		}
+		headerEnd = 32 + int64(len(table))
+	default:
+		return nil, fmt.Errorf("Error reading FSEQ header: unsupported version %d", f.MajorVersion)
+	}
+
+	switch f.Compression {
+	case None:
+	case Zlib:
+	case Zstd:
+		// the decoder is limited to the largest block, but not below the
+		// smallest window of zstd
+		var maxSize int64 = 1 << 10
+		for _, b := range f.blocks {
+			if b.size > maxSize {
+				maxSize = b.size
+			}
+		}
+		d, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(maxSize)))
+		if err != nil {
+			return nil, errors.WithMessage(err, "Error reading FSEQ header")
+		}
+		f.zstd = d
+	default:
+		return nil, fmt.Errorf("Error reading FSEQ header: unsupported compression %d", int(f.Compression))
+	}
+	if f.Compression != None && len(f.blocks) == 0 {
+		return nil, errors.New("Error reading FSEQ header: no compression blocks")
+	}
+	if f.ChannelCount > maxFrameSize {
+		return nil, errors.New("Error reading FSEQ header: too many channels")
+	}
+
+	if err := f.readVariableHeaders(headerEnd); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+// readVariableHeaders reads the variable headers between the fixed header and
+// the channel data.
+func (f *File) readVariableHeaders(start int64) error {
+	if start >= f.dataOffset {
+		return nil
+	}
+	b := make([]byte, f.dataOffset-start)
+	if _, err := f.r.ReadAt(b, start); err != nil {
+		return errors.WithMessage(err, "Error reading FSEQ variable headers")
+	}
+	for len(b) >= 4 {
+		n := int(binary.LittleEndian.Uint16(b))
+		if n < 4 || n > len(b) {
+			break // padding
+		}
+		f.Headers[string(b[2:4])] = string(bytes.TrimRight(b[4:n], "\x00"))
+		b = b[n:]
+	}
+	return nil
+}
+
+// Media returns the name of the media file of the sequence, if any.
+func (f *File) Media() string {
+	return f.Headers["mf"]
+}
+
+// Duration returns the duration of the sequence.
+func (f *File) Duration() time.Duration {
+	return time.Duration(f.FrameCount) * f.StepTime
+}
+
+// Index returns the index in the frame data of an absolute channel (0-based),
+// or -1 if the channel is not stored in the file.
+func (f *File) Index(channel int) int {
+	if len(f.SparseRanges) == 0 {
+		if channel < 0 || channel >= f.ChannelCount {
+			return -1
+		}
+		return channel
+	}
+	offset := 0
+	for _, r := range f.SparseRanges {
+		if channel >= r.Start && channel < r.Start+r.Count {
+			return offset + channel - r.Start
+		}
+		offset += r.Count
+	}
+	return -1
+}
+
+// Frame returns the channel data of a frame. The slice must not be modified
+// and is only valid until the next call.
+func (f *File) Frame(i int) ([]byte, error) {
+	if i < 0 || i >= f.FrameCount {
+		return nil, fmt.Errorf("invalid frame %d", i)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Compression == None {
+		if f.cachedData == nil {
+			f.cachedData = make([]byte, f.ChannelCount)
+		}
+		_, err := f.r.ReadAt(f.cachedData, f.dataOffset+int64(i)*int64(f.ChannelCount))
+		if err != nil {
+			return nil, errors.WithMessage(err, "Error reading FSEQ frame")
+		}
+		return f.cachedData, nil
+	}
+
+	b := sort.Search(len(f.blocks), func(j int) bool { return f.blocks[j].frame > i }) - 1
+	if b < 0 {
+		return nil, fmt.Errorf("Error reading FSEQ frame: frame %d is not in a block", i)
+	}
+	if b != f.cached {
+		data, err := f.readBlock(f.blocks[b])
+		if err != nil {
+			return nil, errors.WithMessage(err, "Error reading FSEQ frame")
+		}
+		f.cached, f.cachedData = b, data
+	}
+	start := (i - f.blocks[b].frame) * f.ChannelCount
+	if start+f.ChannelCount > len(f.cachedData) {
+		return nil, fmt.Errorf("Error reading FSEQ frame: frame %d is truncated", i)
+	}
+	return f.cachedData[start : start+f.ChannelCount], nil
+}
+
+// readBlock decompresses a block, which must not be larger than its frames.
+func (f *File) readBlock(b block) ([]byte, error) {
+	if b.length > maxFrameSize*4 {
+		return nil, errors.New("block too large")
+	}
+	compressed := make([]byte, b.length)
+	if _, err := f.r.ReadAt(compressed, b.offset); err != nil {
+		return nil, err
+	}
+	var data []byte
+	var err error
+	if f.Compression == Zstd {
+		data, err = f.zstd.DecodeAll(compressed, nil)
+	} else {
+		var zr io.ReadCloser
+		zr, err = zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		data, err = io.ReadAll(io.LimitReader(zr, b.size+1))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > b.size {
+		return nil, errors.New("block too large")
+	}
+	return data, nil
+}
+
+// Close releases the resources of the decoder. It does not close the reader.
+func (f *File) Close() error {
+	if f.zstd != nil {
+		f.zstd.Close()
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fseq
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// frames returns frame count frames of n channels, where channel c of frame i
+// is i*16+c.
+func frames(count, n int) [][]byte {
+	var f [][]byte
+	for i := 0; i < count; i++ {
+		b := make([]byte, n)
+		for c := range b {
+			b[c] = byte(i*16 + c)
+		}
+		f = append(f, b)
+	}
+	return f
+}
+
+func variableHeader(code, value string) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, uint16(4+len(value)+1))
+	return append(append(append(b, code...), value...), 0)
+}
+
+func v1File(data [][]byte, step byte) []byte {
+	vh := variableHeader("mf", "song.mp3")
+	h := make([]byte, 28)
+	copy(h, "PSEQ")
+	binary.LittleEndian.PutUint16(h[4:], uint16(28+len(vh)))
+	h[6], h[7] = 0, 1
+	binary.LittleEndian.PutUint16(h[8:], 28)
+	binary.LittleEndian.PutUint32(h[10:], uint32(len(data[0])))
+	binary.LittleEndian.PutUint32(h[14:], uint32(len(data)))
+	h[18] = step
+	b := append(h, vh...)
+	for _, f := range data {
+		b = append(b, f...)
+	}
+	return b
+}
+
+// v2File builds a version 2 file with framesPerBlock frames per compression
+// block.
+func v2File(data [][]byte, step byte, c Compression, framesPerBlock int, ranges []Range) []byte {
+	var blocks [][]byte
+	var first []int
+	for i := 0; c != None && i < len(data); i += framesPerBlock {
+		var raw []byte
+		for j := i; j < i+framesPerBlock && j < len(data); j++ {
+			raw = append(raw, data[j]...)
+		}
+		switch c {
+		case Zstd:
+			enc, _ := zstd.NewWriter(nil)
+			raw = enc.EncodeAll(raw, nil)
+		case Zlib:
+			var buf bytes.Buffer
+			w := zlib.NewWriter(&buf)
+			w.Write(raw) // nolint: errcheck
+			w.Close()
+			raw = buf.Bytes()
+		}
+		blocks = append(blocks, raw)
+		first = append(first, i)
+	}
+	h := make([]byte, 32)
+	copy(h, "PSEQ")
+	h[6], h[7] = 0, 2
+	binary.LittleEndian.PutUint32(h[10:], uint32(len(data[0])))
+	binary.LittleEndian.PutUint32(h[14:], uint32(len(data)))
+	h[18] = step
+	h[20] = byte(c)
+	h[21] = byte(len(blocks) + 1) // with an unused entry
+	h[22] = byte(len(ranges))
+	for i, b := range blocks {
+		h = binary.LittleEndian.AppendUint32(h, uint32(first[i]))
+		h = binary.LittleEndian.AppendUint32(h, uint32(len(b)))
+	}
+	h = append(h, make([]byte, 8)...)
+	for _, r := range ranges {
+		h = append(h, byte(r.Start), byte(r.Start>>8), byte(r.Start>>16))
+		h = append(h, byte(r.Count), byte(r.Count>>8), byte(r.Count>>16))
+	}
+	binary.LittleEndian.PutUint16(h[8:], uint16(len(h)))
+	h = append(h, variableHeader("sp", "xLights")...)
+	binary.LittleEndian.PutUint16(h[4:], uint16(len(h)))
+
+	if c == None {
+		for _, f := range data {
+			h = append(h, f...)
+		}
+		return h
+	}
+	for _, b := range blocks {
+		h = append(h, b...)
+	}
+	return h
+}
+
+func TestOpen(t *testing.T) {
+	data := frames(10, 6)
+	cases := map[string][]byte{
+		"v1":   v1File(data, 50),
+		"none": v2File(data, 50, None, 0, nil),
+		"zstd": v2File(data, 50, Zstd, 3, nil),
+		"zlib": v2File(data, 50, Zlib, 4, nil),
+	}
+	for name, b := range cases {
+		f, err := Open(bytes.NewReader(b))
+		assert.Nil(t, err, name)
+		assert.Equal(t, 6, f.ChannelCount, name)
+		assert.Equal(t, 10, f.FrameCount, name)
+		assert.Equal(t, 50*time.Millisecond, f.StepTime, name)
+		assert.Equal(t, 500*time.Millisecond, f.Duration(), name)
+		// random access, across blocks
+		for _, i := range []int{0, 9, 4, 3, 5} {
+			frame, err := f.Frame(i)
+			assert.Nil(t, err, name)
+			assert.Equal(t, data[i], frame, name)
+		}
+		_, err = f.Frame(10)
+		assert.NotNil(t, err, name)
+		f.Close()
+	}
+
+	f, _ := Open(bytes.NewReader(cases["v1"]))
+	assert.Equal(t, "song.mp3", f.Media())
+	f, _ = Open(bytes.NewReader(cases["zstd"]))
+	assert.Equal(t, Zstd, f.Compression)
+	assert.Equal(t, "xLights", f.Headers["sp"])
+
+	_, err := Open(bytes.NewReader([]byte("not an fseq file at all......")))
+	assert.NotNil(t, err)
+}
+
+func TestSparse(t *testing.T) {
+	data := frames(2, 5)
+	b := v2File(data, 25, Zstd, 1, []Range{{Start: 10, Count: 3}, {Start: 100, Count: 2}})
+	f, err := Open(bytes.NewReader(b))
+	assert.Nil(t, err)
+	assert.Equal(t, []Range{{10, 3}, {100, 2}}, f.SparseRanges)
+	assert.Equal(t, -1, f.Index(0))
+	assert.Equal(t, 0, f.Index(10))
+	assert.Equal(t, 2, f.Index(12))
+	assert.Equal(t, -1, f.Index(13))
+	assert.Equal(t, 4, f.Index(101))
+}
+
+// device is a simulated device that reports renders.
+type device struct {
+	*ws2811.WS2811
+	rendered chan [][]uint32
+}
+
+func (d *device) Render() error {
+	d.rendered <- [][]uint32{append([]uint32(nil), d.Leds(0)...), append([]uint32(nil), d.Leds(1)...)}
+	return nil
+}
+
+func TestPlayer(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{
+		{LedCount: 2, StripeType: ws2811.WS2812Strip},
+		{LedCount: 1, StripeType: ws2811.SK6812StripRGBW},
+	}}
+	ws, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	dev := &device{WS2811: ws, rendered: make(chan [][]uint32, 16)}
+
+	data := frames(4, 10)
+	f, err := Open(bytes.NewReader(v2File(data, 10, Zlib, 2, nil)))
+	assert.Nil(t, err)
+	p := MakePlayer(dev, &opt, f)
+
+	assert.Nil(t, p.RenderFrame(1))
+	assert.Equal(t, [][]uint32{{0x101112, 0x131415}, {0x19161718}}, <-dev.rendered)
+
+	// outputs with an explicit mapping
+	p = MakePlayer(dev, &opt, f, Output{Channel: 1, Start: 7, Components: 3})
+	assert.Nil(t, p.RenderFrame(0))
+	assert.Equal(t, []uint32{0x070809}, (<-dev.rendered)[1])
+
+	// the sequence is played at its step time
+	p = MakePlayer(dev, &opt, f)
+	start := time.Now()
+	assert.Nil(t, p.Play(context.Background()))
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(30*time.Millisecond))
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, uint32(i*16)<<16|uint32(i*16+1)<<8|uint32(i*16+2), (<-dev.rendered)[0][0])
+	}
+
+	// frames that are already late are skipped
+	assert.Nil(t, p.PlayAt(context.Background(), time.Now().Add(-25*time.Millisecond)))
+	assert.Equal(t, uint32(0x202122), (<-dev.rendered)[0][0])
+	assert.Equal(t, uint32(0x303132), (<-dev.rendered)[0][0])
+
+	// the audio offset delays the lights
+	p.AudioOffset = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, p.Play(ctx))
+	assert.Equal(t, 0, len(dev.rendered))
+}
+
+func TestInvalidSparseRanges(t *testing.T) {
+	data := frames(2, 4)
+	for _, ranges := range [][]Range{
+		{{Start: 0, Count: 3}, {Start: 10, Count: 3}},
+		{{Start: 1<<24 - 1, Count: 2}},
+	} {
+		_, err := Open(bytes.NewReader(v2File(data, 25, None, 0, ranges)))
+		assert.NotNil(t, err, ranges)
+	}
+	_, err := Open(bytes.NewReader(v2File(data, 25, None, 0, []Range{{Start: 10, Count: 4}})))
+	assert.Nil(t, err)
+}
+
+func TestBlockTooLarge(t *testing.T) {
+	for _, c := range []Compression{Zstd, Zlib} {
+		b := v2File(frames(4, 2048), 25, c, 4, nil)
+		// the blocks decompress to more than the frames of the header
+		binary.LittleEndian.PutUint32(b[10:], 16)
+		f, err := Open(bytes.NewReader(b))
+		assert.Nil(t, err, c)
+		_, err = f.Frame(0)
+		assert.NotNil(t, err, c)
+		f.Close()
+	}
+}
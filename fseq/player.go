@@ -0,0 +1,144 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fseq
+
+import (
+	"context"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+)
+
+// Output maps FSEQ channels to the LEDs of a channel of the device. The LEDs
+// are read in R, G, B (and W) order, as exported by xLights.
+type Output struct {
+	// Channel is the channel of the device
+	Channel int
+	// Start is the first FSEQ channel (0-based; xLights shows 1-based numbers)
+	Start int
+	// Components is 3 for RGB or 4 for RGBW, taken from the strip type if 0
+	Components int
+}
+
+// Player plays a sequence on a device.
+type Player struct {
+	// AudioOffset delays the lights relative to the start time, to compensate
+	// for the latency of the audio output. A negative offset advances them.
+	AudioOffset time.Duration
+
+	dev     ws2811.Device
+	f       *File
+	outputs []Output
+}
+
+// MakePlayer creates a player for an initialized device created with opt. If
+// no output is given, the channels of the device are mapped one after the
+// other from FSEQ channel 0.
+func MakePlayer(dev ws2811.Device, opt *ws2811.Option, f *File, outputs ...Output) *Player {
+	if len(outputs) == 0 {
+		start := 0
+		for i, ch := range opt.Channels {
+			if ch.LedCount == 0 {
+				continue
+			}
+			outputs = append(outputs, Output{Channel: i, Start: start})
+			start += ch.LedCount * ws2811.StripeComponents(ch.StripeType)
+		}
+	}
+	for i := range outputs {
+		if outputs[i].Components == 0 {
+			outputs[i].Components = 3
+			if ch := outputs[i].Channel; ch < len(opt.Channels) {
+				outputs[i].Components = ws2811.StripeComponents(opt.Channels[ch].StripeType)
+			}
+		}
+	}
+	return &Player{dev: dev, f: f, outputs: outputs}
+}
+
+// RenderFrame waits for the previous frame and renders a frame of the
+// sequence.
+func (p *Player) RenderFrame(i int) error {
+	data, err := p.f.Frame(i)
+	if err != nil {
+		return err
+	}
+	if err := p.dev.Wait(); err != nil {
+		return err
+	}
+	for _, o := range p.outputs {
+		leds := p.dev.Leds(o.Channel)
+		for j := range leds {
+			var c uint32
+			for k := 0; k < o.Components; k++ {
+				if idx := p.f.Index(o.Start + j*o.Components + k); idx >= 0 && idx < len(data) {
+					// R, G, B, W to 0xWWRRGGBB
+					shift := uint(16 - 8*k)
+					if k == 3 {
+						shift = 24
+					}
+					c |= uint32(data[idx]) << shift
+				}
+			}
+			leds[j] = c
+		}
+	}
+	return p.dev.Render()
+}
+
+// Play plays the sequence from now. See PlayAt.
+func (p *Player) Play(ctx context.Context) error {
+	return p.PlayAt(ctx, time.Now())
+}
+
+// PlayAt plays the sequence as if it started at a given time, e.g. the time
+// at which the audio started, until its end or until the context is done.
+// Frame i is rendered at start + AudioOffset + i * StepTime; when the
+// rendering is late, frames are skipped to stay in sync.
+func (p *Player) PlayAt(ctx context.Context, start time.Time) error {
+	start = start.Add(p.AudioOffset)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	next := 0
+	for {
+		i := next
+		if late := time.Since(start); late > 0 {
+			if current := int(late / p.f.StepTime); current > i {
+				i = current
+			}
+		}
+		if i >= p.f.FrameCount {
+			return nil
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(time.Until(start.Add(time.Duration(i) * p.f.StepTime)))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err := p.RenderFrame(i); err != nil {
+			return err
+		}
+		next = i + 1
+	}
+}
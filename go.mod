@@ -3,14 +3,19 @@ go 1.20
 module github.com/rpi-ws281x/rpi-ws281x-go
 
 require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.16.7
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/net v0.17.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/kr/pretty v0.1.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
-	gopkg.in/yaml.v2 v2.2.4 // indirect
 )
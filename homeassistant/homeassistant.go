@@ -0,0 +1,447 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package homeassistant connects a controller to an MQTT broker and exposes
+// each channel as a light entity of Home Assistant, using MQTT discovery and
+// the JSON schema of the MQTT light integration
+// (https://www.home-assistant.io/integrations/light.mqtt/).
+//
+// For each channel that has LEDs, the bridge publishes a retained discovery
+// config on <DiscoveryPrefix>/light/<NodeID>/channel<N>/config, listens for
+// commands on <BaseTopic>/channel<N>/set and publishes the state of the light
+// on <BaseTopic>/channel<N>/state. The availability of the device is
+// published on <BaseTopic>/availability, with a will so that Home Assistant
+// marks the lights unavailable when the daemon dies.
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/controller"
+	"github.com/rpi-ws281x/rpi-ws281x-go/effects"
+	"github.com/rpi-ws281x/rpi-ws281x-go/internal/mqtt"
+)
+
+const (
+	// DefaultNodeID is the node ID used when Config.NodeID is empty.
+	DefaultNodeID = "ws281x"
+	// DefaultDiscoveryPrefix is the discovery prefix of Home Assistant.
+	DefaultDiscoveryPrefix = "homeassistant"
+	// DefaultRetryInterval is the time between two connection attempts.
+	DefaultRetryInterval = 5 * time.Second
+)
+
+// solid is the effect that shows the color of the light.
+const solid = "solid"
+
+// Config is the configuration of a Bridge.
+type Config struct {
+	// Broker is the host:port address of the MQTT broker
+	Broker string
+	// Username and Password authenticate the bridge, if not empty
+	Username string
+	Password string
+	// NodeID identifies the device; it must be unique for the broker
+	NodeID string
+	// Name is the name of the device in Home Assistant, NodeID if empty
+	Name string
+	// DiscoveryPrefix is the discovery prefix configured in Home Assistant
+	DiscoveryPrefix string
+	// BaseTopic is the prefix of the state and command topics, ws281x/<NodeID> if empty
+	BaseTopic string
+	// RetryInterval is the time between two connection attempts
+	RetryInterval time.Duration
+	// OnError, if not nil, is called with the connection and command errors
+	OnError func(error)
+}
+
+// Color is the color of a light in the JSON schema.
+type Color struct {
+	R uint8  `json:"r"`
+	G uint8  `json:"g"`
+	B uint8  `json:"b"`
+	W *uint8 `json:"w,omitempty"`
+}
+
+// Command is a command sent by Home Assistant. All fields are optional.
+type Command struct {
+	State      string  `json:"state,omitempty"`
+	Brightness *int    `json:"brightness,omitempty"`
+	Color      *Color  `json:"color,omitempty"`
+	Effect     *string `json:"effect,omitempty"`
+}
+
+// State is the state of a light published by the bridge.
+type State struct {
+	State      string `json:"state"`
+	Brightness int    `json:"brightness"`
+	ColorMode  string `json:"color_mode"`
+	Color      Color  `json:"color"`
+	Effect     string `json:"effect"`
+}
+
+// Discovery is the discovery config of a light.
+type Discovery struct {
+	Name                string   `json:"name"`
+	UniqueID            string   `json:"unique_id"`
+	Schema              string   `json:"schema"`
+	CommandTopic        string   `json:"command_topic"`
+	StateTopic          string   `json:"state_topic"`
+	AvailabilityTopic   string   `json:"availability_topic"`
+	Brightness          bool     `json:"brightness"`
+	SupportedColorModes []string `json:"supported_color_modes"`
+	Effect              bool     `json:"effect"`
+	EffectList          []string `json:"effect_list"`
+	Device              Device   `json:"device"`
+}
+
+// Device describes the device that owns the lights.
+type Device struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// light is the state of a channel.
+type light struct {
+	channel    int
+	ledCount   int
+	rgbw       bool
+	on         bool
+	brightness int
+	color      uint32
+	effect     string
+}
+
+// Bridge exposes the channels of a controller to Home Assistant.
+type Bridge struct {
+	ctrl *controller.Controller
+	cfg  Config
+
+	mu     sync.Mutex
+	lights []*light
+}
+
+// MakeBridge creates a bridge for a controller.
+func MakeBridge(ctrl *controller.Controller, cfg Config) *Bridge {
+	if cfg.NodeID == "" {
+		cfg.NodeID = DefaultNodeID
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.NodeID
+	}
+	if cfg.DiscoveryPrefix == "" {
+		cfg.DiscoveryPrefix = DefaultDiscoveryPrefix
+	}
+	if cfg.BaseTopic == "" {
+		cfg.BaseTopic = "ws281x/" + cfg.NodeID
+	}
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+
+	b := &Bridge{ctrl: ctrl, cfg: cfg}
+	for i, ch := range ctrl.Status().Channels {
+		if ch.LedCount == 0 {
+			continue
+		}
+		l := &light{
+			channel:    i,
+			ledCount:   ch.LedCount,
+			rgbw:       ws2811.StripeComponents(ch.StripeType) == 4,
+			on:         ch.Brightness > 0,
+			brightness: ch.Brightness,
+			color:      0xffffff,
+			effect:     ch.Effect,
+		}
+		if l.brightness == 0 {
+			l.brightness = 255
+		}
+		if l.effect == "" {
+			l.effect = solid
+		}
+		b.lights = append(b.lights, l)
+	}
+	return b
+}
+
+// AvailabilityTopic returns the topic of the availability of the device.
+func (b *Bridge) AvailabilityTopic() string {
+	return b.cfg.BaseTopic + "/availability"
+}
+
+// DiscoveryTopic returns the discovery config topic of a channel.
+func (b *Bridge) DiscoveryTopic(channel int) string {
+	return fmt.Sprintf("%s/light/%s/channel%d/config", b.cfg.DiscoveryPrefix, b.cfg.NodeID, channel)
+}
+
+// StateTopic returns the state topic of a channel.
+func (b *Bridge) StateTopic(channel int) string {
+	return fmt.Sprintf("%s/channel%d/state", b.cfg.BaseTopic, channel)
+}
+
+// CommandTopic returns the command topic of a channel.
+func (b *Bridge) CommandTopic(channel int) string {
+	return fmt.Sprintf("%s/channel%d/set", b.cfg.BaseTopic, channel)
+}
+
+// Discovery returns the discovery config of a channel.
+func (b *Bridge) Discovery(channel int) Discovery {
+	d := Discovery{
+		Name:                fmt.Sprintf("Channel %d", channel),
+		UniqueID:            fmt.Sprintf("%s_channel%d", b.cfg.NodeID, channel),
+		Schema:              "json",
+		CommandTopic:        b.CommandTopic(channel),
+		StateTopic:          b.StateTopic(channel),
+		AvailabilityTopic:   b.AvailabilityTopic(),
+		Brightness:          true,
+		SupportedColorModes: []string{"rgb"},
+		Effect:              true,
+		EffectList:          effects.Names(),
+		Device: Device{
+			Identifiers:  []string{b.cfg.NodeID},
+			Name:         b.cfg.Name,
+			Manufacturer: "rpi-ws281x",
+			Model:        "rpi-ws281x-go",
+		},
+	}
+	if l := b.light(channel); l != nil && l.rgbw {
+		d.SupportedColorModes = []string{"rgbw"}
+	}
+	return d
+}
+
+func (b *Bridge) light(channel int) *light {
+	for _, l := range b.lights {
+		if l.channel == channel {
+			return l
+		}
+	}
+	return nil
+}
+
+// State returns the state of the light of a channel.
+func (b *Bridge) State(channel int) (State, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	l := b.light(channel)
+	if l == nil {
+		return State{}, fmt.Errorf("invalid channel %d", channel)
+	}
+	return l.state(), nil
+}
+
+func (l *light) state() State {
+	s := State{
+		State:      "OFF",
+		Brightness: l.brightness,
+		ColorMode:  "rgb",
+		Color:      Color{R: uint8(l.color >> 16), G: uint8(l.color >> 8), B: uint8(l.color)},
+		Effect:     l.effect,
+	}
+	if l.on {
+		s.State = "ON"
+	}
+	if l.rgbw {
+		w := uint8(l.color >> 24)
+		s.ColorMode, s.Color.W = "rgbw", &w
+	}
+	return s
+}
+
+// Apply applies a command to the light of a channel.
+func (b *Bridge) Apply(channel int, cmd Command) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	l := b.light(channel)
+	if l == nil {
+		return fmt.Errorf("invalid channel %d", channel)
+	}
+
+	restart := false
+	switch cmd.State {
+	case "":
+	case "ON":
+		l.on = true
+	case "OFF":
+		l.on = false
+	default:
+		return fmt.Errorf("invalid state %q", cmd.State)
+	}
+	if cmd.Brightness != nil {
+		if *cmd.Brightness < 0 || *cmd.Brightness > 255 {
+			return fmt.Errorf("invalid brightness %d", *cmd.Brightness)
+		}
+		l.brightness = *cmd.Brightness
+	}
+	if cmd.Effect != nil {
+		if _, err := effects.New(*cmd.Effect); err != nil {
+			return err
+		}
+		l.effect, restart = *cmd.Effect, true
+	}
+	if c := cmd.Color; c != nil {
+		l.color = uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+		if c.W != nil {
+			l.color |= uint32(*c.W) << 24
+		}
+		restart = true
+	}
+
+	brightness := 0
+	if l.on {
+		brightness = l.brightness
+	}
+	if err := b.ctrl.SetBrightness(l.channel, brightness); err != nil {
+		return err
+	}
+	if !restart {
+		return nil
+	}
+	if l.effect == solid {
+		return b.ctrl.Fill(l.channel, 0, l.ledCount, l.color)
+	}
+	e, err := effects.New(l.effect)
+	if err != nil {
+		return err
+	}
+	return b.ctrl.SetEffect(l.channel, l.effect, effects.WithColor(e, l.color))
+}
+
+// Run connects to the broker and serves Home Assistant until the context is
+// done. It reconnects every RetryInterval when the connection is lost.
+func (b *Bridge) Run(ctx context.Context) error {
+	for {
+		err := b.serve(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		b.error(err)
+		select {
+		case <-time.After(b.cfg.RetryInterval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (b *Bridge) error(err error) {
+	if err != nil && b.cfg.OnError != nil {
+		b.cfg.OnError(err)
+	}
+}
+
+// serve runs a single connection to the broker.
+func (b *Bridge) serve(ctx context.Context) error {
+	client, err := mqtt.Dial(b.cfg.Broker, mqtt.Options{
+		ClientID: b.cfg.NodeID,
+		Username: b.cfg.Username,
+		Password: b.cfg.Password,
+		Will:     &mqtt.Message{Topic: b.AvailabilityTopic(), Payload: []byte("offline"), Retain: true},
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := b.announce(client); err != nil {
+		return err
+	}
+	prefix := b.cfg.BaseTopic + "/"
+	err = client.Subscribe(prefix+"+/set", func(m mqtt.Message) {
+		b.error(b.command(client, strings.TrimPrefix(m.Topic, prefix), m.Payload))
+	})
+	if err != nil {
+		return err
+	}
+	// Home Assistant publishes "online" on its status topic when it starts,
+	// which requires the discovery configs to be published again.
+	err = client.Subscribe(b.cfg.DiscoveryPrefix+"/status", func(m mqtt.Message) {
+		if string(m.Payload) == "online" {
+			b.error(b.announce(client))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return client.Publish(mqtt.Message{Topic: b.AvailabilityTopic(), Payload: []byte("offline"), Retain: true})
+	case <-client.Done():
+		return client.Err()
+	}
+}
+
+// announce publishes the discovery configs, the availability and the states.
+func (b *Bridge) announce(client *mqtt.Client) error {
+	for _, l := range b.lights {
+		payload, err := json.Marshal(b.Discovery(l.channel))
+		if err != nil {
+			return err
+		}
+		if err := client.Publish(mqtt.Message{Topic: b.DiscoveryTopic(l.channel), Payload: payload, Retain: true}); err != nil {
+			return err
+		}
+	}
+	if err := client.Publish(mqtt.Message{Topic: b.AvailabilityTopic(), Payload: []byte("online"), Retain: true}); err != nil {
+		return err
+	}
+	for _, l := range b.lights {
+		if err := b.publishState(client, l.channel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// command applies the payload received on the command topic of a channel,
+// whose name is relative to the base topic ("channel<N>/set").
+func (b *Bridge) command(client *mqtt.Client, topic string, payload []byte) error {
+	channel, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(topic, "channel"), "/set"))
+	if err != nil {
+		return fmt.Errorf("invalid command topic %q", topic)
+	}
+	var cmd Command
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return err
+	}
+	err = b.Apply(channel, cmd)
+	// the state is published even on error, so that Home Assistant reverts
+	// its optimistic view of the light
+	if perr := b.publishState(client, channel); err == nil {
+		err = perr
+	}
+	return err
+}
+
+func (b *Bridge) publishState(client *mqtt.Client, channel int) error {
+	s, err := b.State(channel)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return client.Publish(mqtt.Message{Topic: b.StateTopic(channel), Payload: payload, Retain: true})
+}
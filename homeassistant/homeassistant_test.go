@@ -0,0 +1,153 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/controller"
+	"github.com/rpi-ws281x/rpi-ws281x-go/internal/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBridge(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	broker := mqtt.MakeBroker()
+	go broker.Serve(l) //nolint: errcheck
+	defer broker.Close()
+
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{
+		{LedCount: 3, Brightness: 128, StripeType: ws2811.WS2812Strip},
+		{LedCount: 2, Brightness: 255, StripeType: ws2811.SK6812StripGRBW},
+	}}
+	dev, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, dev.Init())
+	ctrl := controller.MakeController(dev, &opt, 0)
+
+	bridge := MakeBridge(ctrl, Config{Broker: l.Addr().String(), NodeID: "test", RetryInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		assert.Nil(t, bridge.Run(ctx))
+		close(done)
+	}()
+
+	ha, err := mqtt.Dial(l.Addr().String(), mqtt.Options{ClientID: "ha"})
+	assert.Nil(t, err)
+	defer ha.Close()
+	states := make(chan State, 16)
+	assert.Nil(t, ha.Subscribe("ws281x/test/channel1/state", func(m mqtt.Message) {
+		var s State
+		assert.Nil(t, json.Unmarshal(m.Payload, &s))
+		states <- s
+	}))
+
+	// discovery
+	assert.Eventually(t, func() bool {
+		m, ok := broker.Retained("homeassistant/light/test/channel1/config")
+		return ok && len(m.Payload) > 0
+	}, 2*time.Second, 10*time.Millisecond)
+	m, _ := broker.Retained("homeassistant/light/test/channel1/config")
+	var d Discovery
+	assert.Nil(t, json.Unmarshal(m.Payload, &d))
+	assert.Equal(t, "test_channel1", d.UniqueID)
+	assert.Equal(t, "json", d.Schema)
+	assert.Equal(t, "ws281x/test/channel1/set", d.CommandTopic)
+	assert.Equal(t, []string{"rgbw"}, d.SupportedColorModes)
+	assert.Contains(t, d.EffectList, "rainbow")
+	m, _ = broker.Retained("homeassistant/light/test/channel0/config")
+	assert.Nil(t, json.Unmarshal(m.Payload, &d))
+	assert.Equal(t, []string{"rgb"}, d.SupportedColorModes)
+	m, _ = broker.Retained("ws281x/test/availability")
+	assert.Equal(t, "online", string(m.Payload))
+
+	next := func() State {
+		select {
+		case s := <-states:
+			return s
+		case <-time.After(2 * time.Second):
+			t.Fatal("no state published")
+			return State{}
+		}
+	}
+	assert.Equal(t, "ON", next().State)
+
+	// color command
+	cmd := `{"state":"ON","brightness":100,"color":{"r":255,"g":0,"b":16,"w":32}}`
+	assert.Nil(t, ha.Publish(mqtt.Message{Topic: "ws281x/test/channel1/set", Payload: []byte(cmd)}))
+	s := next()
+	assert.Equal(t, "rgbw", s.ColorMode)
+	assert.Equal(t, 100, s.Brightness)
+	assert.Equal(t, uint8(32), *s.Color.W)
+	pixels, _ := ctrl.Pixels(1)
+	assert.Equal(t, []uint32{0x20ff0010, 0x20ff0010}, pixels)
+	brightness, _ := ctrl.Brightness(1)
+	assert.Equal(t, 100, brightness)
+
+	// effect command
+	assert.Nil(t, ha.Publish(mqtt.Message{Topic: "ws281x/test/channel1/set", Payload: []byte(`{"effect":"rainbow"}`)}))
+	assert.Equal(t, "rainbow", next().Effect)
+	effect, _ := ctrl.Effect(1)
+	assert.Equal(t, "rainbow", effect)
+
+	// off
+	assert.Nil(t, ha.Publish(mqtt.Message{Topic: "ws281x/test/channel1/set", Payload: []byte(`{"state":"OFF"}`)}))
+	s = next()
+	assert.Equal(t, "OFF", s.State)
+	assert.Equal(t, 100, s.Brightness)
+	brightness, _ = ctrl.Brightness(1)
+	assert.Equal(t, 0, brightness)
+
+	// invalid effects are rejected and the state is published again
+	assert.Nil(t, ha.Publish(mqtt.Message{Topic: "ws281x/test/channel1/set", Payload: []byte(`{"effect":"nope"}`)}))
+	assert.Equal(t, "rainbow", next().Effect)
+
+	cancel()
+	<-done
+	assert.Eventually(t, func() bool {
+		m, _ := broker.Retained("ws281x/test/availability")
+		return string(m.Payload) == "offline"
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestApply(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 2, Brightness: 0}}}
+	dev, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, dev.Init())
+	ctrl := controller.MakeController(dev, &opt, 0)
+	bridge := MakeBridge(ctrl, Config{})
+
+	s, err := bridge.State(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "OFF", s.State)
+	assert.Equal(t, 255, s.Brightness)
+
+	assert.Nil(t, bridge.Apply(0, Command{State: "ON"}))
+	brightness, _ := ctrl.Brightness(0)
+	assert.Equal(t, 255, brightness)
+
+	bad := 300
+	assert.NotNil(t, bridge.Apply(0, Command{Brightness: &bad}))
+	assert.NotNil(t, bridge.Apply(0, Command{State: "maybe"}))
+	assert.NotNil(t, bridge.Apply(1, Command{State: "ON"}))
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dmx maps DMX512 universes onto the LEDs of WS2811 channels. It is
+// shared by the DMX over IP protocols (E1.31 and Art-Net).
+package dmx
+
+// Slots is the number of slots (bytes) of a DMX universe.
+const Slots = 512
+
+// Universe maps the slots of a DMX universe onto consecutive LEDs of a
+// channel. Each LED uses Components slots, in R, G, B (and W) order.
+type Universe struct {
+	// Number is the DMX universe number
+	Number uint16
+	// Channel is the WS2811 channel
+	Channel int
+	// Start is the index of the LED set by the first slot
+	Start int
+	// Count is the number of LEDs of the universe, 0 for as many as the
+	// universe can hold
+	Count int
+	// Components is the number of slots per LED: 3 for RGB (default) or 4 for RGBW
+	Components int
+}
+
+// Split returns the consecutive universes, starting with first, needed to
+// cover the LEDs of a channel. Each universe holds as many whole LEDs as
+// possible: 170 RGB LEDs or 128 RGBW LEDs.
+func Split(first uint16, channel int, ledCount int, components int) []Universe {
+	perUniverse := Slots / components
+	var universes []Universe
+	for start := 0; start < ledCount; start += perUniverse {
+		count := perUniverse
+		if start+count > ledCount {
+			count = ledCount - start
+		}
+		universes = append(universes, Universe{
+			Number:     first + uint16(len(universes)),
+			Channel:    channel,
+			Start:      start,
+			Count:      count,
+			Components: components,
+		})
+	}
+	return universes
+}
+
+// Write copies the LED values of the slots into leds. Slots beyond the end
+// of leds or of the universe are ignored.
+func (u *Universe) Write(leds []uint32, slots []byte) {
+	components := u.components()
+	for i := 0; i < u.count(len(slots)); i++ {
+		j := u.Start + i
+		if j < 0 || j >= len(leds) {
+			continue
+		}
+		s := slots[i*components:]
+		c := uint32(s[0])<<16 | uint32(s[1])<<8 | uint32(s[2])
+		if components == 4 {
+			c |= uint32(s[3]) << 24
+		}
+		leds[j] = c
+	}
+}
+
+// Clear sets the LEDs of the universe to black.
+func (u *Universe) Clear(leds []uint32) {
+	for i := 0; i < u.count(Slots); i++ {
+		if j := u.Start + i; j >= 0 && j < len(leds) {
+			leds[j] = 0
+		}
+	}
+}
+
+func (u *Universe) components() int {
+	if u.Components == 0 {
+		return 3
+	}
+	return u.Components
+}
+
+// count returns the number of LEDs set by the given number of slots.
+func (u *Universe) count(slots int) int {
+	n := slots / u.components()
+	if u.Count > 0 && u.Count < n {
+		n = u.Count
+	}
+	return n
+}
@@ -0,0 +1,232 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"sync"
+)
+
+// Broker is an in-process QoS 0 MQTT broker. It keeps retained messages and
+// publishes the will of clients that disconnect without a DISCONNECT packet.
+// It is intended for tests and small local setups.
+type Broker struct {
+	mu       sync.Mutex
+	conns    map[*brokerConn]struct{}
+	retained map[string]Message
+	listener net.Listener
+	closed   bool
+}
+
+type brokerConn struct {
+	conn    net.Conn
+	wmu     sync.Mutex
+	filters []string // protected by Broker.mu
+}
+
+// MakeBroker creates an empty broker.
+func MakeBroker() *Broker {
+	return &Broker{
+		conns:    make(map[*brokerConn]struct{}),
+		retained: make(map[string]Message),
+	}
+}
+
+// Serve accepts connections on a listener until Close is called.
+func (b *Broker) Serve(l net.Listener) error {
+	b.mu.Lock()
+	b.listener = l
+	b.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			b.mu.Lock()
+			closed := b.closed
+			b.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		go b.handle(conn)
+	}
+}
+
+// Close stops the broker and closes all the connections.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for c := range b.conns {
+		c.conn.Close()
+	}
+	if b.listener != nil {
+		return b.listener.Close()
+	}
+	return nil
+}
+
+func (c *brokerConn) write(p *packet) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(p.marshal())
+	return err
+}
+
+func (b *Broker) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	p, err := readPacket(r)
+	if err != nil || p.typ != typeConnect {
+		return
+	}
+	will, ok := parseConnect(p)
+	c := &brokerConn{conn: conn}
+	if !ok {
+		c.write(&packet{typ: typeConnack, body: []byte{0, 1}}) //nolint: errcheck
+		return
+	}
+	if err := c.write(&packet{typ: typeConnack, body: []byte{0, 0}}); err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.conns[c] = struct{}{}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.conns, c)
+		b.mu.Unlock()
+		if will != nil {
+			b.publish(*will)
+		}
+	}()
+
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch p.typ {
+		case typePublish:
+			m, id, err := parsePublish(p)
+			if err != nil {
+				return
+			}
+			if id != 0 {
+				c.write(&packet{typ: typePuback, body: binary.BigEndian.AppendUint16(nil, id)}) //nolint: errcheck
+			}
+			b.publish(m)
+		case typeSubscribe:
+			if !b.subscribe(c, p) {
+				return
+			}
+		case typePingreq:
+			c.write(&packet{typ: typePingresp}) //nolint: errcheck
+		case typeDisconnect:
+			will = nil
+			return
+		}
+	}
+}
+
+// parseConnect returns the will message of a CONNECT packet and whether the
+// protocol is supported.
+func parseConnect(p *packet) (*Message, bool) {
+	r := &reader{b: p.body}
+	name := r.string()
+	level := r.byte()
+	flags := r.byte()
+	r.uint16()
+	r.string()
+	var will *Message
+	if flags&0x04 != 0 {
+		will = &Message{Topic: r.string(), Retain: flags&0x20 != 0}
+		will.Payload = []byte(r.string())
+	}
+	return will, r.err == nil && name == "MQTT" && level == 4
+}
+
+func (b *Broker) subscribe(c *brokerConn, p *packet) bool {
+	r := &reader{b: p.body}
+	id := r.uint16()
+	var filters []string
+	for len(r.b) > 0 && r.err == nil {
+		filters = append(filters, r.string())
+		r.byte()
+	}
+	if r.err != nil || len(filters) == 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	c.filters = append(c.filters, filters...)
+	var retained []Message
+	for _, m := range b.retained {
+		for _, f := range filters {
+			if Match(f, m.Topic) {
+				retained = append(retained, m)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	ack := binary.BigEndian.AppendUint16(nil, id)
+	ack = append(ack, make([]byte, len(filters))...) // granted QoS 0
+	if err := c.write(&packet{typ: typeSuback, body: ack}); err != nil {
+		return false
+	}
+	for _, m := range retained {
+		c.write(publishPacket(m)) //nolint: errcheck
+	}
+	return true
+}
+
+func (b *Broker) publish(m Message) {
+	b.mu.Lock()
+	if m.Retain {
+		if len(m.Payload) == 0 {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m
+		}
+	}
+	var targets []*brokerConn
+	for c := range b.conns {
+		for _, f := range c.filters {
+			if Match(f, m.Topic) {
+				targets = append(targets, c)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	m.Retain = false
+	for _, c := range targets {
+		c.write(publishPacket(m)) //nolint: errcheck
+	}
+}
+
+// Retained returns the retained message of a topic.
+func (b *Broker) Retained(topic string) (Message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m, ok := b.retained[topic]
+	return m, ok
+}
@@ -0,0 +1,284 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultKeepAlive is the keep alive interval used when Options.KeepAlive is
+// zero.
+const DefaultKeepAlive = 30 * time.Second
+
+// ackTimeout is the time to wait for a CONNACK or a SUBACK.
+const ackTimeout = 10 * time.Second
+
+// Options is the list of connection options.
+type Options struct {
+	// ClientID identifies the client to the broker
+	ClientID string
+	// Username and Password are sent to the broker when Username is not empty
+	Username string
+	Password string
+	// KeepAlive is the maximum interval between two packets sent to the broker
+	KeepAlive time.Duration
+	// Will is published by the broker when the connection is lost
+	Will *Message
+}
+
+type subscription struct {
+	filter  string
+	handler func(Message)
+}
+
+// Client is a QoS 0 MQTT client.
+type Client struct {
+	conn      net.Conn
+	keepAlive time.Duration
+
+	wmu sync.Mutex // serializes writes
+
+	mu     sync.Mutex
+	subs   []subscription
+	acks   map[uint16]chan struct{}
+	nextID uint16
+	err    error
+
+	done chan struct{}
+}
+
+// Dial connects to a broker and waits for the connection to be accepted.
+func Dial(addr string, opts Options) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, ackTimeout)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Error connecting to MQTT broker")
+	}
+	c, err := MakeClient(conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// MakeClient sends the CONNECT packet on an established connection and waits
+// for the broker to accept it.
+func MakeClient(conn net.Conn, opts Options) (*Client, error) {
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+	c := &Client{
+		conn:      conn,
+		keepAlive: opts.KeepAlive,
+		acks:      make(map[uint16]chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if err := c.write(connectPacket(opts)); err != nil {
+		return nil, errors.WithMessage(err, "Error connecting to MQTT broker")
+	}
+
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(ackTimeout)) //nolint: errcheck
+	p, err := readPacket(r)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Error connecting to MQTT broker")
+	}
+	if p.typ != typeConnack || len(p.body) != 2 {
+		return nil, errors.New("Error connecting to MQTT broker: unexpected packet")
+	}
+	if code := p.body[1]; code != 0 {
+		return nil, fmt.Errorf("Error connecting to MQTT broker: connection refused (%d)", code)
+	}
+	conn.SetReadDeadline(time.Time{}) //nolint: errcheck
+
+	go c.readLoop(r)
+	go c.pingLoop()
+	return c, nil
+}
+
+func connectPacket(opts Options) *packet {
+	var flags byte = 0x02 // clean session
+	if opts.Will != nil {
+		flags |= 0x04
+		if opts.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	b := appendString(nil, "MQTT")
+	b = append(b, 4, flags)
+	b = binary.BigEndian.AppendUint16(b, uint16(opts.KeepAlive/time.Second))
+	b = appendString(b, opts.ClientID)
+	if opts.Will != nil {
+		b = appendString(b, opts.Will.Topic)
+		b = appendString(b, string(opts.Will.Payload))
+	}
+	if opts.Username != "" {
+		b = appendString(b, opts.Username)
+		if opts.Password != "" {
+			b = appendString(b, opts.Password)
+		}
+	}
+	return &packet{typ: typeConnect, body: b}
+}
+
+func (c *Client) write(p *packet) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(p.marshal())
+	return err
+}
+
+// Publish sends a message to the broker.
+func (c *Client) Publish(m Message) error {
+	if err := c.write(publishPacket(m)); err != nil {
+		return errors.WithMessage(err, "Error publishing MQTT message")
+	}
+	return nil
+}
+
+// Subscribe subscribes to a topic filter and waits for the broker to
+// acknowledge it. The handler is called from the goroutine that reads the
+// connection, so it must not block and must not call Subscribe.
+func (c *Client) Subscribe(filter string, handler func(Message)) error {
+	c.mu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	ack := make(chan struct{})
+	c.acks[id] = ack
+	c.subs = append(c.subs, subscription{filter: filter, handler: handler})
+	c.mu.Unlock()
+
+	b := binary.BigEndian.AppendUint16(nil, id)
+	b = appendString(b, filter)
+	b = append(b, 0)
+	if err := c.write(&packet{typ: typeSubscribe, flags: 0x02, body: b}); err != nil {
+		return errors.WithMessage(err, "Error subscribing to MQTT topic")
+	}
+
+	select {
+	case <-ack:
+		return nil
+	case <-c.done:
+		return errors.WithMessage(c.Err(), "Error subscribing to MQTT topic")
+	case <-time.After(ackTimeout):
+		return errors.New("Error subscribing to MQTT topic: timeout")
+	}
+}
+
+func (c *Client) readLoop(r *bufio.Reader) {
+	// A PINGREQ is sent every half keep alive interval: the connection is
+	// lost if the broker sends nothing, not even a PINGRESP, for one and a
+	// half interval.
+	timeout := c.keepAlive * 3 / 2
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(timeout)) //nolint: errcheck
+		p, err := readPacket(r)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		switch p.typ {
+		case typePublish:
+			m, _, err := parsePublish(p)
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			c.dispatch(m)
+		case typeSuback:
+			if len(p.body) >= 2 {
+				id := binary.BigEndian.Uint16(p.body)
+				c.mu.Lock()
+				if ack, ok := c.acks[id]; ok {
+					close(ack)
+					delete(c.acks, id)
+				}
+				c.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (c *Client) dispatch(m Message) {
+	c.mu.Lock()
+	subs := c.subs
+	c.mu.Unlock()
+	for _, s := range subs {
+		if Match(s.filter, m.Topic) {
+			s.handler(m)
+		}
+	}
+}
+
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.write(&packet{typ: typePingreq}); err != nil {
+				c.fail(err)
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+	}
+	c.conn.Close()
+}
+
+// Done returns a channel that is closed when the connection is lost or closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error that closed the connection, if any.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close disconnects from the broker. The will message is not published.
+func (c *Client) Close() error {
+	err := c.write(&packet{typ: typeDisconnect})
+	c.fail(net.ErrClosed)
+	return err
+}
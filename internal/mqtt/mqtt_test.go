@@ -0,0 +1,153 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqtt
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		match         bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a/b/c", true},
+		{"a/#", "a", true},
+		{"#", "a/b", true},
+		{"+/b", "a/b", true},
+		{"a/b/c", "a/b", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, Match(c.filter, c.topic), "%s %s", c.filter, c.topic)
+	}
+}
+
+func startBroker(t *testing.T) (*Broker, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	b := MakeBroker()
+	go b.Serve(l) //nolint: errcheck
+	t.Cleanup(func() { b.Close() })
+	return b, l.Addr().String()
+}
+
+func receive(t *testing.T, ch <-chan Message) Message {
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+		return Message{}
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	_, addr := startBroker(t)
+
+	pub, err := Dial(addr, Options{ClientID: "pub"})
+	assert.Nil(t, err)
+	defer pub.Close()
+	assert.Nil(t, pub.Publish(Message{Topic: "lights/0/state", Payload: []byte("on"), Retain: true}))
+
+	sub, err := Dial(addr, Options{ClientID: "sub"})
+	assert.Nil(t, err)
+	defer sub.Close()
+	received := make(chan Message, 4)
+	assert.Nil(t, sub.Subscribe("lights/+/state", func(m Message) { received <- m }))
+
+	m := receive(t, received)
+	assert.Equal(t, "lights/0/state", m.Topic)
+	assert.Equal(t, "on", string(m.Payload))
+	assert.True(t, m.Retain)
+
+	assert.Nil(t, pub.Publish(Message{Topic: "lights/1/state", Payload: []byte("off")}))
+	assert.Nil(t, pub.Publish(Message{Topic: "other", Payload: []byte("x")}))
+	m = receive(t, received)
+	assert.Equal(t, "lights/1/state", m.Topic)
+	assert.False(t, m.Retain)
+}
+
+func TestWill(t *testing.T) {
+	b, addr := startBroker(t)
+
+	c, err := Dial(addr, Options{
+		ClientID: "dev",
+		Will:     &Message{Topic: "dev/availability", Payload: []byte("offline"), Retain: true},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, c.Publish(Message{Topic: "dev/availability", Payload: []byte("online"), Retain: true}))
+
+	// A clean disconnect does not publish the will.
+	assert.Nil(t, c.Close())
+	time.Sleep(50 * time.Millisecond)
+	m, _ := b.Retained("dev/availability")
+	assert.Equal(t, "online", string(m.Payload))
+
+	c, err = Dial(addr, Options{
+		ClientID: "dev",
+		Will:     &Message{Topic: "dev/availability", Payload: []byte("offline"), Retain: true},
+	})
+	assert.Nil(t, err)
+	c.conn.Close()
+	assert.Eventually(t, func() bool {
+		m, _ := b.Retained("dev/availability")
+		return string(m.Payload) == "offline"
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestKeepAlive(t *testing.T) {
+	_, addr := startBroker(t)
+	c, err := Dial(addr, Options{ClientID: "alive", KeepAlive: 100 * time.Millisecond})
+	assert.Nil(t, err)
+	defer c.Close()
+
+	// A broker that does not answer the PINGREQ packets.
+	client, server := net.Pipe()
+	go func() {
+		r := bufio.NewReader(server)
+		if _, err := readPacket(r); err != nil {
+			return
+		}
+		server.Write((&packet{typ: typeConnack, body: []byte{0, 0}}).marshal()) //nolint: errcheck
+		for {
+			if _, err := readPacket(r); err != nil {
+				return
+			}
+		}
+	}()
+	dead, err := MakeClient(client, Options{ClientID: "dead", KeepAlive: 100 * time.Millisecond})
+	assert.Nil(t, err)
+
+	select {
+	case <-dead.Done():
+		assert.NotNil(t, dead.Err())
+	case <-time.After(2 * time.Second):
+		t.Fatal("the connection is not closed without PINGRESP")
+	}
+	select {
+	case <-c.Done():
+		t.Fatal("the connection is closed with PINGRESP")
+	default:
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mqtt is a minimal MQTT 3.1.1 client and in-process broker. It only
+// supports QoS 0, which is all that the Home Assistant integration needs, and
+// keeps the module free of a dependency on a full MQTT implementation.
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Packet types.
+const (
+	typeConnect    = 1
+	typeConnack    = 2
+	typePublish    = 3
+	typePuback     = 4
+	typeSubscribe  = 8
+	typeSuback     = 9
+	typePingreq    = 12
+	typePingresp   = 13
+	typeDisconnect = 14
+)
+
+// maxPacket limits the memory allocated for a packet.
+const maxPacket = 1 << 20
+
+var errMalformed = errors.New("mqtt: malformed packet")
+
+// Message is an application message.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+type packet struct {
+	typ   byte
+	flags byte
+	body  []byte
+}
+
+func readPacket(r *bufio.Reader) (*packet, error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	for shift := 0; ; shift += 7 {
+		if shift > 21 {
+			return nil, errMalformed
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		size |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if size > maxPacket {
+		return nil, errMalformed
+	}
+	p := &packet{typ: h >> 4, flags: h & 0x0f, body: make([]byte, size)}
+	if _, err := io.ReadFull(r, p.body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *packet) marshal() []byte {
+	b := []byte{p.typ<<4 | p.flags}
+	size := len(p.body)
+	for {
+		c := byte(size & 0x7f)
+		size >>= 7
+		if size > 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if size == 0 {
+			break
+		}
+	}
+	return append(b, p.body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// reader decodes the fields of a packet body.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errMalformed
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) string() string {
+	return string(r.bytes(int(r.uint16())))
+}
+
+func publishPacket(m Message) *packet {
+	var flags byte
+	if m.Retain {
+		flags = 1
+	}
+	return &packet{typ: typePublish, flags: flags, body: append(appendString(nil, m.Topic), m.Payload...)}
+}
+
+// parsePublish decodes a PUBLISH packet and returns the message and the
+// packet identifier (0 for QoS 0).
+func parsePublish(p *packet) (Message, uint16, error) {
+	r := &reader{b: p.body}
+	m := Message{Topic: r.string(), Retain: p.flags&1 != 0}
+	var id uint16
+	if (p.flags>>1)&3 > 0 {
+		id = r.uint16()
+	}
+	m.Payload = r.b
+	return m, id, r.err
+}
+
+// Match reports whether a topic matches a filter with the + and # wildcards.
+func Match(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		switch {
+		case level == "#":
+			return true
+		case i >= len(t):
+			return false
+		case level != "+" && level != t[i]:
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package layout maps the LEDs of a channel to the cells of a rectangular
+// grid, for strips (a single row) and for matrices wired row by row, possibly
+// in a serpentine pattern.
+package layout
+
+import "fmt"
+
+// Layout is the arrangement of the LEDs of a channel. LED 0 is at the top
+// left corner and the LEDs follow the rows. A zero Layout is a strip.
+type Layout struct {
+	// Width is the number of LEDs in a row
+	Width int `json:"width"`
+	// Height is the number of rows
+	Height int `json:"height"`
+	// Serpentine is set when every other row is wired right to left
+	Serpentine bool `json:"serpentine,omitempty"`
+}
+
+// Strip returns the layout of a strip of n LEDs.
+func Strip(n int) Layout {
+	return Layout{Width: n, Height: 1}
+}
+
+// Matrix returns the layout of a matrix.
+func Matrix(width, height int, serpentine bool) Layout {
+	return Layout{Width: width, Height: height, Serpentine: serpentine}
+}
+
+// Parse parses a layout from "strip" (or the empty string) or from
+// "<width>x<height>", optionally followed by "s" for a serpentine matrix,
+// e.g. "16x16s". ledCount is the number of LEDs of the channel, used for
+// strips.
+func Parse(s string, ledCount int) (Layout, error) {
+	if s == "" || s == "strip" {
+		return Strip(ledCount), nil
+	}
+	var l Layout
+	var suffix string
+	n, _ := fmt.Sscanf(s, "%dx%d%s", &l.Width, &l.Height, &suffix)
+	switch {
+	case n < 2 || l.Width <= 0 || l.Height <= 0:
+		return Layout{}, fmt.Errorf("invalid layout %q", s)
+	case suffix == "s":
+		l.Serpentine = true
+	case suffix != "":
+		return Layout{}, fmt.Errorf("invalid layout %q", s)
+	}
+	return l, nil
+}
+
+// For returns the layout itself, or a strip of ledCount LEDs if it is the
+// zero Layout.
+func (l Layout) For(ledCount int) Layout {
+	if l.Width <= 0 || l.Height <= 0 {
+		return Strip(ledCount)
+	}
+	return l
+}
+
+// Len returns the number of cells of the layout.
+func (l Layout) Len() int {
+	return l.Width * l.Height
+}
+
+// Index returns the index of the LED at column x and row y, or -1 if the cell
+// is outside of the layout.
+func (l Layout) Index(x, y int) int {
+	if x < 0 || y < 0 || x >= l.Width || y >= l.Height {
+		return -1
+	}
+	if l.Serpentine && y%2 == 1 {
+		x = l.Width - 1 - x
+	}
+	return y*l.Width + x
+}
+
+// XY returns the column and the row of an LED. All the LEDs of a zero Layout
+// are on the first row.
+func (l Layout) XY(index int) (x, y int) {
+	if l.Width <= 0 {
+		return index, 0
+	}
+	y, x = index/l.Width, index%l.Width
+	if l.Serpentine && y%2 == 1 {
+		x = l.Width - 1 - x
+	}
+	return x, y
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayout(t *testing.T) {
+	l := Matrix(3, 2, true)
+	assert.Equal(t, 0, l.Index(0, 0))
+	assert.Equal(t, 2, l.Index(2, 0))
+	assert.Equal(t, 5, l.Index(0, 1))
+	assert.Equal(t, 3, l.Index(2, 1))
+	assert.Equal(t, -1, l.Index(3, 0))
+	for i := 0; i < l.Len(); i++ {
+		x, y := l.XY(i)
+		assert.Equal(t, i, l.Index(x, y))
+	}
+
+	l = Matrix(3, 2, false)
+	assert.Equal(t, 5, l.Index(2, 1))
+	x, y := l.XY(4)
+	assert.Equal(t, []int{1, 1}, []int{x, y})
+
+	assert.Equal(t, Strip(8), Layout{}.For(8))
+	x, y = Layout{}.XY(5)
+	assert.Equal(t, []int{5, 0}, []int{x, y})
+}
+
+func TestParse(t *testing.T) {
+	l, err := Parse("", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, Strip(10), l)
+	l, err = Parse("16x8", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, Matrix(16, 8, false), l)
+	l, err = Parse("16x8s", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, Matrix(16, 8, true), l)
+	for _, s := range []string{"16", "0x8", "16x8z", "foo"} {
+		_, err = Parse(s, 10)
+		assert.NotNil(t, err, s)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+)
+
+// DialTimeout is the maximum time to connect to the server.
+const DialTimeout = 5 * time.Second
+
+// Client drives a remote device through an OPC server. It implements
+// ws2811.Device: channel N of the client is sent to OPC channel N+1, which
+// the server maps to its channel N by default. The white component of the
+// LEDs is not sent, as OPC only supports RGB.
+//
+// A frame is sent as SysExPixelColors messages followed by one SysExRender,
+// so that the server renders once per frame, whatever the number of channels.
+type Client struct {
+	addr       string
+	opt        *ws2811.Option
+	conn       net.Conn
+	leds       [][]uint32
+	brightness []int
+	// err is the last error of SetBrightness, returned by the next Render
+	err error
+}
+
+var _ ws2811.Device = (*Client)(nil)
+
+// MakeClient creates a client for the OPC server at addr. The LED count and
+// the brightness of the channels are taken from opt.
+func MakeClient(addr string, opt *ws2811.Option) (*Client, error) {
+	c := &Client{addr: addr, opt: opt, brightness: make([]int, ws2811.RpiPwmChannels)}
+	for i, ch := range opt.Channels {
+		if i < len(c.brightness) {
+			c.brightness[i] = ch.Brightness
+		}
+	}
+	return c, nil
+}
+
+// Init connects to the server and sends the brightness of the channels.
+func (c *Client) Init() error {
+	if c.conn != nil {
+		return errors.New("device already initialized")
+	}
+	conn, err := net.DialTimeout("tcp", c.addr, DialTimeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.leds = make([][]uint32, ws2811.RpiPwmChannels)
+	for i := range c.leds {
+		if i < len(c.opt.Channels) {
+			c.leds[i] = make([]uint32, c.opt.Channels[i].LedCount)
+		} else {
+			c.leds[i] = make([]uint32, 0)
+		}
+	}
+	for i, ch := range c.opt.Channels {
+		if ch.LedCount > 0 {
+			c.SetBrightness(i, c.brightness[i])
+		}
+	}
+	return c.err
+}
+
+// Fini closes the connection.
+func (c *Client) Fini() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// Leds returns the LEDs array of a given channel
+func (c *Client) Leds(channel int) []uint32 {
+	return c.leds[channel]
+}
+
+// Render sends the LEDs of all channels to the server, which renders them
+// once.
+func (c *Client) Render() error {
+	if c.conn == nil {
+		return errors.New("device not initialized")
+	}
+	if c.err != nil {
+		err := c.err
+		c.err = nil
+		return err
+	}
+	var buf bytes.Buffer
+	for i, leds := range c.leds {
+		if len(leds) == 0 {
+			continue
+		}
+		data := sysEx(SysExPixelColors, 3*len(leds))
+		for _, led := range leds {
+			data = append(data, byte(led>>16), byte(led>>8), byte(led))
+		}
+		m := &Message{Channel: uint8(i + 1), Command: CmdSystemExclusive, Data: data}
+		if _, err := m.WriteTo(&buf); err != nil {
+			return err
+		}
+	}
+	m := &Message{Channel: 0, Command: CmdSystemExclusive, Data: sysEx(SysExRender, 0)}
+	if _, err := m.WriteTo(&buf); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(buf.Bytes())
+	return err
+}
+
+// Wait returns immediately: the frames are queued by the TCP connection.
+func (c *Client) Wait() error {
+	return nil
+}
+
+// SetBrightness changes the brightness of a given channel on the server.
+// Before Init, the brightness is only recorded and sent by Init. Errors are
+// returned by the next call to Render.
+func (c *Client) SetBrightness(channel int, brightness int) {
+	if channel >= 0 && channel < len(c.brightness) {
+		c.brightness[channel] = brightness
+	}
+	if c.conn == nil {
+		return
+	}
+	m := &Message{
+		Channel: uint8(channel + 1),
+		Command: CmdSystemExclusive,
+		Data:    append(sysEx(SysExBrightness, 1), uint8(brightness)),
+	}
+	if _, err := m.WriteTo(c.conn); err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+// sysEx returns the beginning of the data of a system exclusive command of
+// this package, with room for size more bytes.
+func sysEx(command byte, size int) []byte {
+	data := make([]byte, 3, 3+size)
+	binary.BigEndian.PutUint16(data, SystemID)
+	data[2] = command
+	return data
+}
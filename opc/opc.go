@@ -0,0 +1,93 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package opc implements the Open Pixel Control protocol over TCP: a server
+// that drives the channels of a WS2811 device and a client that implements
+// ws2811.Device, so that a remote device can be driven as if it were local.
+package opc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// DefaultPort is the TCP port of OPC.
+const DefaultPort = 7890
+
+// OPC commands.
+const (
+	CmdSetPixelColors  = 0
+	CmdSystemExclusive = 255
+)
+
+// SystemID is the system ID of the system exclusive commands of this package.
+const SystemID = 0x5753
+
+// System exclusive commands of this package. The first byte of the data after
+// the system ID is the command.
+const (
+	// SysExBrightness sets the brightness of the channel to the next byte
+	SysExBrightness = 0x01
+	// SysExPixelColors sets the LEDs of the channel like CmdSetPixelColors,
+	// without rendering them
+	SysExPixelColors = 0x02
+	// SysExRender renders the LEDs of all channels
+	SysExRender = 0x03
+)
+
+const headerLen = 4
+
+// Message is an OPC message.
+type Message struct {
+	// Channel is the OPC channel, 0 for all channels
+	Channel uint8
+	// Command is the OPC command
+	Command uint8
+	// Data is the payload of the command
+	Data []byte
+}
+
+// ReadMessage reads a message.
+func ReadMessage(r io.Reader) (*Message, error) {
+	var h [headerLen]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, err
+	}
+	m := &Message{
+		Channel: h[0],
+		Command: h[1],
+		Data:    make([]byte, binary.BigEndian.Uint16(h[2:])),
+	}
+	if _, err := io.ReadFull(r, m.Data); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteTo writes the message to w. The data of a message can not be longer
+// than 65535 bytes.
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	if len(m.Data) > math.MaxUint16 {
+		return 0, fmt.Errorf("OPC message too long: %d bytes", len(m.Data))
+	}
+	b := make([]byte, headerLen+len(m.Data))
+	b[0] = m.Channel
+	b[1] = m.Command
+	binary.BigEndian.PutUint16(b[2:], uint16(len(m.Data)))
+	copy(b[headerLen:], m.Data)
+	n, err := w.Write(b)
+	return int64(n), err
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opc
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// device is a simulated device that reports renders and brightness changes.
+type device struct {
+	*ws2811.WS2811
+	rendered   chan []uint32
+	brightness [ws2811.RpiPwmChannels]int
+}
+
+func (d *device) Render() error {
+	d.rendered <- append(append([]uint32(nil), d.Leds(0)...), d.Leds(1)...)
+	return nil
+}
+
+func (d *device) SetBrightness(channel int, brightness int) {
+	d.brightness[channel] = brightness
+}
+
+func TestClientServer(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{
+		{LedCount: 3, Brightness: 10},
+		{LedCount: 1, Brightness: 5},
+	}}
+	ws, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	dev := &device{WS2811: ws, rendered: make(chan []uint32, 16)}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := MakeServer(dev, Config{})
+	go s.Serve(l) // nolint: errcheck
+	defer s.Close()
+
+	expectFrame := func(want []uint32) {
+		select {
+		case got := <-dev.rendered:
+			assert.Equal(t, want, got)
+		case <-time.After(time.Second):
+			t.Fatal("no frame rendered")
+		}
+	}
+
+	c, err := MakeClient(l.Addr().String(), &opt)
+	assert.Nil(t, err)
+	// before Init, the brightness is recorded for Init
+	c.SetBrightness(1, 20)
+	assert.NotNil(t, c.Render())
+	assert.Nil(t, c.Init())
+	defer c.Fini()
+
+	// the brightness of both channels is set at init
+	expectFrame([]uint32{0, 0, 0, 0})
+	expectFrame([]uint32{0, 0, 0, 0})
+	assert.Equal(t, [ws2811.RpiPwmChannels]int{10, 20}, dev.brightness)
+
+	copy(c.Leds(0), []uint32{0x010203, 0x040506, 0x070809})
+	c.Leds(1)[0] = 0xff0a0b0c
+	assert.Nil(t, c.Render())
+	assert.Nil(t, c.Wait())
+	// one frame for both channels
+	expectFrame([]uint32{0x010203, 0x040506, 0x070809, 0x0a0b0c})
+
+	// broadcast to all channels
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, err = (&Message{Channel: 0, Command: CmdSetPixelColors, Data: []byte{1, 1, 1}}).WriteTo(conn)
+	assert.Nil(t, err)
+	expectFrame([]uint32{0x010101, 0x040506, 0x070809, 0x010101})
+}
+
+func TestSysExHandler(t *testing.T) {
+	var got []byte
+	s := MakeServer(nil, Config{SysEx: func(channel uint8, id uint16, data []byte) error {
+		assert.Equal(t, uint8(3), channel)
+		assert.Equal(t, uint16(0x0001), id)
+		got = data
+		return nil
+	}})
+	assert.Nil(t, s.handle(&Message{Channel: 3, Command: CmdSystemExclusive, Data: []byte{0, 1, 42}}))
+	assert.Equal(t, []byte{42}, got)
+}
+
+func TestMessageTooLong(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := (&Message{Data: make([]byte, 65536)}).WriteTo(&buf)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, buf.Len())
+	_, err = (&Message{Data: make([]byte, 65535)}).WriteTo(&buf)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+)
+
+// Config is the configuration of a Server.
+type Config struct {
+	// Addr is the TCP address to listen on (default ":7890")
+	Addr string
+	// Channels maps OPC channels to WS2811 channels. By default OPC channel 1
+	// is channel 0 and OPC channel 2 is channel 1.
+	Channels map[uint8]int
+	// SysEx handles the system exclusive messages that are not for SystemID.
+	// They are ignored if nil.
+	SysEx func(channel uint8, systemID uint16, data []byte) error
+}
+
+// Server is an OPC server.
+type Server struct {
+	dev ws2811.Device
+	cfg Config
+
+	// mu serializes the access to the device and to the server state
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool
+	closed   bool
+}
+
+// MakeServer creates a server for a device. The device must be initialized.
+func MakeServer(dev ws2811.Device, cfg Config) *Server {
+	if cfg.Addr == "" {
+		cfg.Addr = fmt.Sprintf(":%d", DefaultPort)
+	}
+	if cfg.Channels == nil {
+		cfg.Channels = map[uint8]int{1: 0, 2: 1}
+	}
+	return &Server{dev: dev, cfg: cfg, conns: make(map[net.Conn]bool)}
+}
+
+// ListenAndServe listens on the configured address and serves the clients
+// until Close is called.
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts clients from l until Close is called. Serve closes l when it
+// returns.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return net.ErrClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the server and disconnects the clients.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		m, err := ReadMessage(conn)
+		if err != nil {
+			return
+		}
+		if err := s.handle(m); err != nil {
+			return
+		}
+	}
+}
+
+// channels returns the WS2811 channels addressed by an OPC channel.
+func (s *Server) channels(opc uint8) []int {
+	if opc != 0 {
+		if channel, ok := s.cfg.Channels[opc]; ok {
+			return []int{channel}
+		}
+		return nil
+	}
+	all := make([]int, 0, len(s.cfg.Channels))
+	for _, channel := range s.cfg.Channels {
+		all = append(all, channel)
+	}
+	return all
+}
+
+// handle processes a message. Errors of the device are returned and close
+// the connection.
+func (s *Server) handle(m *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch m.Command {
+	case CmdSetPixelColors:
+		channels := s.channels(m.Channel)
+		if len(channels) == 0 {
+			return nil
+		}
+		s.setPixels(channels, m.Data)
+		return s.dev.Render()
+	case CmdSystemExclusive:
+		if len(m.Data) < 2 {
+			return nil
+		}
+		id := binary.BigEndian.Uint16(m.Data)
+		if id != SystemID {
+			if s.cfg.SysEx != nil {
+				return s.cfg.SysEx(m.Channel, id, m.Data[2:])
+			}
+			return nil
+		}
+		return s.handleSysEx(m.Channel, m.Data[2:])
+	}
+	return nil
+}
+
+// handleSysEx processes the system exclusive messages of this package.
+// Incomplete messages are ignored.
+func (s *Server) handleSysEx(opc uint8, data []byte) error {
+	if len(data) < 1 {
+		return nil
+	}
+	switch data[0] {
+	case SysExBrightness:
+		if len(data) < 2 {
+			return nil
+		}
+		for _, channel := range s.channels(opc) {
+			s.dev.SetBrightness(channel, int(data[1]))
+		}
+		return s.dev.Render()
+	case SysExPixelColors:
+		s.setPixels(s.channels(opc), data[1:])
+	case SysExRender:
+		return s.dev.Render()
+	}
+	return nil
+}
+
+// setPixels copies RGB pixel data into the LEDs of channels.
+func (s *Server) setPixels(channels []int, data []byte) {
+	for _, channel := range channels {
+		leds := s.dev.Leds(channel)
+		for i := 0; i < len(leds) && 3*i+2 < len(data); i++ {
+			leds[i] = uint32(data[3*i])<<16 | uint32(data[3*i+1])<<8 | uint32(data[3*i+2])
+		}
+	}
+}
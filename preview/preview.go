@@ -0,0 +1,333 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package preview streams the frames rendered by a device to web browsers over
+// WebSocket, and lets them paint the LEDs.
+//
+// Preview wraps a Device: every Render is forwarded to the wrapped device and
+// the new frame is sent to the connected clients. The handler serves a page
+// that draws each channel as a strip or a matrix (see layout) on /, and the
+// WebSocket endpoint on /ws.
+//
+// The protocol of the endpoint is the following. When a client connects, the
+// server sends a JSON text message describing the channels (see Hello). Each
+// frame is then sent as one binary message per channel:
+//
+//	byte 0     channel
+//	byte 1     brightness
+//	bytes 2-3  index of the first LED (big endian)
+//	bytes 4-   LEDs, 4 bytes each (0xWWRRGGBB, big endian)
+//
+// Clients paint with binary messages in the same format; the brightness byte
+// is ignored.
+package preview
+
+import (
+	_ "embed" // for the page
+	"encoding/binary"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/layout"
+)
+
+// DefaultMaxFPS is the maximum frame rate of a client when Config.MaxFPS is
+// zero.
+const DefaultMaxFPS = 30
+
+// headerLen is the length of the header of a binary message.
+const headerLen = 4
+
+// writeTimeout is the time allowed to write a message to a client.
+const writeTimeout = 5 * time.Second
+
+//go:embed preview.html
+var page []byte
+
+// Config is the configuration of a Preview.
+type Config struct {
+	// Layouts are the layouts of the channels, strips if missing
+	Layouts map[int]layout.Layout
+	// MaxFPS is the maximum number of frames per second sent to a client, as
+	// well as the maximum number of paint messages per second accepted from
+	// a client. A client can ask for a lower rate with the fps query
+	// parameter.
+	MaxFPS int
+	// ReadOnly disables painting
+	ReadOnly bool
+	// Paint, if not nil, applies the LEDs painted by a client. By default,
+	// they are copied into the LEDs array of the device, which is rendered.
+	Paint func(channel, start int, leds []uint32) error
+	// CheckOrigin is passed to the WebSocket upgrader; nil only accepts
+	// requests from the same origin
+	CheckOrigin func(r *http.Request) bool
+}
+
+// Hello is the first message sent to a client.
+type Hello struct {
+	MaxFPS   int       `json:"max_fps"`
+	ReadOnly bool      `json:"read_only"`
+	Channels []Channel `json:"channels"`
+}
+
+// Channel describes a channel in Hello.
+type Channel struct {
+	LedCount   int           `json:"led_count"`
+	StripeType int           `json:"stripe_type"`
+	Layout     layout.Layout `json:"layout"`
+}
+
+// Preview is a Device that sends its frames to WebSocket clients.
+type Preview struct {
+	ws2811.Device
+	cfg      Config
+	hello    Hello
+	upgrader websocket.Upgrader
+
+	mu         sync.Mutex
+	brightness []int
+	frame      [][]uint32
+	clients    map[*client]struct{}
+
+	paintMu sync.Mutex
+}
+
+type client struct {
+	conn   *websocket.Conn
+	notify chan struct{}
+	done   chan struct{}
+	period time.Duration
+}
+
+// MakePreview creates a Preview for an initialized device created with opt.
+func MakePreview(dev ws2811.Device, opt *ws2811.Option, cfg Config) *Preview {
+	if cfg.MaxFPS <= 0 {
+		cfg.MaxFPS = DefaultMaxFPS
+	}
+	p := &Preview{
+		Device:     dev,
+		cfg:        cfg,
+		hello:      Hello{MaxFPS: cfg.MaxFPS, ReadOnly: cfg.ReadOnly},
+		upgrader:   websocket.Upgrader{CheckOrigin: cfg.CheckOrigin},
+		brightness: make([]int, len(opt.Channels)),
+		frame:      make([][]uint32, len(opt.Channels)),
+		clients:    make(map[*client]struct{}),
+	}
+	for i, ch := range opt.Channels {
+		p.brightness[i] = ch.Brightness
+		p.frame[i] = make([]uint32, len(dev.Leds(i)))
+		p.hello.Channels = append(p.hello.Channels, Channel{
+			LedCount:   ch.LedCount,
+			StripeType: ch.StripeType,
+			Layout:     cfg.Layouts[i].For(ch.LedCount),
+		})
+	}
+	return p
+}
+
+// Render renders the frame on the wrapped device and sends it to the clients.
+func (p *Preview) Render() error {
+	err := p.Device.Render()
+	p.mu.Lock()
+	for i := range p.frame {
+		copy(p.frame[i], p.Device.Leds(i))
+	}
+	for c := range p.clients {
+		select {
+		case c.notify <- struct{}{}:
+		default: // the client has not sent the previous frame yet
+		}
+	}
+	p.mu.Unlock()
+	return err
+}
+
+// SetBrightness changes the brightness of a channel of the wrapped device.
+// The channels that are not in the options of the preview are not shown.
+func (p *Preview) SetBrightness(channel int, brightness int) {
+	p.Device.SetBrightness(channel, brightness)
+	p.mu.Lock()
+	if channel >= 0 && channel < len(p.brightness) {
+		p.brightness[channel] = brightness
+	}
+	p.mu.Unlock()
+}
+
+// Clients returns the number of connected clients.
+func (p *Preview) Clients() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.clients)
+}
+
+// ServeHTTP serves the page, or the WebSocket endpoint for paths ending with
+// /ws.
+func (p *Preview) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/ws") {
+		p.serveWS(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page) // nolint: errcheck
+}
+
+func (p *Preview) serveWS(w http.ResponseWriter, r *http.Request) {
+	fps := p.cfg.MaxFPS
+	if s := r.URL.Query().Get("fps"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v > 0 && v < fps {
+			fps = v
+		}
+	}
+	conn, err := p.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // the upgrader replied with an error
+	}
+	c := &client{
+		conn:   conn,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		period: time.Second / time.Duration(fps),
+	}
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout)) // nolint: errcheck
+	if err := conn.WriteJSON(p.hello); err != nil {
+		conn.Close()
+		return
+	}
+
+	p.mu.Lock()
+	p.clients[c] = struct{}{}
+	p.mu.Unlock()
+	c.notify <- struct{}{} // send the current frame
+	go p.writeLoop(c)
+	p.readLoop(c)
+
+	p.mu.Lock()
+	delete(p.clients, c)
+	p.mu.Unlock()
+	close(c.done)
+	conn.Close()
+}
+
+// writeLoop sends the frames to a client, at most one per period. The frames
+// rendered in between are dropped.
+func (p *Preview) writeLoop(c *client) {
+	var last time.Time
+	for {
+		select {
+		case <-c.notify:
+		case <-c.done:
+			return
+		}
+		if wait := c.period - time.Since(last); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-c.done:
+				return
+			}
+		}
+		last = time.Now()
+		if err := p.send(c); err != nil {
+			c.conn.Close() // stops readLoop
+			return
+		}
+	}
+}
+
+func (p *Preview) send(c *client) error {
+	p.mu.Lock()
+	msgs := make([][]byte, len(p.frame))
+	for i, leds := range p.frame {
+		msgs[i] = marshal(i, p.brightness[i], 0, leds)
+	}
+	p.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)) // nolint: errcheck
+	for _, m := range msgs {
+		if err := c.conn.WriteMessage(websocket.BinaryMessage, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLoop applies the messages of a client until the connection is closed.
+// The connection is not read faster than the frame rate of the client, which
+// throttles painting without dropping messages.
+func (p *Preview) readLoop(c *client) {
+	for {
+		begin := time.Now()
+		typ, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if typ != websocket.BinaryMessage || p.cfg.ReadOnly {
+			continue
+		}
+		channel, start, leds, err := unmarshal(msg)
+		if err == nil {
+			err = p.paint(channel, start, leds)
+		}
+		if err != nil {
+			c.conn.WriteControl(websocket.CloseMessage, // nolint: errcheck
+				websocket.FormatCloseMessage(websocket.CloseUnsupportedData, err.Error()),
+				time.Now().Add(writeTimeout))
+			return
+		}
+		if wait := c.period - time.Since(begin); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
+
+func (p *Preview) paint(channel, start int, leds []uint32) error {
+	if channel >= len(p.frame) || start+len(leds) > len(p.frame[channel]) {
+		return errors.New("invalid LED range")
+	}
+	if p.cfg.Paint != nil {
+		return p.cfg.Paint(channel, start, leds)
+	}
+	p.paintMu.Lock()
+	defer p.paintMu.Unlock()
+	if err := p.Device.Wait(); err != nil {
+		return err
+	}
+	copy(p.Device.Leds(channel)[start:], leds)
+	return p.Render()
+}
+
+func marshal(channel, brightness, start int, leds []uint32) []byte {
+	b := make([]byte, headerLen, headerLen+4*len(leds))
+	b[0], b[1] = byte(channel), byte(brightness)
+	binary.BigEndian.PutUint16(b[2:], uint16(start))
+	for _, c := range leds {
+		b = binary.BigEndian.AppendUint32(b, c)
+	}
+	return b
+}
+
+func unmarshal(b []byte) (channel, start int, leds []uint32, err error) {
+	if len(b) < headerLen || (len(b)-headerLen)%4 != 0 {
+		return 0, 0, nil, errors.New("invalid message")
+	}
+	channel, start = int(b[0]), int(binary.BigEndian.Uint16(b[2:]))
+	for i := headerLen; i < len(b); i += 4 {
+		leds = append(leds, binary.BigEndian.Uint32(b[i:]))
+	}
+	return channel, start, leds, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package preview
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/layout"
+	"github.com/stretchr/testify/assert"
+)
+
+func setup(t *testing.T, cfg Config) (*Preview, *httptest.Server) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{
+		{LedCount: 4, Brightness: 128},
+		{LedCount: 6, Brightness: 255, StripeType: ws2811.SK6812StripRGBW},
+	}}
+	dev, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, dev.Init())
+	p := MakePreview(dev, &opt, cfg)
+	server := httptest.NewServer(p)
+	t.Cleanup(func() {
+		server.Close()
+		dev.Fini()
+	})
+	return p, server
+}
+
+func dial(t *testing.T, server *httptest.Server, query string) (*websocket.Conn, Hello) {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/preview/ws" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	var hello Hello
+	assert.Nil(t, conn.ReadJSON(&hello))
+	return conn, hello
+}
+
+// readFrame reads the messages of all the channels of a frame.
+func readFrame(t *testing.T, conn *websocket.Conn) [][]uint32 {
+	frame := make([][]uint32, 2)
+	for i := range frame {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second)) // nolint: errcheck
+		typ, msg, err := conn.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, websocket.BinaryMessage, typ)
+		channel, start, leds, err := unmarshal(msg)
+		assert.Nil(t, err)
+		assert.Equal(t, i, channel)
+		assert.Equal(t, 0, start)
+		frame[channel] = leds
+	}
+	return frame
+}
+
+func TestPreview(t *testing.T) {
+	p, server := setup(t, Config{Layouts: map[int]layout.Layout{1: layout.Matrix(3, 2, true)}})
+
+	resp, err := server.Client().Get(server.URL + "/preview/")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	conn, hello := dial(t, server, "")
+	assert.Equal(t, DefaultMaxFPS, hello.MaxFPS)
+	assert.Equal(t, layout.Strip(4), hello.Channels[0].Layout)
+	assert.Equal(t, layout.Matrix(3, 2, true), hello.Channels[1].Layout)
+	assert.Equal(t, ws2811.SK6812StripRGBW, hello.Channels[1].StripeType)
+
+	// the current frame is sent on connection
+	assert.Equal(t, []uint32{0, 0, 0, 0}, readFrame(t, conn)[0])
+
+	p.Leds(0)[1] = 0x112233
+	p.Leds(1)[5] = 0xff000000
+	p.SetBrightness(0, 42)
+	assert.Nil(t, p.Render())
+	frame := readFrame(t, conn)
+	assert.Equal(t, []uint32{0, 0x112233, 0, 0}, frame[0])
+	assert.Equal(t, uint32(0xff000000), frame[1][5])
+
+	// painting
+	assert.Nil(t, conn.WriteMessage(websocket.BinaryMessage, marshal(0, 0, 2, []uint32{0xaa, 0xbb})))
+	frame = readFrame(t, conn)
+	assert.Equal(t, []uint32{0, 0x112233, 0xaa, 0xbb}, frame[0])
+
+	// an invalid range closes the connection
+	assert.Nil(t, conn.WriteMessage(websocket.BinaryMessage, marshal(0, 0, 3, []uint32{1, 2})))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			assert.True(t, websocket.IsCloseError(err, websocket.CloseUnsupportedData))
+			break
+		}
+	}
+	assert.Eventually(t, func() bool { return p.Clients() == 0 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestPreviewThrottling(t *testing.T) {
+	painted := make(chan []uint32, 4)
+	p, server := setup(t, Config{Paint: func(channel, start int, leds []uint32) error {
+		painted <- leds
+		return nil
+	}})
+	conn, _ := dial(t, server, "?fps=10")
+	readFrame(t, conn)
+
+	// frames rendered faster than the rate of the client are dropped
+	begin := time.Now()
+	for i := 0; i < 20; i++ {
+		p.Leds(0)[0] = uint32(i)
+		assert.Nil(t, p.Render())
+		time.Sleep(5 * time.Millisecond)
+	}
+	var last uint32
+	frames := 0
+	for last != 19 {
+		last = readFrame(t, conn)[0][0]
+		frames++
+	}
+	assert.Less(t, frames, 5)
+	assert.GreaterOrEqual(t, int64(time.Since(begin)), int64(100*time.Millisecond))
+
+	// paint messages are applied in order and all of them
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, conn.WriteMessage(websocket.BinaryMessage, marshal(0, 0, 0, []uint32{uint32(i)})))
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case leds := <-painted:
+			assert.Equal(t, []uint32{uint32(i)}, leds)
+		case <-time.After(2 * time.Second):
+			t.Fatal("no paint")
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	p, server := setup(t, Config{ReadOnly: true, MaxFPS: 100})
+	conn, hello := dial(t, server, "")
+	assert.True(t, hello.ReadOnly)
+	readFrame(t, conn)
+	assert.Nil(t, conn.WriteMessage(websocket.BinaryMessage, marshal(0, 0, 0, []uint32{1})))
+	assert.Nil(t, p.Render())
+	assert.Equal(t, uint32(0), readFrame(t, conn)[0][0])
+}
+
+func TestUnconfiguredChannel(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 4, Brightness: 128}}}
+	dev, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, dev.Init())
+	defer dev.Fini()
+	p := MakePreview(dev, &opt, Config{})
+
+	// the controller accepts any channel below ws2811.RpiPwmChannels
+	p.SetBrightness(1, 10)
+	p.SetBrightness(0, 20)
+	assert.Nil(t, p.Render())
+	assert.Equal(t, []int{20}, p.brightness)
+}
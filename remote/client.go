@@ -0,0 +1,355 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+)
+
+// DefaultTimeout is the default time to wait for a reply of the server.
+const DefaultTimeout = time.Second
+
+// Stats are the statistics of a client.
+type Stats struct {
+	// Sent is the number of frames sent
+	Sent uint32
+	// Acked is the number of frames acknowledged by the server
+	Acked uint32
+	// Errors is the number of frames the server failed to render
+	Errors uint32
+	// Latency is the time between sending the last acknowledged frame and
+	// receiving its acknowledgement
+	Latency time.Duration
+	// LastError is the last render error reported by the server
+	LastError string
+}
+
+// Client drives a device through a Server. It implements ws2811.Device.
+type Client struct {
+	network string
+	addr    string
+	// Timeout is the time to wait for a reply of the server (default DefaultTimeout)
+	Timeout time.Duration
+
+	conn     net.Conn
+	readDone chan struct{}
+	leds     [][]uint32
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	seq      uint32
+	config   []channelConfig
+	sent     map[uint32]sentFrame
+	base     uint32
+	baseData []byte
+	acked    uint32
+	readErr  error
+	stats    Stats
+}
+
+type sentFrame struct {
+	at   time.Time
+	data []byte
+}
+
+var _ ws2811.Device = (*Client)(nil)
+
+// MakeClient creates a client for the server at addr. network is "tcp" or
+// "udp".
+func MakeClient(network, addr string) (*Client, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+	default:
+		return nil, errors.New("unsupported network " + network)
+	}
+	c := &Client{
+		network: network,
+		addr:    addr,
+		Timeout: DefaultTimeout,
+		sent:    make(map[uint32]sentFrame),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c, nil
+}
+
+func (c *Client) isStream() bool {
+	return c.network[:3] == "tcp"
+}
+
+// Init connects to the server and gets the configuration of its channels.
+func (c *Client) Init() error {
+	if c.conn != nil {
+		return errors.New("device already initialized")
+	}
+	conn, err := net.DialTimeout(c.network, c.addr, c.Timeout)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.seq, c.acked, c.base, c.baseData = 0, 0, 0, nil
+	c.sent = make(map[uint32]sentFrame)
+	c.config, c.readErr = nil, nil
+	c.mu.Unlock()
+	c.conn = conn
+	c.readDone = make(chan struct{})
+	go c.read(conn)
+
+	if err := c.send(&message{typ: msgHello, payload: []byte{protocolVersion}}); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	if err := c.waitFor(ctx, "init", func() bool { return c.config != nil }); err != nil {
+		c.Fini()
+		return err
+	}
+	c.leds = make([][]uint32, ws2811.RpiPwmChannels)
+	for i := range c.leds {
+		if i < len(c.config) {
+			c.leds[i] = make([]uint32, c.config[i].ledCount)
+		} else {
+			c.leds[i] = make([]uint32, 0)
+		}
+	}
+	return nil
+}
+
+// Fini closes the connection. The client can be initialized again.
+func (c *Client) Fini() {
+	if c.conn != nil {
+		c.conn.Close()
+		<-c.readDone
+		c.conn = nil
+	}
+}
+
+// Leds returns the LEDs array of a given channel
+func (c *Client) Leds(channel int) []uint32 {
+	return c.leds[channel]
+}
+
+// StripeType returns the strip type of a channel of the server.
+func (c *Client) StripeType(channel int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if channel < len(c.config) {
+		return c.config[channel].stripeType
+	}
+	return 0
+}
+
+// Render sends the frame to the server. It does not wait for the frame to be
+// rendered: call Wait for that.
+func (c *Client) Render() error {
+	if c.conn == nil {
+		return errors.New("device not initialized")
+	}
+	frame := frameBytes(c.leds)
+
+	c.mu.Lock()
+	if c.readErr != nil {
+		c.mu.Unlock()
+		return c.readErr
+	}
+	c.seq++
+	seq, base, baseData := c.seq, c.base, c.baseData
+	c.sent[seq] = sentFrame{at: time.Now(), data: frame}
+	c.stats.Sent++
+	c.mu.Unlock()
+
+	payload, err := marshalFrame(base, baseData, frame)
+	if err != nil {
+		return err
+	}
+	return c.send(&message{typ: msgFrame, seq: seq, payload: payload})
+}
+
+// Wait waits until the server has acknowledged the last frame sent and
+// returns its render error, if any. It returns a *ws2811.TimeoutError if the
+// acknowledgement does not come within Timeout.
+func (c *Client) Wait() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	return c.WaitContext(ctx)
+}
+
+// WaitContext is like Wait but gives up when the context is done.
+func (c *Client) WaitContext(ctx context.Context) error {
+	c.mu.Lock()
+	seq := c.seq
+	c.mu.Unlock()
+	if err := c.waitFor(ctx, "wait", func() bool { return c.acked >= seq }); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stats.LastError != "" {
+		err := errors.New("remote: " + c.stats.LastError)
+		c.stats.LastError = ""
+		return err
+	}
+	return nil
+}
+
+// SetBrightness changes the brightness of a given channel on the server.
+func (c *Client) SetBrightness(channel int, brightness int) {
+	c.send(&message{typ: msgBrightness, payload: []byte{uint8(channel), uint8(brightness)}}) // nolint: errcheck
+}
+
+// Stats returns the statistics of the client.
+func (c *Client) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *Client) send(m *message) error {
+	if c.conn == nil {
+		return errors.New("device not initialized")
+	}
+	_, err := c.conn.Write(m.marshal())
+	return err
+}
+
+// waitFor waits until cond is true, the context is done or the connection
+// fails.
+func (c *Client) waitFor(ctx context.Context, op string, cond func() bool) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.mu.Lock()
+			c.cond.Broadcast()
+			c.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for !cond() {
+		if c.readErr != nil {
+			return c.readErr
+		}
+		if err := ws2811.ContextError(ctx, op); err != nil {
+			return err
+		}
+		c.cond.Wait()
+	}
+	return nil
+}
+
+// read processes the replies of the server until the connection is closed.
+func (c *Client) read(conn net.Conn) {
+	defer close(c.readDone)
+	buf := make([]byte, 65536)
+	for {
+		var m *message
+		var err error
+		if c.isStream() {
+			m, err = readMessage(conn)
+		} else {
+			var n int
+			n, err = conn.Read(buf)
+			if err == nil {
+				m, err = unmarshalMessage(buf[:n])
+				if err != nil {
+					continue
+				}
+			}
+		}
+		c.mu.Lock()
+		if err != nil {
+			c.readErr = err
+			c.cond.Broadcast()
+			c.mu.Unlock()
+			return
+		}
+		resend := c.handle(m)
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		if resend != nil {
+			if _, err := conn.Write(resend.marshal()); err != nil {
+				c.mu.Lock()
+				c.readErr = err
+				c.cond.Broadcast()
+				c.mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// handle processes a reply and returns the message to send back, if any.
+// c.mu must be held.
+func (c *Client) handle(m *message) *message {
+	switch m.typ {
+	case msgConfig:
+		if config, err := unmarshalConfig(m.payload); err == nil {
+			c.config = config
+		}
+	case msgAck:
+		if len(m.payload) < 1 {
+			return nil
+		}
+		sent, ok := c.sent[m.seq]
+		if !ok {
+			return nil
+		}
+		if m.payload[0] == ackKeyframe {
+			// send keyframes until one is acknowledged
+			c.base, c.baseData = 0, nil
+			if m.seq == c.seq {
+				// the last frame is sent again as a keyframe, frames in
+				// between were already superseded
+				c.sent[m.seq] = sentFrame{at: time.Now(), data: sent.data}
+				payload, err := marshalFrame(0, nil, sent.data)
+				if err == nil {
+					return &message{typ: msgFrame, seq: m.seq, payload: payload}
+				}
+			}
+		}
+		if m.seq > c.acked {
+			c.acked = m.seq
+		}
+		c.stats.Acked++
+		c.stats.Latency = time.Since(sent.at)
+		switch m.payload[0] {
+		case ackOK:
+			if m.seq > c.base {
+				c.base, c.baseData = m.seq, sent.data
+			}
+		case ackKeyframe:
+			// superseded by a later frame
+		default:
+			c.stats.Errors++
+			c.stats.LastError = string(m.payload[1:])
+		}
+		// frames older than the acknowledged one will not be acknowledged
+		for seq := range c.sent {
+			if seq <= m.seq {
+				delete(c.sent, seq)
+			}
+		}
+	}
+	return nil
+}
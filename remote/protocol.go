@@ -0,0 +1,176 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Message types.
+const (
+	msgHello      = 1
+	msgConfig     = 2
+	msgFrame      = 3
+	msgBrightness = 4
+	msgAck        = 5
+)
+
+// Status of an acknowledgement.
+const (
+	ackOK       = 0
+	ackError    = 1
+	ackKeyframe = 2
+)
+
+const (
+	protocolVersion = 1
+	headerLen       = 9
+	// maxPayload limits the memory allocated for a message
+	maxPayload = 1 << 24
+)
+
+var errInvalidMessage = errors.New("invalid message")
+
+// message is a message of the protocol. On a stream, each message is preceded
+// by a header with its type, its sequence number and the length of its
+// payload. On a datagram connection, each datagram holds one message.
+type message struct {
+	typ     uint8
+	seq     uint32
+	payload []byte
+}
+
+func (m *message) marshal() []byte {
+	b := make([]byte, headerLen+len(m.payload))
+	b[0] = m.typ
+	binary.BigEndian.PutUint32(b[1:], m.seq)
+	binary.BigEndian.PutUint32(b[5:], uint32(len(m.payload)))
+	copy(b[headerLen:], m.payload)
+	return b
+}
+
+func unmarshalMessage(b []byte) (*message, error) {
+	if len(b) < headerLen || int(binary.BigEndian.Uint32(b[5:])) != len(b)-headerLen {
+		return nil, errInvalidMessage
+	}
+	return &message{typ: b[0], seq: binary.BigEndian.Uint32(b[1:]), payload: b[headerLen:]}, nil
+}
+
+func readMessage(r io.Reader) (*message, error) {
+	var h [headerLen]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(h[5:])
+	if size > maxPayload {
+		return nil, errInvalidMessage
+	}
+	m := &message{typ: h[0], seq: binary.BigEndian.Uint32(h[1:]), payload: make([]byte, size)}
+	if _, err := io.ReadFull(r, m.payload); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// channelConfig is the configuration of a channel sent to the clients.
+type channelConfig struct {
+	ledCount   int
+	stripeType int
+}
+
+func marshalConfig(channels []channelConfig) []byte {
+	b := make([]byte, 1+8*len(channels))
+	b[0] = uint8(len(channels))
+	for i, c := range channels {
+		binary.BigEndian.PutUint32(b[1+8*i:], uint32(c.ledCount))
+		binary.BigEndian.PutUint32(b[5+8*i:], uint32(c.stripeType))
+	}
+	return b
+}
+
+func unmarshalConfig(b []byte) ([]channelConfig, error) {
+	if len(b) < 1 || len(b) != 1+8*int(b[0]) {
+		return nil, errInvalidMessage
+	}
+	channels := make([]channelConfig, b[0])
+	for i := range channels {
+		channels[i].ledCount = int(binary.BigEndian.Uint32(b[1+8*i:]))
+		channels[i].stripeType = int(binary.BigEndian.Uint32(b[5+8*i:]))
+	}
+	return channels, nil
+}
+
+// frameBytes serializes the LEDs of all channels.
+func frameBytes(leds [][]uint32) []byte {
+	size := 0
+	for _, l := range leds {
+		size += 4 * len(l)
+	}
+	b := make([]byte, 0, size)
+	for _, l := range leds {
+		for _, c := range l {
+			b = binary.BigEndian.AppendUint32(b, c)
+		}
+	}
+	return b
+}
+
+// marshalFrame compresses a frame. If base is not nil, the frame is encoded
+// as a delta (XOR) from base, which compresses much better when only a few
+// LEDs change.
+func marshalFrame(baseSeq uint32, base, frame []byte) ([]byte, error) {
+	data := frame
+	if base != nil {
+		data = xor(base, frame)
+	}
+	var buf bytes.Buffer
+	buf.Write(binary.BigEndian.AppendUint32(nil, baseSeq))
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalFrame returns the base sequence number and the (possibly delta
+// encoded) frame data.
+func unmarshalFrame(b []byte, size int) (uint32, []byte, error) {
+	if len(b) < 4 {
+		return 0, nil, errInvalidMessage
+	}
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(b[4:])), int64(size)+1))
+	if err != nil || len(data) != size {
+		return 0, nil, errInvalidMessage
+	}
+	return binary.BigEndian.Uint32(b), data, nil
+}
+
+func xor(a, b []byte) []byte {
+	c := make([]byte, len(b))
+	for i := range b {
+		c[i] = a[i] ^ b[i]
+	}
+	return c
+}
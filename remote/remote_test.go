@@ -0,0 +1,189 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// device is a simulated device that records the rendered frames.
+type device struct {
+	*ws2811.WS2811
+	mu         sync.Mutex
+	frames     [][]uint32
+	brightness int
+	fail       bool
+}
+
+func (d *device) Render() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fail {
+		return errors.New("render failed")
+	}
+	d.frames = append(d.frames, append(append([]uint32(nil), d.Leds(0)...), d.Leds(1)...))
+	return nil
+}
+
+func (d *device) SetBrightness(channel int, brightness int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.brightness = brightness
+}
+
+func (d *device) lastFrame() []uint32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.frames[len(d.frames)-1]
+}
+
+func newServer(t *testing.T) (*device, *Server) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{
+		{LedCount: 100, StripeType: ws2811.WS2812Strip},
+		{LedCount: 2, StripeType: ws2811.SK6812StripRGBW},
+	}}
+	ws, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	dev := &device{WS2811: ws}
+	return dev, MakeServer(dev, &opt)
+}
+
+func testClient(t *testing.T, dev *device, c *Client) {
+	assert.Nil(t, c.Init())
+	defer c.Fini()
+	assert.Equal(t, 100, len(c.Leds(0)))
+	assert.Equal(t, 2, len(c.Leds(1)))
+	assert.Equal(t, ws2811.SK6812StripRGBW, c.StripeType(1))
+
+	for i := 0; i < 10; i++ {
+		c.Leds(0)[i] = uint32(i + 1)
+		c.Leds(1)[1] = uint32(i) << 24
+		assert.Nil(t, c.Render())
+		assert.Nil(t, c.Wait())
+		frame := dev.lastFrame()
+		assert.Equal(t, uint32(i+1), frame[i])
+		assert.Equal(t, uint32(i)<<24, frame[101])
+	}
+	stats := c.Stats()
+	assert.Equal(t, uint32(10), stats.Sent)
+	assert.Equal(t, uint32(10), stats.Acked)
+	assert.True(t, stats.Latency > 0)
+
+	c.SetBrightness(0, 42)
+	dev.mu.Lock()
+	dev.fail = true
+	dev.mu.Unlock()
+	assert.Nil(t, c.Render())
+	assert.EqualError(t, c.Wait(), "remote: render failed")
+	dev.mu.Lock()
+	assert.Equal(t, 42, dev.brightness)
+	dev.mu.Unlock()
+}
+
+func TestTCP(t *testing.T) {
+	dev, s := newServer(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go s.Serve(l) // nolint: errcheck
+	defer s.Close()
+
+	c, err := MakeClient("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	testClient(t, dev, c)
+
+	// Fini closes the connection, which is removed from the server, and the
+	// client can be initialized again
+	assert.NotNil(t, c.Render())
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.closers) == 1 && len(s.sessions) == 0
+	}, time.Second, 10*time.Millisecond)
+	dev.mu.Lock()
+	dev.fail = false
+	dev.mu.Unlock()
+	assert.Nil(t, c.Init())
+	defer c.Fini()
+	assert.Nil(t, c.Render())
+	assert.Nil(t, c.Wait())
+}
+
+func TestUDP(t *testing.T) {
+	dev, s := newServer(t)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go s.ServePacket(conn) // nolint: errcheck
+	defer s.Close()
+
+	c, err := MakeClient("udp", conn.LocalAddr().String())
+	assert.Nil(t, err)
+	testClient(t, dev, c)
+}
+
+func TestLostSession(t *testing.T) {
+	dev, s := newServer(t)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go s.ServePacket(conn) // nolint: errcheck
+	defer s.Close()
+
+	c, err := MakeClient("udp", conn.LocalAddr().String())
+	assert.Nil(t, err)
+	assert.Nil(t, c.Init())
+	defer c.Fini()
+	assert.Nil(t, c.Render())
+	assert.Nil(t, c.Wait())
+
+	// the session expires: the next delta frame is sent again as a keyframe
+	seen := map[string]time.Time{c.conn.LocalAddr().String(): time.Now().Add(-2 * sessionTimeout)}
+	s.expireSessions(seen, time.Now().Add(-sessionTimeout))
+	assert.Empty(t, seen)
+	c.Leds(0)[0] = 0x123456
+	assert.Nil(t, c.Render())
+	assert.Nil(t, c.Wait())
+	assert.Equal(t, uint32(0x123456), dev.lastFrame()[0])
+	assert.Equal(t, uint32(0), c.Stats().Errors)
+}
+
+func TestDeltaFrame(t *testing.T) {
+	base := frameBytes([][]uint32{make([]uint32, 100), make([]uint32, 2)})
+	leds := make([]uint32, 100)
+	leds[50] = 0xffffff
+	frame := frameBytes([][]uint32{leds, make([]uint32, 2)})
+
+	key, err := marshalFrame(0, nil, frame)
+	assert.Nil(t, err)
+	delta, err := marshalFrame(7, base, frame)
+	assert.Nil(t, err)
+
+	seq, data, err := unmarshalFrame(delta, len(frame))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(7), seq)
+	assert.Equal(t, frame, xor(base, data))
+	assert.True(t, len(delta) <= len(key))
+
+	// the server asks for a keyframe if it does not know the base
+	_, s := newServer(t)
+	m := s.handle("client", &message{typ: msgFrame, seq: 8, payload: delta})
+	assert.Equal(t, uint8(ackKeyframe), m.payload[0])
+}
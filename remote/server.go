@@ -0,0 +1,263 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote drives a WS2811 device over the network. The Server runs on
+// the Raspberry Pi next to the LEDs and the Client, which implements
+// ws2811.Device, runs wherever the frames are computed.
+//
+// Frames are compressed and delta encoded against the last frame acknowledged
+// by the server. Each frame has a sequence number and the server acknowledges
+// it once rendered, which gives the client the render errors and the latency.
+// The protocol works over TCP and over UDP.
+package remote
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+)
+
+// DefaultPort is the default TCP and UDP port of the server.
+const DefaultPort = 7891
+
+// history is the number of rendered frames kept by a session to decode
+// delta frames.
+const history = 8
+
+// sessionTimeout is the time after which the session of a UDP client that
+// sends nothing is forgotten.
+const sessionTimeout = time.Minute
+
+// Server renders the frames sent by the clients on a device.
+type Server struct {
+	dev      ws2811.Device
+	channels []channelConfig
+
+	// mu serializes the access to the device and to the server state
+	mu       sync.Mutex
+	closers  map[io.Closer]bool
+	sessions map[string]*session
+	closed   bool
+}
+
+// session is the state of a client.
+type session struct {
+	// frames are the last rendered frames by sequence number
+	frames map[uint32][]byte
+	order  []uint32
+}
+
+// MakeServer creates a server for a device configured with opt. The device
+// must be initialized.
+func MakeServer(dev ws2811.Device, opt *ws2811.Option) *Server {
+	s := &Server{dev: dev, closers: make(map[io.Closer]bool), sessions: make(map[string]*session)}
+	for i := 0; i < ws2811.RpiPwmChannels; i++ {
+		var c channelConfig
+		if i < len(opt.Channels) {
+			c = channelConfig{ledCount: len(dev.Leds(i)), stripeType: opt.Channels[i].StripeType}
+		}
+		s.channels = append(s.channels, c)
+	}
+	return s
+}
+
+// Serve accepts TCP clients from l until Close is called.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.addCloser(l) {
+		return net.ErrClosed
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return err
+		}
+		if !s.addCloser(conn) {
+			return nil
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// ServePacket serves UDP clients on conn until Close is called. The sessions
+// of the clients that send nothing for sessionTimeout are forgotten.
+func (s *Server) ServePacket(conn net.PacketConn) error {
+	if !s.addCloser(conn) {
+		return net.ErrClosed
+	}
+	buf := make([]byte, 65536)
+	seen := make(map[string]time.Time)
+	expired := time.Now()
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return err
+		}
+		now := time.Now()
+		if now.Sub(expired) > sessionTimeout {
+			s.expireSessions(seen, now.Add(-sessionTimeout))
+			expired = now
+		}
+		m, err := unmarshalMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		seen[addr.String()] = now
+		if reply := s.handle(addr.String(), m); reply != nil {
+			conn.WriteTo(reply.marshal(), addr) // nolint: errcheck
+		}
+	}
+}
+
+// Close stops the server and disconnects the clients.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	for c := range s.closers {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (s *Server) addCloser(c io.Closer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.Close() // nolint: errcheck
+		return false
+	}
+	s.closers[c] = true
+	return true
+}
+
+// expireSessions forgets the sessions of the UDP clients last seen before a
+// given time.
+func (s *Server) expireSessions(seen map[string]time.Time, before time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, t := range seen {
+		if t.Before(before) {
+			delete(seen, key)
+			delete(s.sessions, key)
+		}
+	}
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	key := conn.RemoteAddr().String()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, key)
+		delete(s.closers, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		m, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+		if reply := s.handle(key, m); reply != nil {
+			if _, err := conn.Write(reply.marshal()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handle processes a message of the client identified by key and returns the
+// reply, if any.
+func (s *Server) handle(key string, m *message) *message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[key]
+	if !ok {
+		sess = &session{frames: make(map[uint32][]byte)}
+		s.sessions[key] = sess
+	}
+
+	switch m.typ {
+	case msgHello:
+		return &message{typ: msgConfig, seq: m.seq, payload: marshalConfig(s.channels)}
+	case msgBrightness:
+		if len(m.payload) == 2 && int(m.payload[0]) < ws2811.RpiPwmChannels {
+			s.dev.SetBrightness(int(m.payload[0]), int(m.payload[1]))
+		}
+	case msgFrame:
+		return s.handleFrame(sess, m)
+	}
+	return nil
+}
+
+func (s *Server) handleFrame(sess *session, m *message) *message {
+	size := 0
+	for _, c := range s.channels {
+		size += 4 * c.ledCount
+	}
+	baseSeq, data, err := unmarshalFrame(m.payload, size)
+	if err != nil {
+		return ack(m.seq, ackError, err.Error())
+	}
+	if baseSeq != 0 {
+		base, ok := sess.frames[baseSeq]
+		if !ok {
+			return ack(m.seq, ackKeyframe, "unknown base frame")
+		}
+		data = xor(base, data)
+	}
+
+	offset := 0
+	for i, c := range s.channels {
+		leds := s.dev.Leds(i)
+		for j := 0; j < c.ledCount; j++ {
+			leds[j] = binary.BigEndian.Uint32(data[offset:])
+			offset += 4
+		}
+	}
+	if err := s.dev.Render(); err != nil {
+		return ack(m.seq, ackError, err.Error())
+	}
+
+	sess.frames[m.seq] = data
+	sess.order = append(sess.order, m.seq)
+	if len(sess.order) > history {
+		delete(sess.frames, sess.order[0])
+		sess.order = sess.order[1:]
+	}
+	return ack(m.seq, ackOK, "")
+}
+
+func ack(seq uint32, status uint8, text string) *message {
+	return &message{typ: msgAck, seq: seq, payload: append([]byte{status}, text...)}
+}
@@ -0,0 +1,333 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sequence records the frames rendered on a device to a compact file
+// and plays them back with their original timing.
+//
+// A sequence file starts with a header:
+//
+//	magic      "WSSQ"
+//	version    1 byte (1)
+//	channels   1 byte
+//	per channel:
+//	  LED count    4 bytes
+//	  StripeType   4 bytes
+//	  brightness   1 byte
+//
+// followed by the frames:
+//
+//	time       uvarint, microseconds since the previous frame
+//	flags      1 byte, FlagKeyframe and FlagBrightness
+//	brightness 1 byte per channel, if FlagBrightness is set
+//	length     uvarint, length of the payload
+//	payload    deflated LEDs of all the channels, 4 bytes each (little
+//	           endian), XORed with the previous frame unless FlagKeyframe
+//	           is set
+//
+// All integers of the header are little endian.
+package sequence
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Magic is the magic number of sequence files.
+const Magic = "WSSQ"
+
+// Version is the version of the format.
+const Version = 1
+
+// Frame flags.
+const (
+	FlagKeyframe   = 0x01
+	FlagBrightness = 0x02
+)
+
+// DefaultKeyframeInterval is the number of frames between two keyframes when
+// Writer.KeyframeInterval is zero.
+const DefaultKeyframeInterval = 100
+
+// maxLeds limits the memory allocated for a frame.
+const maxLeds = 1 << 20
+
+// Header describes the channels of a sequence.
+type Header struct {
+	Channels []Channel
+}
+
+// Channel describes a channel.
+type Channel struct {
+	LedCount   int
+	StripeType int
+	Brightness int
+}
+
+// Frame is a frame of a sequence.
+type Frame struct {
+	// Time is the time of the frame since the start of the sequence
+	Time time.Duration
+	// Leds are the LEDs of each channel
+	Leds [][]uint32
+	// Brightness is the brightness of each channel
+	Brightness []int
+}
+
+func (h *Header) size() int {
+	n := 0
+	for _, ch := range h.Channels {
+		n += ch.LedCount
+	}
+	return n
+}
+
+// Writer writes a sequence.
+type Writer struct {
+	// KeyframeInterval is the number of frames between two keyframes
+	KeyframeInterval int
+
+	w          *bufio.Writer
+	hdr        Header
+	prev       []byte
+	brightness []int
+	last       time.Duration
+	n          int
+	buf        bytes.Buffer
+	fw         *flate.Writer
+}
+
+// NewWriter writes the header of a sequence and returns a Writer for its
+// frames.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	if len(h.Channels) > 255 {
+		return nil, errors.New("Error writing sequence: too many channels")
+	}
+	sw := &Writer{w: bufio.NewWriter(w), hdr: h, brightness: make([]int, len(h.Channels))}
+	b := append([]byte(Magic), Version, byte(len(h.Channels)))
+	for i, ch := range h.Channels {
+		b = binary.LittleEndian.AppendUint32(b, uint32(ch.LedCount))
+		b = binary.LittleEndian.AppendUint32(b, uint32(ch.StripeType))
+		b = append(b, byte(ch.Brightness))
+		sw.brightness[i] = ch.Brightness
+	}
+	if _, err := sw.w.Write(b); err != nil {
+		return nil, errors.WithMessage(err, "Error writing sequence")
+	}
+	sw.fw, _ = flate.NewWriter(&sw.buf, flate.BestSpeed)
+	return sw, nil
+}
+
+// WriteFrame writes a frame. The frames must be written in chronological
+// order. Missing LEDs are written as 0 and missing brightness values are
+// unchanged.
+func (w *Writer) WriteFrame(f *Frame) error {
+	if f.Time < w.last {
+		return errors.New("Error writing sequence: frame out of order")
+	}
+	interval := w.KeyframeInterval
+	if interval <= 0 {
+		interval = DefaultKeyframeInterval
+	}
+
+	data := make([]byte, 0, 4*w.hdr.size())
+	for i, ch := range w.hdr.Channels {
+		var leds []uint32
+		if i < len(f.Leds) {
+			leds = f.Leds[i]
+		}
+		for j := 0; j < ch.LedCount; j++ {
+			var c uint32
+			if j < len(leds) {
+				c = leds[j]
+			}
+			data = binary.LittleEndian.AppendUint32(data, c)
+		}
+	}
+
+	var flags byte
+	payload := data
+	if w.prev == nil || w.n%interval == 0 {
+		flags |= FlagKeyframe
+	} else {
+		payload = make([]byte, len(data))
+		for i := range data {
+			payload[i] = data[i] ^ w.prev[i]
+		}
+	}
+	w.prev = data
+	for i := range w.brightness {
+		if i < len(f.Brightness) && f.Brightness[i] != w.brightness[i] {
+			flags |= FlagBrightness
+			w.brightness[i] = f.Brightness[i]
+		}
+	}
+
+	w.buf.Reset()
+	w.fw.Reset(&w.buf)
+	w.fw.Write(payload) // nolint: errcheck
+	if err := w.fw.Close(); err != nil {
+		return errors.WithMessage(err, "Error writing sequence")
+	}
+
+	b := binary.AppendUvarint(nil, uint64((f.Time-w.last)/time.Microsecond))
+	b = append(b, flags)
+	if flags&FlagBrightness != 0 {
+		for _, v := range w.brightness {
+			b = append(b, byte(v))
+		}
+	}
+	b = binary.AppendUvarint(b, uint64(w.buf.Len()))
+	if _, err := w.w.Write(append(b, w.buf.Bytes()...)); err != nil {
+		return errors.WithMessage(err, "Error writing sequence")
+	}
+	// the time is rounded to the microsecond so that it does not drift
+	w.last += (f.Time - w.last) / time.Microsecond * time.Microsecond
+	w.n++
+	return nil
+}
+
+// Flush writes the buffered frames.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Reader reads a sequence.
+type Reader struct {
+	r          *bufio.Reader
+	hdr        Header
+	prev       []byte
+	brightness []int
+	t          time.Duration
+}
+
+// NewReader reads the header of a sequence and returns a Reader for its
+// frames.
+func NewReader(r io.Reader) (*Reader, error) {
+	sr := &Reader{r: bufio.NewReader(r)}
+	b := make([]byte, 6)
+	if _, err := io.ReadFull(sr.r, b); err != nil {
+		return nil, errors.WithMessage(err, "Error reading sequence")
+	}
+	if string(b[:4]) != Magic {
+		return nil, errors.New("Error reading sequence: not a sequence file")
+	}
+	if b[4] != Version {
+		return nil, errors.Errorf("Error reading sequence: unsupported version %d", b[4])
+	}
+	ch := make([]byte, 9)
+	for i := 0; i < int(b[5]); i++ {
+		if _, err := io.ReadFull(sr.r, ch); err != nil {
+			return nil, errors.WithMessage(err, "Error reading sequence")
+		}
+		// checked before the conversion, which can overflow on 32 bits
+		count := binary.LittleEndian.Uint32(ch)
+		if count > maxLeds {
+			return nil, errors.New("Error reading sequence: too many LEDs")
+		}
+		sr.hdr.Channels = append(sr.hdr.Channels, Channel{
+			LedCount:   int(count),
+			StripeType: int(int32(binary.LittleEndian.Uint32(ch[4:]))),
+			Brightness: int(ch[8]),
+		})
+		sr.brightness = append(sr.brightness, int(ch[8]))
+	}
+	if sr.hdr.size() > maxLeds {
+		return nil, errors.New("Error reading sequence: too many LEDs")
+	}
+	return sr, nil
+}
+
+// Header returns the header of the sequence.
+func (r *Reader) Header() Header {
+	return r.hdr
+}
+
+// ReadFrame reads the next frame. It returns io.EOF at the end of the
+// sequence.
+func (r *Reader) ReadFrame() (*Frame, error) {
+	dt, err := binary.ReadUvarint(r.r)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, r.error(err)
+	}
+	flags, err := r.r.ReadByte()
+	if err != nil {
+		return nil, r.error(err)
+	}
+	if flags&FlagBrightness != 0 {
+		for i := range r.brightness {
+			v, err := r.r.ReadByte()
+			if err != nil {
+				return nil, r.error(err)
+			}
+			r.brightness[i] = int(v)
+		}
+	}
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, r.error(err)
+	}
+	size := 4 * r.hdr.size()
+	if n > uint64(size+size/8+1024) { // deflate adds a few bytes to incompressible data
+		return nil, errors.New("Error reading sequence: invalid frame")
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return nil, r.error(err)
+	}
+	data := make([]byte, size)
+	fr := flate.NewReader(bytes.NewReader(payload))
+	_, err = io.ReadFull(fr, data)
+	fr.Close()
+	if err != nil {
+		return nil, r.error(err)
+	}
+
+	if flags&FlagKeyframe == 0 {
+		if r.prev == nil {
+			return nil, errors.New("Error reading sequence: missing keyframe")
+		}
+		for i := range data {
+			data[i] ^= r.prev[i]
+		}
+	}
+	r.prev = data
+	r.t += time.Duration(dt) * time.Microsecond
+
+	f := &Frame{Time: r.t, Brightness: append([]int(nil), r.brightness...)}
+	for _, ch := range r.hdr.Channels {
+		leds := make([]uint32, ch.LedCount)
+		for j := range leds {
+			leds[j] = binary.LittleEndian.Uint32(data)
+			data = data[4:]
+		}
+		f.Leds = append(f.Leds, leds)
+	}
+	return f, nil
+}
+
+func (r *Reader) error(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return errors.WithMessage(err, "Error reading sequence")
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+)
+
+// Recorder is a Device that records the frames rendered on the device it
+// wraps. The time of the first frame is 0.
+type Recorder struct {
+	ws2811.Device
+
+	mu         sync.Mutex
+	w          *Writer
+	channels   int
+	brightness []int
+	start      time.Time
+	err        error
+}
+
+// MakeRecorder creates a recorder for an initialized device created with opt,
+// and writes the header of the sequence.
+func MakeRecorder(dev ws2811.Device, opt *ws2811.Option, w io.Writer) (*Recorder, error) {
+	var h Header
+	for _, ch := range opt.Channels {
+		h.Channels = append(h.Channels, Channel{LedCount: ch.LedCount, StripeType: ch.StripeType, Brightness: ch.Brightness})
+	}
+	sw, err := NewWriter(w, h)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{Device: dev, w: sw, channels: len(h.Channels)}
+	for _, ch := range h.Channels {
+		r.brightness = append(r.brightness, ch.Brightness)
+	}
+	return r, nil
+}
+
+// Render records the frame and renders it on the wrapped device.
+func (r *Recorder) Render() error {
+	r.mu.Lock()
+	now := time.Now()
+	if r.start.IsZero() {
+		r.start = now
+	}
+	f := &Frame{Time: now.Sub(r.start), Brightness: r.brightness}
+	for i := 0; i < r.channels; i++ {
+		f.Leds = append(f.Leds, r.Leds(i))
+	}
+	if err := r.w.WriteFrame(f); err != nil && r.err == nil {
+		r.err = err
+	}
+	err := r.err
+	r.mu.Unlock()
+
+	if rerr := r.Device.Render(); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// SetBrightness changes the brightness of a given channel. Value between 0 and 255
+func (r *Recorder) SetBrightness(channel int, brightness int) {
+	r.Device.SetBrightness(channel, brightness)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if channel < len(r.brightness) {
+		r.brightness[channel] = brightness
+	}
+}
+
+// Close writes the buffered frames. It does not close the wrapped device.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// Player plays a sequence on a device.
+type Player struct {
+	dev ws2811.Device
+	r   *Reader
+	// white tells, for each channel of the sequence, whether its white
+	// component is added to the red, green and blue components, because the
+	// strip of the device has no white LED
+	white []bool
+}
+
+// MakePlayer reads the header of a sequence and creates a player for an
+// initialized device created with opt. The channels of the sequence are mapped
+// to the channels of the device with the same number; LEDs that do not exist
+// on the device are ignored. When a channel is recorded with a white component
+// (see Channel.StripeType) and the strip of the device has none, the white is
+// mixed into the other components instead of being lost.
+func MakePlayer(dev ws2811.Device, opt *ws2811.Option, r io.Reader) (*Player, error) {
+	sr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &Player{dev: dev, r: sr}
+	for i, ch := range sr.Header().Channels {
+		p.white = append(p.white, i < len(opt.Channels) &&
+			ws2811.StripeComponents(ch.StripeType) == 4 &&
+			ws2811.StripeComponents(opt.Channels[i].StripeType) == 3)
+	}
+	return p, nil
+}
+
+// Header returns the header of the sequence.
+func (p *Player) Header() Header {
+	return p.r.Header()
+}
+
+// Play renders the frames at their time since the call, until the end of the
+// sequence or until the context is done. The times are relative to the start
+// of the playback, so that slow renders do not accumulate delays.
+func (p *Player) Play(ctx context.Context) error {
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	var brightness []int
+	for {
+		f, err := p.r.ReadFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if wait := time.Until(start.Add(f.Time)); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := p.dev.Wait(); err != nil {
+			return err
+		}
+		for i, leds := range f.Leds {
+			if i >= ws2811.RpiPwmChannels {
+				break
+			}
+			if p.white[i] {
+				dst := p.dev.Leds(i)
+				for j := 0; j < len(dst) && j < len(leds); j++ {
+					dst[j] = mixWhite(leds[j])
+				}
+			} else {
+				copy(p.dev.Leds(i), leds)
+			}
+			if brightness == nil || brightness[i] != f.Brightness[i] {
+				p.dev.SetBrightness(i, f.Brightness[i])
+			}
+		}
+		brightness = f.Brightness
+		if err := p.dev.Render(); err != nil {
+			return err
+		}
+	}
+}
+
+// mixWhite adds the white component of a color to its red, green and blue
+// components.
+func mixWhite(c uint32) uint32 {
+	w := c >> 24
+	var mixed uint32
+	for shift := 0; shift < 24; shift += 8 {
+		v := (c>>shift)&0xff + w
+		if v > 0xff {
+			v = 0xff
+		}
+		mixed |= v << shift
+	}
+	return mixed
+}
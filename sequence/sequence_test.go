@@ -0,0 +1,206 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	h := Header{Channels: []Channel{
+		{LedCount: 3, StripeType: ws2811.WS2812Strip, Brightness: 128},
+		{LedCount: 2, StripeType: ws2811.SK6812StripRGBW, Brightness: 255},
+	}}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, h)
+	assert.Nil(t, err)
+	w.KeyframeInterval = 3
+
+	var frames []*Frame
+	for i := 0; i < 7; i++ {
+		f := &Frame{
+			Time:       time.Duration(i) * 40 * time.Millisecond,
+			Leds:       [][]uint32{{uint32(i), 0xff0000, 0}, {0x11223344, uint32(i) << 24}},
+			Brightness: []int{128, 255},
+		}
+		if i >= 4 {
+			f.Brightness[0] = 10
+		}
+		frames = append(frames, f)
+		assert.Nil(t, w.WriteFrame(f))
+	}
+	assert.NotNil(t, w.WriteFrame(&Frame{}))
+	assert.Nil(t, w.Flush())
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, h, r.Header())
+	for _, want := range frames {
+		f, err := r.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, want, f)
+	}
+	_, err = r.ReadFrame()
+	assert.Equal(t, io.EOF, err)
+
+	// truncated sequences
+	r, err = NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-2]))
+	assert.Nil(t, err)
+	for err == nil {
+		_, err = r.ReadFrame()
+	}
+	assert.NotEqual(t, io.EOF, err)
+
+	_, err = NewReader(bytes.NewReader([]byte("WSSQ\x02\x00")))
+	assert.NotNil(t, err)
+	_, err = NewReader(bytes.NewReader([]byte("GIF89a")))
+	assert.NotNil(t, err)
+}
+
+func TestDeltaCompression(t *testing.T) {
+	h := Header{Channels: []Channel{{LedCount: 1000}}}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, h)
+	assert.Nil(t, err)
+	leds := make([]uint32, 1000)
+	for i := range leds {
+		leds[i] = uint32(i * 2654435761)
+	}
+	assert.Nil(t, w.WriteFrame(&Frame{Leds: [][]uint32{leds}}))
+	assert.Nil(t, w.Flush())
+	keyframe := buf.Len()
+	leds[10] = 0
+	assert.Nil(t, w.WriteFrame(&Frame{Leds: [][]uint32{leds}}))
+	assert.Nil(t, w.Flush())
+	assert.Less(t, buf.Len()-keyframe, 50)
+}
+
+// device is a simulated device that reports renders.
+type device struct {
+	*ws2811.WS2811
+	brightness []int
+	rendered   chan []uint32
+	times      []time.Time
+}
+
+func (d *device) Render() error {
+	d.times = append(d.times, time.Now())
+	d.rendered <- append([]uint32(nil), d.Leds(0)...)
+	return nil
+}
+
+func (d *device) SetBrightness(channel int, brightness int) {
+	d.brightness[channel] = brightness
+}
+
+func newDevice(t *testing.T, opt *ws2811.Option) *device {
+	ws, err := ws2811.MakeWS2811(opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	return &device{WS2811: ws, brightness: make([]int, 2), rendered: make(chan []uint32, 16)}
+}
+
+func TestRecordAndPlay(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 4, Brightness: 64}}}
+	var buf bytes.Buffer
+	dev := newDevice(t, &opt)
+	rec, err := MakeRecorder(dev, &opt, &buf)
+	assert.Nil(t, err)
+	for i := 0; i < 4; i++ {
+		rec.Leds(0)[i] = uint32(i + 1)
+		if i == 2 {
+			rec.SetBrightness(0, 200)
+		}
+		assert.Nil(t, rec.Render())
+		<-dev.rendered
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Nil(t, rec.Close())
+
+	dev = newDevice(t, &opt)
+	p, err := MakePlayer(dev, &opt, &buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, p.Header().Channels[0].LedCount)
+	start := time.Now()
+	assert.Nil(t, p.Play(context.Background()))
+	assert.Equal(t, []uint32{1, 0, 0, 0}, <-dev.rendered)
+	assert.Equal(t, []uint32{1, 2, 0, 0}, <-dev.rendered)
+	assert.Equal(t, []uint32{1, 2, 3, 0}, <-dev.rendered)
+	assert.Equal(t, []uint32{1, 2, 3, 4}, <-dev.rendered)
+	assert.Equal(t, 200, dev.brightness[0])
+	// the frames are played with their recorded timing
+	assert.GreaterOrEqual(t, int64(dev.times[3].Sub(start)), int64(60*time.Millisecond))
+	assert.Less(t, int64(dev.times[3].Sub(start)), int64(200*time.Millisecond))
+}
+
+func TestPlayCanceled(t *testing.T) {
+	h := Header{Channels: []Channel{{LedCount: 1}}}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, h)
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteFrame(&Frame{Time: time.Hour}))
+	assert.Nil(t, w.Flush())
+
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 1}}}
+	p, err := MakePlayer(newDevice(t, &opt), &opt, &buf)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, p.Play(ctx))
+}
+
+func TestPlayWhite(t *testing.T) {
+	h := Header{Channels: []Channel{{LedCount: 2, StripeType: ws2811.SK6812StripGRBW}}}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, h)
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteFrame(&Frame{Leds: [][]uint32{{0x40102030, 0xff000000}}}))
+	assert.Nil(t, w.Flush())
+	data := buf.Bytes()
+
+	// the white is mixed into the other components on a strip without white
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 2, StripeType: ws2811.WS2812Strip}}}
+	dev := newDevice(t, &opt)
+	p, err := MakePlayer(dev, &opt, bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Nil(t, p.Play(context.Background()))
+	assert.Equal(t, []uint32{0x506070, 0xffffff}, <-dev.rendered)
+
+	// and kept on a strip with white
+	opt.Channels[0].StripeType = ws2811.SK6812StripRGBW
+	dev = newDevice(t, &opt)
+	p, err = MakePlayer(dev, &opt, bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Nil(t, p.Play(context.Background()))
+	assert.Equal(t, []uint32{0x40102030, 0xff000000}, <-dev.rendered)
+}
+
+func TestInvalidLedCount(t *testing.T) {
+	for _, count := range []uint32{0xffffffff, 0x80000000, maxLeds + 1} {
+		b := append([]byte(Magic), Version, 1)
+		b = binary.LittleEndian.AppendUint32(b, count)
+		b = append(b, 0, 0, 0, 0, 0)
+		_, err := NewReader(bytes.NewReader(b))
+		assert.EqualError(t, err, "Error reading sequence: too many LEDs", "%#x", count)
+	}
+}
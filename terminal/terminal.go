@@ -0,0 +1,228 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package terminal is a Device that renders the LEDs as 24-bit ANSI colored
+// blocks in a terminal, to preview animations over SSH.
+//
+// Like the hardware, it scales the colors by the brightness of the channel and
+// applies the gamma table of the channel. The PWM value of each LED is then
+// converted to sRGB, so that the terminal approximates what the physical
+// strip shows.
+package terminal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/layout"
+)
+
+// DisplayGamma is the gamma of the terminal, used to convert the light
+// emitted by the LEDs to sRGB.
+const DisplayGamma = 2.2
+
+// Config is the configuration of a Terminal.
+type Config struct {
+	// Writer is the terminal, os.Stdout if nil
+	Writer io.Writer
+	// Layouts are the layouts of the channels, strips if missing
+	Layouts map[int]layout.Layout
+	// HalfBlocks draws two rows of LEDs per line of text, which makes the
+	// cells of matrices roughly square
+	HalfBlocks bool
+}
+
+// Terminal is a Device that renders to a terminal.
+type Terminal struct {
+	opt *ws2811.Option
+	cfg Config
+
+	mu          sync.Mutex
+	initialized bool
+	leds        [][]uint32
+	brightness  []int
+	layouts     []layout.Layout
+	srgb        [256]byte
+	lines       int // number of lines of the last frame
+}
+
+var _ ws2811.Device = (*Terminal)(nil)
+
+// MakeTerminal creates a terminal device for the channels of opt.
+func MakeTerminal(opt *ws2811.Option, cfg Config) *Terminal {
+	if cfg.Writer == nil {
+		cfg.Writer = os.Stdout
+	}
+	t := &Terminal{opt: opt, cfg: cfg}
+	for i := range t.srgb {
+		t.srgb[i] = byte(math.Round(255 * math.Pow(float64(i)/255, 1/DisplayGamma)))
+	}
+	return t
+}
+
+// Init initialize the device. It should be called only once before any other method.
+func (t *Terminal) Init() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.initialized {
+		return errors.New("device already initialized")
+	}
+	t.initialized = true
+	t.leds = make([][]uint32, ws2811.RpiPwmChannels)
+	t.brightness = make([]int, ws2811.RpiPwmChannels)
+	t.layouts = make([]layout.Layout, ws2811.RpiPwmChannels)
+	for i := 0; i < ws2811.RpiPwmChannels; i++ {
+		ledCount := 0
+		if i < len(t.opt.Channels) {
+			ledCount = t.opt.Channels[i].LedCount
+			t.brightness[i] = t.opt.Channels[i].Brightness
+		}
+		t.leds[i] = make([]uint32, ledCount)
+		t.layouts[i] = t.cfg.Layouts[i].For(ledCount)
+	}
+	_, err := io.WriteString(t.cfg.Writer, "\x1b[?25l") // hide the cursor
+	return err
+}
+
+// Fini shows the cursor again.
+func (t *Terminal) Fini() {
+	io.WriteString(t.cfg.Writer, "\x1b[0m\x1b[?25h") // nolint: errcheck
+}
+
+// Leds returns the LEDs array of a given channel
+func (t *Terminal) Leds(channel int) []uint32 {
+	return t.leds[channel]
+}
+
+// SetBrightness changes the brightness of a given channel. Value between 0 and 255
+func (t *Terminal) SetBrightness(channel int, brightness int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.brightness[channel] = brightness
+}
+
+// Wait waits for render to finish. Rendering is synchronous, so it returns
+// immediately.
+func (t *Terminal) Wait() error {
+	return nil
+}
+
+// WaitContext is like Wait but gives up when the context is done.
+func (t *Terminal) WaitContext(ctx context.Context) error {
+	return ws2811.ContextError(ctx, "wait")
+}
+
+// Render draws the frame over the previous one.
+func (t *Terminal) Render() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w := bufio.NewWriter(t.cfg.Writer)
+	if t.lines > 0 {
+		fmt.Fprintf(w, "\x1b[%dF", t.lines) // back to the first line of the last frame
+	}
+	t.lines = 0
+	for i, leds := range t.leds {
+		if len(leds) == 0 {
+			continue
+		}
+		t.lines += t.draw(w, i)
+	}
+	if err := w.Flush(); err != nil {
+		return errors.WithMessage(err, "Error rendering to terminal")
+	}
+	return nil
+}
+
+// RenderContext is like Render but gives up when the context is done.
+func (t *Terminal) RenderContext(ctx context.Context) error {
+	if err := ws2811.ContextError(ctx, "render"); err != nil {
+		return err
+	}
+	return t.Render()
+}
+
+// draw draws a channel and returns the number of lines written.
+func (t *Terminal) draw(w *bufio.Writer, channel int) int {
+	l := t.layouts[channel]
+	leds := t.leds[channel]
+	// color returns the color of a cell, or false if there is no LED.
+	color := func(x, y int) ([3]byte, bool) {
+		i := l.Index(x, y)
+		if i < 0 || i >= len(leds) {
+			return [3]byte{}, false
+		}
+		return t.rgb(channel, leds[i]), true
+	}
+
+	lines := 0
+	step := 1
+	if t.cfg.HalfBlocks {
+		step = 2
+	}
+	for y := 0; y < l.Height; y += step {
+		for x := 0; x < l.Width; x++ {
+			top, ok := color(x, y)
+			if !t.cfg.HalfBlocks {
+				if ok {
+					fmt.Fprintf(w, "\x1b[48;2;%d;%d;%dm  ", top[0], top[1], top[2])
+				} else {
+					w.WriteString("\x1b[0m  ") // nolint: errcheck
+				}
+				continue
+			}
+			bottom, _ := color(x, y+1)
+			fmt.Fprintf(w, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀",
+				top[0], top[1], top[2], bottom[0], bottom[1], bottom[2])
+		}
+		w.WriteString("\x1b[0m\x1b[K\n") // nolint: errcheck
+		lines++
+	}
+	return lines
+}
+
+// rgb returns the sRGB color shown for an LED of a channel. The white
+// component is added to the other ones.
+func (t *Terminal) rgb(channel int, led uint32) [3]byte {
+	var gamma []byte
+	if channel < len(t.opt.Channels) {
+		gamma = t.opt.Channels[channel].Gamma
+	}
+	scale := uint32(t.brightness[channel]&0xff) + 1
+	var c [3]byte
+	white := t.pwm(gamma, (led>>24)&0xff, scale)
+	for i, shift := range []uint{16, 8, 0} {
+		v := t.pwm(gamma, (led>>shift)&0xff, scale) + white
+		if v > 255 {
+			v = 255
+		}
+		c[i] = t.srgb[v]
+	}
+	return c
+}
+
+// pwm returns the PWM value of a component, as computed by the C library.
+func (t *Terminal) pwm(gamma []byte, v, scale uint32) int {
+	v = (v * scale) >> 8
+	if len(gamma) == 256 {
+		return int(gamma[v])
+	}
+	return int(v)
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terminal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/layout"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerminal(t *testing.T) {
+	var out bytes.Buffer
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 3, Brightness: 255}}}
+	term := MakeTerminal(&opt, Config{Writer: &out})
+	assert.Nil(t, term.Init())
+	assert.NotNil(t, term.Init())
+	assert.Equal(t, "\x1b[?25l", out.String())
+	out.Reset()
+
+	copy(term.Leds(0), []uint32{0xff0000, 0x000000, 0xff000000})
+	assert.Nil(t, term.Render())
+	assert.Equal(t, "\x1b[48;2;255;0;0m  \x1b[48;2;0;0;0m  \x1b[48;2;255;255;255m  \x1b[0m\x1b[K\n", out.String())
+
+	// the next frame is drawn over the previous one
+	out.Reset()
+	assert.Nil(t, term.Render())
+	assert.True(t, strings.HasPrefix(out.String(), "\x1b[1F"))
+
+	term.Fini()
+	assert.True(t, strings.HasSuffix(out.String(), "\x1b[?25h"))
+}
+
+func TestColor(t *testing.T) {
+	gamma := make([]byte, 256)
+	for i := range gamma {
+		gamma[i] = byte(i / 2)
+	}
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{
+		{LedCount: 1, Brightness: 255},
+		{LedCount: 1, Brightness: 127, Gamma: gamma},
+	}}
+	term := MakeTerminal(&opt, Config{Writer: &bytes.Buffer{}})
+	assert.Nil(t, term.Init())
+
+	assert.Equal(t, [3]byte{255, 0, 0}, term.rgb(0, 0xff0000))
+	// 0x80 is half of the light, which is brighter than 0x80 in sRGB
+	assert.Equal(t, [3]byte{0, 0, 186}, term.rgb(0, 0x80))
+	// brightness 127 halves the value, then the gamma table halves it again
+	assert.Equal(t, term.rgb(0, 0x3f), term.rgb(1, 0xff))
+	term.SetBrightness(0, 0)
+	assert.Equal(t, [3]byte{0, 0, 0}, term.rgb(0, 0xffffff))
+}
+
+func TestMatrix(t *testing.T) {
+	var out bytes.Buffer
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{{LedCount: 4, Brightness: 255}}}
+	term := MakeTerminal(&opt, Config{
+		Writer:     &out,
+		Layouts:    map[int]layout.Layout{0: layout.Matrix(2, 2, true)},
+		HalfBlocks: true,
+	})
+	assert.Nil(t, term.Init())
+	out.Reset()
+	// serpentine: LED 2 is at (1, 1) and LED 3 at (0, 1)
+	copy(term.Leds(0), []uint32{0xff0000, 0x00ff00, 0x0000ff, 0xffffff})
+	assert.Nil(t, term.Render())
+	assert.Equal(t, "\x1b[38;2;255;0;0m\x1b[48;2;255;255;255m▀"+
+		"\x1b[38;2;0;255;0m\x1b[48;2;0;0;255m▀\x1b[0m\x1b[K\n", out.String())
+}
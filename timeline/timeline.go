@@ -0,0 +1,316 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package timeline animates the color and the brightness of LED segments with
+// keyframes. A Timeline can be sampled at any time to produce a frame and is
+// stored as JSON, so that shows can be edited without recompiling.
+//
+// A timeline looks like this:
+//
+//	{
+//	  "duration": "4s",
+//	  "repeat": "ping-pong",
+//	  "tracks": [
+//	    {
+//	      "channel": 0, "start": 0, "length": 30, "param": "color",
+//	      "keyframes": [
+//	        {"time": "0s", "color": "#ff0000"},
+//	        {"time": "4s", "color": "#0000ff", "easing": "in-out-sine"}
+//	      ]
+//	    },
+//	    {
+//	      "channel": 0, "start": 0, "length": 30, "param": "brightness",
+//	      "keyframes": [{"time": "0s", "value": 1}, {"time": "2s", "value": 0.2}]
+//	    }
+//	  ]
+//	}
+package timeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/easing"
+	"github.com/rpi-ws281x/rpi-ws281x-go/effects"
+)
+
+// Repeat defines what happens when the end of a timeline is reached.
+type Repeat string
+
+const (
+	// Once holds the last frame
+	Once Repeat = "once"
+	// Loop restarts from the beginning
+	Loop Repeat = "loop"
+	// PingPong plays the timeline backwards, then forwards again, and so on
+	PingPong Repeat = "ping-pong"
+)
+
+// Param is the parameter animated by a track.
+type Param string
+
+const (
+	// ParamColor animates the color of the LEDs of the track
+	ParamColor Param = "color"
+	// ParamBrightness animates the brightness of the LEDs of the track, from 0
+	// to 1. It scales the colors of the color tracks of the frame, the LEDs
+	// that no color track covers are not changed. The brightness of LEDs
+	// covered by several brightness tracks is the product of their values.
+	ParamBrightness Param = "brightness"
+)
+
+// Timeline is a set of tracks animated over a common duration.
+type Timeline struct {
+	// Duration is the length of the timeline
+	Duration Duration `json:"duration"`
+	// Repeat defines what happens after Duration (default Once)
+	Repeat Repeat `json:"repeat,omitempty"`
+	// Tracks are the animated parameters
+	Tracks []Track `json:"tracks"`
+}
+
+// Track animates a parameter of a segment of a channel.
+type Track struct {
+	// Channel is the channel of the segment
+	Channel int `json:"channel"`
+	// Start is the index of the first LED of the segment
+	Start int `json:"start,omitempty"`
+	// Length is the number of LEDs of the segment, 0 for all LEDs up to the
+	// end of the channel
+	Length int `json:"length,omitempty"`
+	// Param is the animated parameter
+	Param Param `json:"param"`
+	// Keyframes are the values of the parameter, sorted by time
+	Keyframes []Keyframe `json:"keyframes"`
+}
+
+// Keyframe is the value of a parameter at a given time.
+type Keyframe struct {
+	// Time is the time of the keyframe from the start of the timeline
+	Time Duration `json:"time"`
+	// Color is the value of a color track
+	Color Color `json:"color,omitempty"`
+	// Value is the value of a brightness track
+	Value float64 `json:"value,omitempty"`
+	// Easing is the name of the easing function used to reach this keyframe
+	// from the previous one (default "linear"). See easing.ByName.
+	Easing string `json:"easing,omitempty"`
+}
+
+// Load reads and validates a timeline in JSON.
+func Load(r io.Reader) (*Timeline, error) {
+	tl := &Timeline{}
+	if err := json.NewDecoder(r).Decode(tl); err != nil {
+		return nil, fmt.Errorf("error decoding timeline: %v", err)
+	}
+	if err := tl.Validate(); err != nil {
+		return nil, err
+	}
+	return tl, nil
+}
+
+// Save writes the timeline in JSON.
+func (tl *Timeline) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tl)
+}
+
+// Validate checks the timeline and returns an error describing the first
+// problem found.
+func (tl *Timeline) Validate() error {
+	if tl.Duration <= 0 {
+		return fmt.Errorf("invalid timeline duration: %v", tl.Duration)
+	}
+	switch tl.Repeat {
+	case "", Once, Loop, PingPong:
+	default:
+		return fmt.Errorf("invalid repeat mode %q", tl.Repeat)
+	}
+	for i, track := range tl.Tracks {
+		if err := track.validate(); err != nil {
+			return fmt.Errorf("track %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (track *Track) validate() error {
+	if track.Channel < 0 || track.Channel >= ws2811.RpiPwmChannels {
+		return fmt.Errorf("invalid channel %d", track.Channel)
+	}
+	if track.Start < 0 || track.Length < 0 {
+		return fmt.Errorf("invalid segment %d+%d", track.Start, track.Length)
+	}
+	if track.Param != ParamColor && track.Param != ParamBrightness {
+		return fmt.Errorf("invalid param %q", track.Param)
+	}
+	if len(track.Keyframes) == 0 {
+		return fmt.Errorf("no keyframes")
+	}
+	if !sort.SliceIsSorted(track.Keyframes, func(i, j int) bool {
+		return track.Keyframes[i].Time < track.Keyframes[j].Time
+	}) {
+		return fmt.Errorf("keyframes are not sorted by time")
+	}
+	for _, kf := range track.Keyframes {
+		if _, err := easing.ByName(kf.Easing); err != nil {
+			return err
+		}
+		if kf.Value < 0 || kf.Value > 1 {
+			return fmt.Errorf("invalid brightness %v", kf.Value)
+		}
+	}
+	return nil
+}
+
+// LocalTime maps the time t since the start of the show to a time within
+// the timeline, according to the repeat mode.
+func (tl *Timeline) LocalTime(t time.Duration) time.Duration {
+	d := time.Duration(tl.Duration)
+	if t < 0 || d <= 0 {
+		return 0
+	}
+	switch tl.Repeat {
+	case Loop:
+		return t % d
+	case PingPong:
+		t %= 2 * d
+		if t > d {
+			return 2*d - t
+		}
+		return t
+	default:
+		if t > d {
+			return d
+		}
+		return t
+	}
+}
+
+// Render draws the frame at time t into the LEDs arrays of the channels,
+// indexed by channel number. The LEDs not covered by a color track are left
+// untouched, as well as the tracks of missing channels and the tracks without
+// keyframes.
+func (tl *Timeline) Render(channels [][]uint32, t time.Duration) {
+	t = tl.LocalTime(t)
+	// the brightness of the LEDs, nil for the channels at full brightness
+	levels := make([][]float64, len(channels))
+	for i := range tl.Tracks {
+		track := &tl.Tracks[i]
+		if track.Param != ParamBrightness || !track.renders(len(channels)) {
+			continue
+		}
+		leds := channels[track.Channel]
+		if levels[track.Channel] == nil {
+			levels[track.Channel] = make([]float64, len(leds))
+			for j := range levels[track.Channel] {
+				levels[track.Channel][j] = 1
+			}
+		}
+		v := track.value(t)
+		start, end := track.bounds(len(leds))
+		for j := start; j < end; j++ {
+			levels[track.Channel][j] *= v
+		}
+	}
+	for i := range tl.Tracks {
+		track := &tl.Tracks[i]
+		if track.Param != ParamColor || !track.renders(len(channels)) {
+			continue
+		}
+		leds, level := channels[track.Channel], levels[track.Channel]
+		c := track.color(t)
+		start, end := track.bounds(len(leds))
+		for j := start; j < end; j++ {
+			leds[j] = c
+			if level != nil {
+				leds[j] = effects.Scale(c, uint8(math.Round(level[j]*255)))
+			}
+		}
+	}
+}
+
+// RenderDevice draws the frame at time t into the LEDs arrays of a device.
+// It does not render the frame.
+func (tl *Timeline) RenderDevice(dev ws2811.Device, t time.Duration) {
+	channels := make([][]uint32, ws2811.RpiPwmChannels)
+	for i := range channels {
+		channels[i] = dev.Leds(i)
+	}
+	tl.Render(channels, t)
+}
+
+// renders reports whether the track can be drawn on the given number of
+// channels.
+func (track *Track) renders(channels int) bool {
+	return track.Channel >= 0 && track.Channel < channels && len(track.Keyframes) > 0
+}
+
+// bounds returns the range of the LEDs of the segment in a channel of n LEDs.
+func (track *Track) bounds(n int) (start, end int) {
+	start = track.Start
+	if start < 0 {
+		start = 0
+	}
+	if start > n {
+		start = n
+	}
+	end = n
+	if track.Length > 0 && start+track.Length < end {
+		end = start + track.Length
+	}
+	return start, end
+}
+
+// interval returns the keyframes around time t and the eased progress
+// between them.
+func (track *Track) interval(t time.Duration) (a, b *Keyframe, p float64) {
+	kfs := track.Keyframes
+	i := sort.Search(len(kfs), func(i int) bool { return time.Duration(kfs[i].Time) > t })
+	switch {
+	case i == 0:
+		return &kfs[0], &kfs[0], 0
+	case i == len(kfs):
+		return &kfs[i-1], &kfs[i-1], 0
+	}
+	a, b = &kfs[i-1], &kfs[i]
+	f, err := easing.ByName(b.Easing)
+	if err != nil {
+		f = easing.Linear
+	}
+	p = float64(t-time.Duration(a.Time)) / float64(b.Time-a.Time)
+	return a, b, f(p)
+}
+
+func (track *Track) color(t time.Duration) uint32 {
+	a, b, p := track.interval(t)
+	var c uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		ca := float64((uint32(a.Color) >> shift) & 0xff)
+		cb := float64((uint32(b.Color) >> shift) & 0xff)
+		c |= uint32(math.Round(ca+(cb-ca)*p)) << shift
+	}
+	return c
+}
+
+func (track *Track) value(t time.Duration) float64 {
+	a, b, p := track.interval(t)
+	return a.Value + (b.Value-a.Value)*p
+}
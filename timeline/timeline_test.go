@@ -0,0 +1,140 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeline
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const show = `{
+  "duration": "4s",
+  "repeat": "ping-pong",
+  "tracks": [
+    {
+      "channel": 0, "start": 1, "length": 2, "param": "color",
+      "keyframes": [
+        {"time": "0s", "color": "#ff0000"},
+        {"time": "4s", "color": "#0000ff"}
+      ]
+    },
+    {
+      "channel": 0, "param": "brightness",
+      "keyframes": [
+        {"time": "0s", "value": 1},
+        {"time": "2s", "value": 0.5, "easing": "step"}
+      ]
+    }
+  ]
+}`
+
+func TestTimeline(t *testing.T) {
+	tl, err := Load(strings.NewReader(show))
+	assert.Nil(t, err)
+
+	leds := []uint32{0xffffff, 0, 0, 0xffffff}
+	tl.Render([][]uint32{leds}, 0)
+	assert.Equal(t, []uint32{0xffffff, 0xff0000, 0xff0000, 0xffffff}, leds)
+
+	tl.Render([][]uint32{leds}, time.Second)
+	assert.Equal(t, []uint32{0xffffff, 0xbf0040, 0xbf0040, 0xffffff}, leds)
+
+	// step easing: the brightness drops at the keyframe, the LEDs without
+	// color track are not dimmed
+	tl.Render([][]uint32{leds}, 2*time.Second)
+	assert.Equal(t, []uint32{0xffffff, 0x400040, 0x400040, 0xffffff}, leds)
+
+	// the brightness does not compound from frame to frame
+	tl.Render([][]uint32{leds}, 2*time.Second)
+	assert.Equal(t, []uint32{0xffffff, 0x400040, 0x400040, 0xffffff}, leds)
+
+	// ping-pong: 5s is the same frame as 3s
+	a := make([]uint32, 4)
+	b := make([]uint32, 4)
+	tl.Render([][]uint32{a}, 5*time.Second)
+	tl.Render([][]uint32{b}, 3*time.Second)
+	assert.Equal(t, a, b)
+}
+
+func TestRenderInvalidTracks(t *testing.T) {
+	tl := &Timeline{Duration: Duration(time.Second), Tracks: []Track{
+		{Channel: -1, Param: ParamColor, Keyframes: []Keyframe{{Color: 0xff}}},
+		{Channel: 2, Param: ParamColor, Keyframes: []Keyframe{{Color: 0xff}}},
+		{Channel: 0, Param: ParamColor},
+		{Channel: 0, Start: -1, Length: 1, Param: ParamColor, Keyframes: []Keyframe{{Color: 0x0a}}},
+	}}
+	leds := []uint32{0, 0}
+	tl.Render([][]uint32{leds}, 0)
+	assert.Equal(t, []uint32{0x0a, 0}, leds)
+}
+
+func TestLocalTimeZeroDuration(t *testing.T) {
+	for _, repeat := range []Repeat{Once, Loop, PingPong} {
+		tl := &Timeline{Repeat: repeat}
+		assert.Equal(t, time.Duration(0), tl.LocalTime(time.Second), repeat)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for s, want := range map[string]Color{"#102030": 0x102030, "10203040": 0x40102030} {
+		c, err := ParseColor(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, want, c, s)
+	}
+	for _, s := range []string{"", "#12345", "#1234567", "red", "#-12345"} {
+		_, err := ParseColor(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	tl := &Timeline{
+		Duration: Duration(time.Second),
+		Repeat:   Loop,
+		Tracks: []Track{{
+			Param: ParamColor,
+			Keyframes: []Keyframe{
+				{Time: 0, Color: 0x11223344},
+				{Time: Duration(500 * time.Millisecond), Color: 0x123456, Easing: "in-out-cubic"},
+			},
+		}},
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, tl.Save(&buf))
+	assert.Contains(t, buf.String(), `"#22334411"`)
+	assert.Contains(t, buf.String(), `"500ms"`)
+
+	loaded, err := Load(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, tl, loaded)
+}
+
+func TestValidate(t *testing.T) {
+	for _, s := range []string{
+		`{"duration": "0s"}`,
+		`{"duration": "1s", "repeat": "forever"}`,
+		`{"duration": "1s", "tracks": [{"param": "hue", "keyframes": [{"time": "0s"}]}]}`,
+		`{"duration": "1s", "tracks": [{"param": "color"}]}`,
+		`{"duration": "1s", "tracks": [{"param": "color", "keyframes": [{"time": "0s", "easing": "bounce"}]}]}`,
+		`{"duration": "1s", "tracks": [{"param": "color", "keyframes": [{"time": "0s", "color": "red"}]}]}`,
+	} {
+		_, err := Load(strings.NewReader(s))
+		assert.NotNil(t, err, s)
+	}
+}
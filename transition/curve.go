@@ -0,0 +1,93 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transition
+
+import (
+	"math/rand"
+
+	"github.com/rpi-ws281x/rpi-ws281x-go/easing"
+)
+
+// Curve defines the shape of a transition.
+type Curve interface {
+	// Mix returns the weight of the To effect, between 0 and 1, for the LED
+	// at index i of n when the transition has progressed by p.
+	Mix(p float64, i, n int) float64
+}
+
+// Ease is a crossfade of all LEDs at once following an easing function.
+type Ease easing.Func
+
+// Mix implements Curve.
+func (e Ease) Mix(p float64, i, n int) float64 {
+	return e(p)
+}
+
+// Predefined crossfades.
+// nolint: gochecknoglobals
+var (
+	// Linear crossfades at a constant speed
+	Linear = Ease(easing.Linear)
+	// EaseInOut crossfades slowly at the start and at the end
+	EaseInOut = Ease(easing.InOutCubic)
+)
+
+// Wipe sweeps the To effect over the From effect, from the first to the last
+// LED, or the other way round if Reverse is set.
+type Wipe struct {
+	// Softness is the width of the edge as a fraction of the strip (0 for a hard edge)
+	Softness float64
+	// Reverse sweeps from the last to the first LED
+	Reverse bool
+}
+
+// Mix implements Curve.
+func (w Wipe) Mix(p float64, i, n int) float64 {
+	if w.Reverse {
+		i = n - 1 - i
+	}
+	pos := (float64(i) + 0.5) / float64(n)
+	if w.Softness <= 0 {
+		if pos < p {
+			return 1
+		}
+		return 0
+	}
+	// the edge starts before the strip and ends after it so that the first
+	// and the last LEDs also fade completely.
+	return easing.Clamp((p*(1+w.Softness) - pos) / w.Softness)
+}
+
+// Dissolve switches the LEDs one by one in a random order.
+type Dissolve struct {
+	// Seed is the seed of the random order
+	Seed int64
+
+	order []float64
+}
+
+// Mix implements Curve.
+func (d *Dissolve) Mix(p float64, i, n int) float64 {
+	if len(d.order) != n {
+		d.order = make([]float64, n)
+		for rank, j := range rand.New(rand.NewSource(d.Seed)).Perm(n) { // nolint: gosec
+			d.order[j] = float64(rank) / float64(n)
+		}
+	}
+	if p > d.order[i] {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package transition blends two effects over a period of time, to switch from
+// a scene to another without abrupt jumps.
+package transition
+
+import (
+	"math"
+	"time"
+
+	"github.com/rpi-ws281x/rpi-ws281x-go/easing"
+	"github.com/rpi-ws281x/rpi-ws281x-go/effects"
+)
+
+// DefaultGamma is the gamma used to blend colors when Transition.Gamma is not set.
+const DefaultGamma = 2.2
+
+// Transition is an effect that blends the frames of the From effect into
+// the frames of the To effect over Duration. Both effects keep running during
+// the transition and are rendered with the same time.
+type Transition struct {
+	// From is the effect at the start of the transition
+	From effects.Effect
+	// To is the effect at the end of the transition
+	To effects.Effect
+	// Start is the time at which the transition starts
+	Start time.Duration
+	// Duration is the length of the transition
+	Duration time.Duration
+	// Curve is the shape of the transition (default Linear)
+	Curve Curve
+	// Gamma is the gamma of the LEDs (default DefaultGamma). Colors are blended
+	// in linear light so that the mid-point of a crossfade does not look darker
+	// than both ends.
+	Gamma float64
+
+	from, to []uint32
+	table    *gammaTable
+}
+
+// Progress returns the progress of the transition at time t, between 0 and 1.
+func (tr *Transition) Progress(t time.Duration) float64 {
+	if tr.Duration <= 0 {
+		if t >= tr.Start {
+			return 1
+		}
+		return 0
+	}
+	return easing.Clamp(float64(t-tr.Start) / float64(tr.Duration))
+}
+
+// Done returns true when the transition is complete at time t.
+func (tr *Transition) Done(t time.Duration) bool {
+	return tr.Progress(t) >= 1
+}
+
+// Render implements effects.Effect.
+func (tr *Transition) Render(leds []uint32, t time.Duration) {
+	p := tr.Progress(t)
+	switch {
+	case p <= 0 && tr.From != nil:
+		tr.From.Render(leds, t)
+		return
+	case p >= 1 && tr.To != nil:
+		tr.To.Render(leds, t)
+		return
+	}
+
+	n := len(leds)
+	if len(tr.from) != n {
+		tr.from = make([]uint32, n)
+		tr.to = make([]uint32, n)
+	}
+	render(tr.From, tr.from, t)
+	render(tr.To, tr.to, t)
+
+	curve := tr.Curve
+	if curve == nil {
+		curve = Linear
+	}
+	table := tr.gammaTable()
+	for i := range leds {
+		leds[i] = table.blend(tr.from[i], tr.to[i], curve.Mix(p, i, n))
+	}
+}
+
+func (tr *Transition) gammaTable() *gammaTable {
+	gamma := tr.Gamma
+	if gamma <= 0 {
+		gamma = DefaultGamma
+	}
+	if tr.table == nil || tr.table.gamma != gamma {
+		tr.table = newGammaTable(gamma)
+	}
+	return tr.table
+}
+
+// render renders e into leds, or blacks them out if there is no effect.
+func render(e effects.Effect, leds []uint32, t time.Duration) {
+	if e == nil {
+		effects.Fill(leds, 0)
+		return
+	}
+	e.Render(leds, t)
+}
+
+// Blend mixes two colors in linear light. f is the weight of b, between 0 and 1.
+func Blend(a, b uint32, f, gamma float64) uint32 {
+	return newGammaTable(gamma).blend(a, b, f)
+}
+
+// gammaTable converts color components to and from linear light.
+type gammaTable struct {
+	gamma  float64
+	linear [256]float64
+}
+
+func newGammaTable(gamma float64) *gammaTable {
+	t := &gammaTable{gamma: gamma}
+	for i := range t.linear {
+		t.linear[i] = math.Pow(float64(i)/255, gamma)
+	}
+	return t
+}
+
+func (t *gammaTable) blend(a, b uint32, f float64) uint32 {
+	switch {
+	case f <= 0:
+		return a
+	case f >= 1:
+		return b
+	}
+	var c uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		ca := t.linear[(a>>shift)&0xff]
+		cb := t.linear[(b>>shift)&0xff]
+		v := math.Pow(ca+(cb-ca)*f, 1/t.gamma)
+		c |= uint32(math.Round(v*255)) << shift
+	}
+	return c
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transition
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rpi-ws281x/rpi-ws281x-go/effects"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlend(t *testing.T) {
+	assert.Equal(t, uint32(0x000000), Blend(0, 0xffffff, 0, DefaultGamma))
+	assert.Equal(t, uint32(0xffffff), Blend(0, 0xffffff, 1, DefaultGamma))
+	// half of the light, not half of the value
+	assert.Equal(t, uint32(0xbababa), Blend(0, 0xffffff, 0.5, DefaultGamma))
+	assert.Equal(t, uint32(0x808080), Blend(0, 0xffffff, 0.5, 1.0))
+}
+
+func TestCrossfade(t *testing.T) {
+	tr := &Transition{
+		From:     &effects.Solid{Color: 0xff0000},
+		To:       &effects.Solid{Color: 0x0000ff},
+		Start:    time.Second,
+		Duration: time.Second,
+		Gamma:    1,
+	}
+	leds := make([]uint32, 3)
+	tr.Render(leds, 0)
+	assert.Equal(t, []uint32{0xff0000, 0xff0000, 0xff0000}, leds)
+	tr.Render(leds, 1500*time.Millisecond)
+	assert.Equal(t, []uint32{0x800080, 0x800080, 0x800080}, leds)
+	assert.False(t, tr.Done(1500*time.Millisecond))
+	tr.Render(leds, 2*time.Second)
+	assert.Equal(t, []uint32{0x0000ff, 0x0000ff, 0x0000ff}, leds)
+	assert.True(t, tr.Done(2*time.Second))
+}
+
+func TestWipe(t *testing.T) {
+	tr := &Transition{
+		From:     &effects.Solid{Color: 1},
+		To:       &effects.Solid{Color: 2},
+		Duration: time.Second,
+		Curve:    Wipe{},
+	}
+	leds := make([]uint32, 4)
+	tr.Render(leds, 500*time.Millisecond)
+	assert.Equal(t, []uint32{2, 2, 1, 1}, leds)
+	tr.Curve = Wipe{Reverse: true}
+	tr.Render(leds, 500*time.Millisecond)
+	assert.Equal(t, []uint32{1, 1, 2, 2}, leds)
+}
+
+func TestDissolve(t *testing.T) {
+	tr := &Transition{
+		From:     &effects.Solid{Color: 1},
+		To:       &effects.Solid{Color: 2},
+		Duration: time.Second,
+		Curve:    &Dissolve{Seed: 42},
+	}
+	leds := make([]uint32, 100)
+	count := func() (n int) {
+		for _, c := range leds {
+			if c == 2 {
+				n++
+			}
+		}
+		return n
+	}
+	tr.Render(leds, 250*time.Millisecond)
+	assert.Equal(t, 25, count())
+	tr.Render(leds, 750*time.Millisecond)
+	assert.Equal(t, 75, count())
+}
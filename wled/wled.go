@@ -0,0 +1,406 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wled emulates the JSON API of WLED (https://kno.wled.ge) on top of a
+// controller, so that the WLED mobile app and the WLED integration of Home
+// Assistant can control the device.
+//
+// Each channel of the device is a WLED segment, with the channel number as
+// segment ID. The supported subset of the API is /json, /json/state (GET and
+// POST), /json/info, /json/eff and /json/pal, with the on/off state, the
+// master and segment brightness, the primary color and the effect index.
+package wled
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/controller"
+	"github.com/rpi-ws281x/rpi-ws281x-go/effects"
+)
+
+// Version is the WLED version reported by the API.
+const Version = "0.14.0"
+
+// solid is the name of effect 0, which shows the primary color.
+const solid = "Solid"
+
+// maxBody limits the size of the request bodies.
+const maxBody = 1 << 16
+
+// State is the state of the device (/json/state).
+type State struct {
+	On         bool      `json:"on"`
+	Brightness int       `json:"bri"`
+	Transition int       `json:"transition"`
+	Segments   []Segment `json:"seg"`
+}
+
+// Segment is the state of a segment.
+type Segment struct {
+	ID         int       `json:"id"`
+	Start      int       `json:"start"`
+	Stop       int       `json:"stop"`
+	Len        int       `json:"len"`
+	On         bool      `json:"on"`
+	Brightness int       `json:"bri"`
+	Colors     [][]uint8 `json:"col"`
+	Effect     int       `json:"fx"`
+	Speed      int       `json:"sx"`
+	Intensity  int       `json:"ix"`
+	Palette    int       `json:"pal"`
+}
+
+// stateUpdate is the body of a POST to /json/state. All fields are optional.
+type stateUpdate struct {
+	On         *toggle         `json:"on"`
+	Brightness *int            `json:"bri"`
+	Segments   []segmentUpdate `json:"seg"`
+	Verbose    bool            `json:"v"`
+}
+
+type segmentUpdate struct {
+	ID         *int      `json:"id"`
+	On         *toggle   `json:"on"`
+	Brightness *int      `json:"bri"`
+	Colors     [][]uint8 `json:"col"`
+	Effect     *int      `json:"fx"`
+}
+
+// toggle is an on/off field of a state update: true, false or "t", which
+// inverts the current state.
+type toggle struct {
+	flip  bool
+	value bool
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *toggle) UnmarshalJSON(b []byte) error {
+	if string(b) == `"t"` {
+		t.flip = true
+		return nil
+	}
+	return json.Unmarshal(b, &t.value)
+}
+
+// apply returns the new state from the current state v.
+func (t *toggle) apply(v bool) bool {
+	if t.flip {
+		return !v
+	}
+	return t.value
+}
+
+// Info is the information about the device (/json/info).
+type Info struct {
+	Version    string   `json:"ver"`
+	VersionID  int      `json:"vid"`
+	Leds       InfoLeds `json:"leds"`
+	Name       string   `json:"name"`
+	UDPPort    int      `json:"udpport"`
+	Live       bool     `json:"live"`
+	EffectCnt  int      `json:"fxcount"`
+	PaletteCnt int      `json:"palcount"`
+	Arch       string   `json:"arch"`
+	Brand      string   `json:"brand"`
+	Product    string   `json:"product"`
+	MAC        string   `json:"mac"`
+	IP         string   `json:"ip"`
+}
+
+// InfoLeds describes the LEDs of the device.
+type InfoLeds struct {
+	Count  int  `json:"count"`
+	RGBW   bool `json:"rgbw"`
+	FPS    int  `json:"fps"`
+	MaxSeg int  `json:"maxseg"`
+}
+
+// Handler serves the WLED API.
+type Handler struct {
+	ctrl *controller.Controller
+	name string
+	fx   []string
+
+	mu    sync.Mutex
+	state State
+}
+
+// MakeHandler creates a handler for a controller. name is the name of the
+// device shown in the apps.
+func MakeHandler(ctrl *controller.Controller, name string) *Handler {
+	h := &Handler{ctrl: ctrl, name: name, fx: []string{solid}}
+	for _, n := range effects.Names() {
+		if n != "solid" {
+			h.fx = append(h.fx, n)
+		}
+	}
+
+	h.state = State{On: true, Brightness: 255}
+	start := 0
+	for i, ch := range ctrl.Status().Channels {
+		if ch.LedCount == 0 {
+			continue
+		}
+		h.state.Segments = append(h.state.Segments, Segment{
+			ID:         i,
+			Start:      start,
+			Stop:       start + ch.LedCount,
+			Len:        ch.LedCount,
+			On:         true,
+			Brightness: ch.Brightness,
+			Colors:     [][]uint8{{255, 160, 0}, {0, 0, 0}, {0, 0, 0}},
+			Speed:      128,
+			Intensity:  128,
+		})
+		start += ch.LedCount
+	}
+	return h
+}
+
+// Register registers the handler on the paths of the WLED API.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle("/json", h)
+	mux.Handle("/json/", h)
+	mux.Handle("/presets.json", h)
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if r.Method == http.MethodPost && (path == "/json" || path == "/json/state") {
+		h.post(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var v interface{}
+	switch path {
+	case "/json":
+		v = map[string]interface{}{
+			"state":    h.State(),
+			"info":     h.Info(r),
+			"effects":  h.fx,
+			"palettes": []string{"Default"},
+		}
+	case "/json/state":
+		v = h.State()
+	case "/json/info":
+		v = h.Info(r)
+	case "/json/eff":
+		v = h.fx
+	case "/json/pal":
+		v = []string{"Default"}
+	case "/presets.json":
+		v = struct{}{}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, v)
+}
+
+// State returns the current state.
+func (h *Handler) State() State {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.state
+	s.Segments = append([]Segment(nil), h.state.Segments...)
+	for i := range s.Segments {
+		colors := make([][]uint8, len(s.Segments[i].Colors))
+		for j, c := range s.Segments[i].Colors {
+			colors[j] = append([]uint8(nil), c...)
+		}
+		s.Segments[i].Colors = colors
+	}
+	return s
+}
+
+// Info returns the information about the device. r is the request, used to
+// report the IP address of the device.
+func (h *Handler) Info(r *http.Request) Info {
+	status := h.ctrl.Status()
+	info := Info{
+		Version:    Version,
+		VersionID:  2310130,
+		Name:       h.name,
+		UDPPort:    21324,
+		EffectCnt:  len(h.fx),
+		PaletteCnt: 1,
+		Arch:       "rpi-ws281x",
+		Brand:      "WLED",
+		Product:    "FOSS",
+		MAC:        mac(),
+	}
+	for _, ch := range status.Channels {
+		info.Leds.Count += ch.LedCount
+		if ch.LedCount > 0 {
+			info.Leds.MaxSeg++
+			if ws2811.StripeComponents(ch.StripeType) == 4 {
+				info.Leds.RGBW = true
+			}
+		}
+	}
+	info.Leds.FPS = int(status.FPS)
+	if r != nil {
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+			if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+				info.IP = host
+			}
+		}
+	}
+	return info
+}
+
+func (h *Handler) post(w http.ResponseWriter, r *http.Request) {
+	var u stateUpdate
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBody)).Decode(&u); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.update(&u); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if u.Verbose {
+		writeJSON(w, h.State())
+		return
+	}
+	writeJSON(w, map[string]bool{"success": true})
+}
+
+// update applies a state update to the controller.
+func (h *Handler) update(u *stateUpdate) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if u.On != nil {
+		h.state.On = u.On.apply(h.state.On)
+	}
+	if u.Brightness != nil {
+		h.state.Brightness = clamp(*u.Brightness)
+	}
+	for i, su := range u.Segments {
+		id := i
+		if su.ID != nil {
+			id = *su.ID
+		}
+		seg := h.segment(id)
+		if seg == nil {
+			continue
+		}
+		if su.On != nil {
+			seg.On = su.On.apply(seg.On)
+		}
+		if su.Brightness != nil {
+			seg.Brightness = clamp(*su.Brightness)
+		}
+		if len(su.Colors) > 0 && len(su.Colors[0]) >= 3 {
+			seg.Colors = append([][]uint8{su.Colors[0]}, seg.Colors[1:]...)
+		}
+		if su.Effect != nil && *su.Effect >= 0 && *su.Effect < len(h.fx) {
+			seg.Effect = *su.Effect
+		}
+		if err := h.apply(seg, su.Colors != nil || su.Effect != nil); err != nil {
+			return err
+		}
+	}
+	// the master brightness and the on/off state apply to all segments
+	for i := range h.state.Segments {
+		if err := h.apply(&h.state.Segments[i], false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) segment(id int) *Segment {
+	for i := range h.state.Segments {
+		if h.state.Segments[i].ID == id {
+			return &h.state.Segments[i]
+		}
+	}
+	return nil
+}
+
+// apply sets the brightness of the channel of a segment and, if restart is
+// set, its color and effect.
+func (h *Handler) apply(seg *Segment, restart bool) error {
+	brightness := 0
+	if h.state.On && seg.On {
+		brightness = h.state.Brightness * seg.Brightness / 255
+	}
+	if err := h.ctrl.SetBrightness(seg.ID, brightness); err != nil {
+		return err
+	}
+	if !restart {
+		return nil
+	}
+	color := colorOf(seg.Colors[0])
+	if seg.Effect == 0 {
+		return h.ctrl.Fill(seg.ID, 0, seg.Len, color)
+	}
+	name := h.fx[seg.Effect]
+	e, err := effects.New(name)
+	if err != nil {
+		return err
+	}
+	return h.ctrl.SetEffect(seg.ID, name, effects.WithColor(e, color))
+}
+
+// colorOf converts a WLED color, [R, G, B] or [R, G, B, W], to a LED color.
+func colorOf(c []uint8) uint32 {
+	v := uint32(c[0])<<16 | uint32(c[1])<<8 | uint32(c[2])
+	if len(c) > 3 {
+		v |= uint32(c[3]) << 24
+	}
+	return v
+}
+
+func clamp(v int) int {
+	switch {
+	case v < 0:
+		return 0
+	case v > 255:
+		return 255
+	}
+	return v
+}
+
+// mac returns the MAC address of the first network interface that has one,
+// without separators as WLED does.
+func mac() string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, i := range ifaces {
+		if len(i.HardwareAddr) > 0 && i.Flags&net.FlagLoopback == 0 {
+			return strings.ReplaceAll(i.HardwareAddr.String(), ":", "")
+		}
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v) // nolint: errcheck
+}
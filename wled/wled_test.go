@@ -0,0 +1,126 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wled
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ws2811 "github.com/rpi-ws281x/rpi-ws281x-go"
+	"github.com/rpi-ws281x/rpi-ws281x-go/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWLED(t *testing.T) {
+	opt := ws2811.Option{Channels: []ws2811.ChannelOption{
+		{LedCount: 3, Brightness: 255, StripeType: ws2811.WS2812Strip},
+		{LedCount: 2, Brightness: 100, StripeType: ws2811.SK6812StripGRBW},
+	}}
+	dev, err := ws2811.MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, dev.Init())
+	ctrl := controller.MakeController(dev, &opt, 0)
+	h := MakeHandler(ctrl, "test")
+	mux := http.NewServeMux()
+	h.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string, v interface{}) {
+		resp, err := http.Get(server.URL + path)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	post := func(body string) State {
+		resp, err := http.Post(server.URL+"/json/state", "application/json", bytes.NewBufferString(body))
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var s State
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&s))
+		return s
+	}
+
+	var info Info
+	get("/json/info", &info)
+	assert.Equal(t, 5, info.Leds.Count)
+	assert.True(t, info.Leds.RGBW)
+	assert.Equal(t, 2, info.Leds.MaxSeg)
+	assert.Equal(t, "test", info.Name)
+	assert.Equal(t, "127.0.0.1", info.IP)
+
+	var all struct {
+		State   State    `json:"state"`
+		Effects []string `json:"effects"`
+	}
+	get("/json", &all)
+	assert.Equal(t, "Solid", all.Effects[0])
+	assert.Equal(t, 2, len(all.State.Segments))
+	assert.Equal(t, 3, all.State.Segments[1].Start)
+
+	// solid color on segment 1
+	s := post(`{"v": true, "seg": [{"id": 1, "col": [[1, 2, 3, 4]], "fx": 0}]}`)
+	assert.Equal(t, []uint8{1, 2, 3, 4}, s.Segments[1].Colors[0])
+	assert.Nil(t, ctrl.RenderFrame(time.Now()))
+	assert.Equal(t, []uint32{0x04010203, 0x04010203}, dev.Leds(1))
+
+	// master brightness and segment brightness
+	post(`{"bri": 128, "seg": [{"id": 1, "bri": 128}]}`)
+	b, err := ctrl.Brightness(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 64, b)
+	b, err = ctrl.Brightness(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 128, b)
+
+	// off
+	post(`{"on": false}`)
+	b, err = ctrl.Brightness(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, b)
+
+	// effect by index
+	var fx []string
+	get("/json/eff", &fx)
+	s = post(`{"on": true, "v": true, "seg": [{"fx": 2}]}`)
+	assert.True(t, s.On)
+	name, err := ctrl.Effect(0)
+	assert.Nil(t, err)
+	assert.Equal(t, fx[2], name)
+
+	// "t" toggles the on/off state
+	s = post(`{"on": "t", "v": true, "seg": [{"id": 1, "on": "t"}]}`)
+	assert.False(t, s.On)
+	assert.False(t, s.Segments[1].On)
+	s = post(`{"on": "t", "v": true}`)
+	assert.True(t, s.On)
+	resp, err := http.Post(server.URL+"/json/state", "application/json", bytes.NewBufferString(`{"on": "x"}`))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// the state returned does not share the colors of the handler
+	s = h.State()
+	s.Segments[1].Colors[0][0] = 42
+	assert.Equal(t, []uint8{1, 2, 3, 4}, h.State().Segments[1].Colors[0])
+	post(`{"seg": [{"id": 1, "col": [[5, 6, 7]]}]}`)
+	assert.Equal(t, []uint8{42, 2, 3, 4}, s.Segments[1].Colors[0])
+}
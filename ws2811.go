@@ -19,7 +19,12 @@
 
 package ws2811
 
-import "github.com/pkg/errors"
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
 
 const (
 	// DefaultDmaNum is the default DMA number.
@@ -47,6 +52,8 @@ const (
 	HwVerTypePi1 = 1
 	// HwVerTypePi2 represents the Raspberry Pi 2
 	HwVerTypePi2 = 2
+	// HwVerTypePi4 represents the Raspberry Pi 4
+	HwVerTypePi4 = 3
 )
 
 // StateDesc is a map from a return state to its string description.
@@ -114,6 +121,24 @@ type Option struct {
 	Channels []ChannelOption
 }
 
+// Device is the set of methods shared by the hardware and the simulated
+// WS2811 backends. Code that only drives LEDs should depend on Device rather
+// than on *WS2811 so that it can run against any backend.
+type Device interface {
+	// Init initialize the device. It should be called only once before any other method.
+	Init() error
+	// Fini shuts down the device and frees memory.
+	Fini()
+	// Leds returns the LEDs array of a given channel
+	Leds(channel int) []uint32
+	// Render sends a complete frame to the LED Matrix
+	Render() error
+	// Wait waits for render to finish.
+	Wait() error
+	// SetBrightness changes the brightness of a given channel. Value between 0 and 255
+	SetBrightness(channel int, brightness int)
+}
+
 // DefaultOptions defines sensible default options for MakeWS2811
 //nolint: gochecknoglobals
 var DefaultOptions = Option{
@@ -131,6 +156,8 @@ var DefaultOptions = Option{
 	},
 }
 
+var _ Device = (*WS2811)(nil)
+
 // Leds returns the LEDs array of a given channel
 func (ws2811 *WS2811) Leds(channel int) []uint32 {
 	return ws2811.leds[channel]
@@ -155,6 +182,40 @@ func (ws2811 *WS2811) SetLedsSync(channel int, leds []uint32) error {
 	return nil
 }
 
+// TimeoutError is returned by RenderContext and WaitContext when the context is
+// canceled or its deadline expires before the operation completes.
+type TimeoutError struct {
+	// Op is the interrupted operation ("render" or "wait")
+	Op string
+	// Err is the error of the context
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("error ws2811.%s: %v", e.Op, e.Err)
+}
+
+// Timeout reports whether the operation was interrupted by a deadline rather
+// than by a cancellation.
+func (e *TimeoutError) Timeout() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// Unwrap returns the error of the context
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// ContextError returns a *TimeoutError for the operation op if the context is
+// already done, nil otherwise. It is meant for the backends that implement
+// RenderContext and WaitContext.
+func ContextError(ctx context.Context, op string) error {
+	if err := ctx.Err(); err != nil {
+		return &TimeoutError{Op: op, Err: err}
+	}
+	return nil
+}
+
 // StatusDesc returns the description of a status code
 func StatusDesc(code int) string {
 	desc, ok := StateDesc[code]
@@ -0,0 +1,78 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !arm && !arm64
+// +build !arm,!arm64
+
+package ws2811
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitContext(t *testing.T) {
+	opt := Option{Channels: []ChannelOption{{LedCount: 4}}}
+	ws, err := MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	defer ws.Fini()
+
+	assert.Nil(t, ws.RenderContext(context.Background()))
+	assert.Nil(t, ws.WaitContext(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	var te *TimeoutError
+	err = ws.WaitContext(ctx)
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, "wait", te.Op)
+	assert.True(t, te.Timeout())
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = ws.RenderContext(ctx)
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, "render", te.Op)
+	assert.False(t, te.Timeout())
+}
+
+func TestWaitContextDuringTransfer(t *testing.T) {
+	// 10000 RGB LEDs take 300ms at 800kHz
+	opt := Option{Frequency: TargetFreq, Channels: []ChannelOption{{LedCount: 10000}}}
+	ws, err := MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	defer ws.Fini()
+
+	assert.Nil(t, ws.Render())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var te *TimeoutError
+	assert.True(t, errors.As(ws.RenderContext(ctx), &te))
+	assert.True(t, te.Timeout())
+	assert.True(t, time.Since(start) < 200*time.Millisecond)
+
+	assert.Nil(t, ws.Wait())
+	assert.True(t, time.Since(start) >= 250*time.Millisecond)
+	assert.Nil(t, ws.WaitContext(context.Background()))
+}
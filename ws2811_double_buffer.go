@@ -0,0 +1,99 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ws2811
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DoubleBuffer is a thread-safe back buffer for a Device. Goroutines draw into
+// the back buffer and Swap copies it into the LEDs array of the device once the
+// previous frame has been sent, so that writers never touch memory that the DMA
+// might be reading.
+type DoubleBuffer struct {
+	dev  Device
+	mu   sync.Mutex
+	back [][]uint32
+
+	// swapMu serializes Swap, which owns front
+	swapMu sync.Mutex
+	front  [][]uint32
+}
+
+// MakeDoubleBuffer creates a DoubleBuffer for an initialized device. The back
+// buffer of each channel has the same size as the LEDs array of the device.
+func MakeDoubleBuffer(dev Device) *DoubleBuffer {
+	db := &DoubleBuffer{
+		dev:   dev,
+		back:  make([][]uint32, RpiPwmChannels),
+		front: make([][]uint32, RpiPwmChannels),
+	}
+	for i := 0; i < RpiPwmChannels; i++ {
+		db.back[i] = make([]uint32, len(dev.Leds(i)))
+		db.front[i] = make([]uint32, len(dev.Leds(i)))
+	}
+	return db
+}
+
+// Draw calls fn with the back buffer of a given channel. The buffer is locked
+// during the call and must not be retained after fn returns.
+func (db *DoubleBuffer) Draw(channel int, fn func(leds []uint32)) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	fn(db.back[channel])
+}
+
+// SetLed sets the color of a single LED in the back buffer of a given channel.
+func (db *DoubleBuffer) SetLed(channel int, index int, color uint32) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.back[channel][index] = color
+}
+
+// SetLeds replaces the LEDs of the back buffer of a given channel.
+func (db *DoubleBuffer) SetLeds(channel int, leds []uint32) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if len(leds) > len(db.back[channel]) {
+		return errors.New("Error: Too many LEDs")
+	}
+	copy(db.back[channel], leds)
+	return nil
+}
+
+// Swap takes a snapshot of the back buffer of all channels, waits for the
+// previous frame to finish, copies the snapshot into the device and renders
+// the new frame. The back buffer is only locked while the snapshot is taken,
+// so goroutines can draw the next frame while Swap waits. The back buffer
+// keeps its content, so the next frame can be drawn incrementally.
+func (db *DoubleBuffer) Swap() error {
+	db.swapMu.Lock()
+	defer db.swapMu.Unlock()
+	db.mu.Lock()
+	for i := range db.back {
+		copy(db.front[i], db.back[i])
+	}
+	db.mu.Unlock()
+
+	if err := db.dev.Wait(); err != nil {
+		return errors.WithMessage(err, "Error swapping buffers")
+	}
+	for i := range db.front {
+		copy(db.dev.Leds(i), db.front[i])
+	}
+	return db.dev.Render()
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !arm && !arm64
+// +build !arm,!arm64
+
+package ws2811
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoubleBufferConcurrentProducers(t *testing.T) {
+	const (
+		producers = 4
+		frames    = 100
+		ledCount  = 32
+	)
+
+	opt := Option{
+		Frequency: TargetFreq,
+		DmaNum:    DefaultDmaNum,
+		Channels:  []ChannelOption{{GpioPin: DefaultGpioPin, LedCount: ledCount, Brightness: DefaultBrightness}},
+	}
+	ws, err := MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	defer ws.Fini()
+
+	db := MakeDoubleBuffer(ws)
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(color uint32) {
+			defer wg.Done()
+			for f := 0; f < frames; f++ {
+				db.Draw(0, func(leds []uint32) {
+					for i := range leds {
+						leds[i] = color
+					}
+				})
+			}
+		}(uint32(p + 1))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		assert.Nil(t, db.Swap())
+		// Every frame must have been drawn by a single producer.
+		leds := ws.Leds(0)
+		for i := range leds {
+			assert.Equal(t, leds[0], leds[i])
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+	}
+}
+
+func TestDoubleBufferSetLeds(t *testing.T) {
+	opt := Option{Channels: []ChannelOption{{LedCount: 4}}}
+	ws, err := MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	defer ws.Fini()
+
+	db := MakeDoubleBuffer(ws)
+	assert.Nil(t, db.SetLeds(0, []uint32{1, 2, 3}))
+	db.SetLed(0, 3, 4)
+	assert.Equal(t, []uint32{0, 0, 0, 0}, ws.Leds(0))
+	assert.Nil(t, db.Swap())
+	assert.Equal(t, []uint32{1, 2, 3, 4}, ws.Leds(0))
+	assert.NotNil(t, db.SetLeds(0, make([]uint32, 5)))
+}
+
+func TestDoubleBufferDrawDuringSwap(t *testing.T) {
+	// 10000 LEDs take about 300ms to send
+	opt := Option{Channels: []ChannelOption{{LedCount: 10000}}}
+	ws, err := MakeWS2811(&opt)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Init())
+	defer ws.Fini()
+
+	db := MakeDoubleBuffer(ws)
+	assert.Nil(t, db.Swap())
+	swapped := make(chan error)
+	go func() { swapped <- db.Swap() }()
+	time.Sleep(20 * time.Millisecond)
+
+	// the second Swap waits for the first frame without locking the back buffer
+	start := time.Now()
+	db.SetLed(0, 0, 1)
+	assert.True(t, time.Since(start) < 100*time.Millisecond, "SetLed blocked during Swap")
+	assert.Nil(t, <-swapped)
+}
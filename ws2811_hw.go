@@ -30,8 +30,10 @@ package ws2811
 import "C"
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"unsafe"
 )
 
@@ -40,6 +42,17 @@ type WS2811 struct {
 	dev         *C.ws2811_t
 	initialized bool
 	leds        [][]uint32
+
+	// pending is the wait started by WaitContext that has not completed yet.
+	// C.ws2811_wait cannot be interrupted, so a canceled WaitContext leaves it
+	// running and the next call joins it instead of starting a new one.
+	mu      sync.Mutex
+	pending *pendingWait
+}
+
+type pendingWait struct {
+	done chan struct{}
+	err  error
 }
 
 // HwDetect gives information about the hardware
@@ -154,8 +167,59 @@ func (ws2811 *WS2811) Wait() error {
 	return nil
 }
 
-// Fini shuts down the device and frees memory.
+// RenderContext is like Render but gives up when the context is done before
+// the previous frame has been sent.
+func (ws2811 *WS2811) RenderContext(ctx context.Context) error {
+	if err := ws2811.waitContext(ctx, "render"); err != nil {
+		return err
+	}
+	return ws2811.Render()
+}
+
+// WaitContext is like Wait but gives up when the context is done. It then
+// returns a *TimeoutError.
+func (ws2811 *WS2811) WaitContext(ctx context.Context) error {
+	return ws2811.waitContext(ctx, "wait")
+}
+
+func (ws2811 *WS2811) waitContext(ctx context.Context, op string) error {
+	if err := ContextError(ctx, op); err != nil {
+		return err
+	}
+
+	ws2811.mu.Lock()
+	p := ws2811.pending
+	if p == nil {
+		p = &pendingWait{done: make(chan struct{})}
+		ws2811.pending = p
+		go func() {
+			p.err = ws2811.Wait()
+			ws2811.mu.Lock()
+			ws2811.pending = nil
+			ws2811.mu.Unlock()
+			close(p.done)
+		}()
+	}
+	ws2811.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		return &TimeoutError{Op: op, Err: ctx.Err()}
+	}
+}
+
+// Fini shuts down the device and frees memory. If a WaitContext gave up
+// before the end of the transfer, Fini waits for it, as the C library still
+// uses the device.
 func (ws2811 *WS2811) Fini() {
+	ws2811.mu.Lock()
+	p := ws2811.pending
+	ws2811.mu.Unlock()
+	if p != nil {
+		<-p.done
+	}
 	C.ws2811_fini(ws2811.dev)
 	// release the memory allocated by MakeWS2811. Note that we should not release
 	// ws2811.dev.channel[i].gamma (also allocated by MakeWS2811) because C.ws2811_fini
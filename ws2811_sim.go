@@ -22,14 +22,24 @@
 package ws2811
 
 import (
+	"context"
 	"errors"
+	"sync"
+	"time"
 )
 
+// resetTime is the time the line stays low after a frame.
+const resetTime = 50 * time.Microsecond
+
 // WS2811 represent the ws2811 device
 type WS2811 struct {
 	initialized bool
 	leds        [][]uint32
 	opt         *Option
+
+	mu sync.Mutex
+	// busyUntil is the end of the transfer of the last rendered frame
+	busyUntil time.Time
 }
 
 // HwDetect gives information about the hardware
@@ -78,17 +88,74 @@ func (ws2811 *WS2811) Init() error {
 // SetBrightness changes the brightness of a given channel. Value between 0 and 255
 func (ws2811 *WS2811) SetBrightness(channel int, brightness int) {}
 
-// Render sends a complete frame to the LED Matrix
+// Render sends a complete frame to the LED Matrix. The simulated transfer
+// takes as long as with the hardware, see Wait.
 func (ws2811 *WS2811) Render() error {
+	ws2811.mu.Lock()
+	ws2811.busyUntil = time.Now().Add(ws2811.transferTime())
+	ws2811.mu.Unlock()
 	return nil
 }
 
+// transferTime returns the time needed to send a frame. The channels are sent
+// at the same time.
+func (ws2811 *WS2811) transferTime() time.Duration {
+	freq := ws2811.opt.Frequency
+	if freq <= 0 {
+		freq = TargetFreq
+	}
+	var bits int
+	for i, ch := range ws2811.opt.Channels {
+		if i < len(ws2811.leds) {
+			if b := len(ws2811.leds[i]) * 8 * StripeComponents(ch.StripeType); b > bits {
+				bits = b
+			}
+		}
+	}
+	return time.Duration(bits)*time.Second/time.Duration(freq) + resetTime
+}
+
 // Wait waits for render to finish. The time needed for render is given by:
 // time = 1/frequency * 8 * 3 * LedCount + 0.05
 // (8 is the color depth and 3 is the number of colors (LEDs) per pixel).
 // See https://cdn-shop.adafruit.com/datasheets/WS2811.pdf for more details.
 func (ws2811 *WS2811) Wait() error {
-	return nil
+	return ws2811.WaitContext(context.Background())
+}
+
+// RenderContext is like Render but gives up when the context is done before
+// the previous frame has been sent.
+func (ws2811 *WS2811) RenderContext(ctx context.Context) error {
+	if err := ws2811.waitContext(ctx, "render"); err != nil {
+		return err
+	}
+	return ws2811.Render()
+}
+
+// WaitContext is like Wait but gives up when the context is done. It then
+// returns a *TimeoutError.
+func (ws2811 *WS2811) WaitContext(ctx context.Context) error {
+	return ws2811.waitContext(ctx, "wait")
+}
+
+func (ws2811 *WS2811) waitContext(ctx context.Context, op string) error {
+	if err := ContextError(ctx, op); err != nil {
+		return err
+	}
+	ws2811.mu.Lock()
+	wait := time.Until(ws2811.busyUntil)
+	ws2811.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return &TimeoutError{Op: op, Err: ctx.Err()}
+	}
 }
 
 // Fini shuts down the device and frees memory.
@@ -0,0 +1,142 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the names of the stripe types and helpers to decode them.
+
+package ws2811
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// stripeTypeNames are the stripe types by lower case name: the constant
+// names, the orders of the components on the wire and the LED types.
+// nolint: gochecknoglobals
+var stripeTypeNames = map[string]int{
+	"sk6812striprgbw": SK6812StripRGBW,
+	"sk6812striprbgw": SK6812StripRBGW,
+	"sk6812stripgrbw": SK6812StripGRBW,
+	"sk6812striogbrw": SK6812StrioGBRW,
+	"sk6812striobrgw": SK6812StrioBRGW,
+	"sk6812stripbgrw": SK6812StripBGRW,
+	"ws2811striprgb":  WS2811StripRGB,
+	"ws2811striprbg":  WS2811StripRBG,
+	"ws2811stripgrb":  WS2811StripGRB,
+	"ws2811stripgbr":  WS2811StripGBR,
+	"ws2811stripbrg":  WS2811StripBRG,
+	"ws2811stripbgr":  WS2811StripBGR,
+	"ws2812strip":     WS2812Strip,
+	"sk6812strip":     SK6812Strip,
+	"sk6812wstrip":    SK6812WStrip,
+	"rgbw":            SK6812StripRGBW,
+	"rbgw":            SK6812StripRBGW,
+	"grbw":            SK6812StripGRBW,
+	"gbrw":            SK6812StrioGBRW,
+	"brgw":            SK6812StrioBRGW,
+	"bgrw":            SK6812StripBGRW,
+	"rgb":             WS2811StripRGB,
+	"rbg":             WS2811StripRBG,
+	"grb":             WS2811StripGRB,
+	"gbr":             WS2811StripGBR,
+	"brg":             WS2811StripBRG,
+	"bgr":             WS2811StripBGR,
+	"ws2811":          WS2811StripRGB,
+	"ws2812":          WS2812Strip,
+	"sk6812":          SK6812Strip,
+	"sk6812w":         SK6812WStrip,
+}
+
+// stripeTypeConstants are the names of the stripe type constants. The
+// predefined LED types are aliases and use the name of the order they send.
+// nolint: gochecknoglobals
+var stripeTypeConstants = map[int]string{
+	SK6812StripRGBW: "SK6812StripRGBW",
+	SK6812StripRBGW: "SK6812StripRBGW",
+	SK6812StripGRBW: "SK6812StripGRBW",
+	SK6812StrioGBRW: "SK6812StrioGBRW",
+	SK6812StrioBRGW: "SK6812StrioBRGW",
+	SK6812StripBGRW: "SK6812StripBGRW",
+	WS2811StripRGB:  "WS2811StripRGB",
+	WS2811StripRBG:  "WS2811StripRBG",
+	WS2811StripGRB:  "WS2811StripGRB",
+	WS2811StripGBR:  "WS2811StripGBR",
+	WS2811StripBRG:  "WS2811StripBRG",
+	WS2811StripBGR:  "WS2811StripBGR",
+}
+
+// stripeShifts are the shifts of the components of a LED value (0xWWRRGGBB)
+// and the letters of the components.
+// nolint: gochecknoglobals
+var stripeShifts = map[int]byte{16: 'r', 8: 'g', 0: 'b', 24: 'w'}
+
+// ParseStripeType parses a stripe type from its name, without regard to case.
+// The names are the constant names ("WS2811StripGRB"), the orders of the
+// components on the wire ("grb", "grbw") and the LED types ("ws2812",
+// "sk6812", "sk6812w"). Numbers such as "0x081000" are accepted as well.
+func ParseStripeType(s string) (int, error) {
+	if t, ok := stripeTypeNames[strings.ToLower(s)]; ok {
+		return t, nil
+	}
+	t, err := strconv.ParseInt(s, 0, 64)
+	if err != nil || StripeByteOrder(int(t)) == "" {
+		return 0, errors.Errorf("Error: unknown stripe type %q", s)
+	}
+	return int(t), nil
+}
+
+// StripeTypeName returns the name of the constant of a stripe type, such as
+// "WS2811StripGRB", which ParseStripeType accepts. The predefined LED types
+// have the name of their order: WS2812Strip is "WS2811StripGRB". The stripe
+// types without a constant are returned as a number, such as "0x10180800".
+func StripeTypeName(stripeType int) string {
+	if name, ok := stripeTypeConstants[stripeType]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%06X", stripeType)
+}
+
+// StripeComponents returns the number of components, 3 (RGB) or 4 (RGBW), of
+// a LED of a stripe type, which is also the number of bytes sent per LED.
+func StripeComponents(stripeType int) int {
+	if stripeType&SK6812ShiftWMask != 0 {
+		return 4
+	}
+	return 3
+}
+
+// StripeByteOrder returns the components of a stripe type in the order they
+// are sent on the wire, such as "grb" or "grbw", or the empty string if the
+// stripe type is invalid.
+func StripeByteOrder(stripeType int) string {
+	// the shift of the LED value sent in each byte, as in the C library
+	shifts := []int{stripeType >> 16 & 0xff, stripeType >> 8 & 0xff, stripeType & 0xff}
+	if StripeComponents(stripeType) == 4 {
+		shifts = append(shifts, stripeType>>24&0xff)
+	} else if stripeType>>24 != 0 {
+		return ""
+	}
+	order := make([]byte, 0, len(shifts))
+	for _, s := range shifts {
+		c, ok := stripeShifts[s]
+		if !ok || strings.IndexByte(string(order), c) >= 0 || (c == 'w' && len(shifts) == 3) {
+			return ""
+		}
+		order = append(order, c)
+	}
+	return string(order)
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Jacques Supcik / HEIA-FR
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ws2811
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripeTypeName(t *testing.T) {
+	for order, stripeType := range map[string]int{
+		"rgb":  WS2811StripRGB,
+		"rbg":  WS2811StripRBG,
+		"grb":  WS2811StripGRB,
+		"gbr":  WS2811StripGBR,
+		"brg":  WS2811StripBRG,
+		"bgr":  WS2811StripBGR,
+		"rgbw": SK6812StripRGBW,
+		"rbgw": SK6812StripRBGW,
+		"grbw": SK6812StripGRBW,
+		"gbrw": SK6812StrioGBRW,
+		"brgw": SK6812StrioBRGW,
+		"bgrw": SK6812StripBGRW,
+	} {
+		assert.Equal(t, order, StripeByteOrder(stripeType))
+		assert.Equal(t, len(order), StripeComponents(stripeType), order)
+		parsed, err := ParseStripeType(order)
+		assert.Nil(t, err)
+		assert.Equal(t, stripeType, parsed, order)
+	}
+	for name, stripeType := range map[string]int{
+		"WS2811StripRGB":  WS2811StripRGB,
+		"WS2811StripRBG":  WS2811StripRBG,
+		"WS2811StripGRB":  WS2811StripGRB,
+		"WS2811StripGBR":  WS2811StripGBR,
+		"WS2811StripBRG":  WS2811StripBRG,
+		"WS2811StripBGR":  WS2811StripBGR,
+		"SK6812StripRGBW": SK6812StripRGBW,
+		"SK6812StripRBGW": SK6812StripRBGW,
+		"SK6812StripGRBW": SK6812StripGRBW,
+		"SK6812StrioGBRW": SK6812StrioGBRW,
+		"SK6812StrioBRGW": SK6812StrioBRGW,
+		"SK6812StripBGRW": SK6812StripBGRW,
+	} {
+		assert.Equal(t, name, StripeTypeName(stripeType))
+		parsed, err := ParseStripeType(name)
+		assert.Nil(t, err)
+		assert.Equal(t, stripeType, parsed, name)
+	}
+	assert.Equal(t, "WS2811StripGRB", StripeTypeName(WS2812Strip))
+	assert.Equal(t, "WS2811StripGRB", StripeTypeName(SK6812Strip))
+	assert.Equal(t, "SK6812StripGRBW", StripeTypeName(SK6812WStrip))
+	assert.Equal(t, "0x10180800", StripeTypeName(0x10180800))
+	assert.Equal(t, "0x101008", StripeTypeName(0x101008))
+	assert.Equal(t, "0x181008", StripeTypeName(0x181008))
+}
+
+func TestParseStripeType(t *testing.T) {
+	for s, want := range map[string]int{
+		"WS2811StripGRB":  WS2811StripGRB,
+		"SK6812StrioGBRW": SK6812StrioGBRW,
+		"ws2812strip":     WS2812Strip,
+		"SK6812W":         SK6812WStrip,
+		"sk6812":          SK6812Strip,
+		"GRBW":            SK6812StripGRBW,
+		"0x081000":        WS2811StripGRB,
+		"0x10180800":      0x10180800,
+	} {
+		got, err := ParseStripeType(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "rgbx", "0x101008", "0x181008", "-1"} {
+		_, err := ParseStripeType(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestStripeTypeRoundTrip(t *testing.T) {
+	for s, want := range map[string]int{
+		"grb":      WS2811StripGRB,
+		"GRBW":     SK6812StripGRBW,
+		"sk6812w":  SK6812WStrip,
+		"0x081000": WS2811StripGRB,
+	} {
+		got, err := ParseStripeType(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, want, got, s)
+		again, err := ParseStripeType(StripeTypeName(got))
+		assert.Nil(t, err, s)
+		assert.Equal(t, got, again, s)
+	}
+	_, err := ParseStripeType("rgbx")
+	assert.NotNil(t, err)
+	assert.Equal(t, "SK6812StrioGBRW", StripeTypeName(SK6812StrioGBRW))
+
+	// values without a name are written as numbers
+	assert.Equal(t, "0x181008", StripeTypeName(0x00181008))
+	assert.Equal(t, "0x000000", StripeTypeName(0))
+}